@@ -3,33 +3,37 @@ package main
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/balibuild/bali/v3/pkg/barrow"
 )
 
 type BuildCommand struct {
-	Target      string   `name:"target" short:"T" help:"Target OS for which the code is compiled" default:"${target}"`       // windows/darwin
-	Arch        string   `name:"arch" short:"A" help:"Target architecture for which the code is compiled" default:"${arch}"` // amd64/arm64 ...
-	Release     string   `name:"release" help:"Specifies the rpm package tag version"`                                       // --release $TASK_ID
-	Destination string   `name:"destination" short:"D" help:"Specify the package save destination" default:"out"`
-	Pack        []string `name:"pack" help:"Packaged in a specific format. supported: zip, tar, sh, rpm, deb, apk, arch"`
-	Compression string   `name:"compression" help:"Specifies the compression method"`
+	Target      string        `name:"target" short:"T" help:"Target OS for which the code is compiled" default:"${target}"`                                  // windows/darwin
+	Arch        string        `name:"arch" short:"A" help:"Target architecture for which the code is compiled, darwin supports universal" default:"${arch}"` // amd64/arm64 ...
+	Release     string        `name:"release" help:"Specifies the rpm package tag version"`                                                                  // --release $TASK_ID
+	Destination string        `name:"destination" short:"D" help:"Specify the package save destination" default:"out"`
+	Pack        []string      `name:"pack" help:"Packaged in a specific format. supported: ${packs}"`
+	Compression string        `name:"compression" help:"Specifies the compression method and level, e.g. zstd:19, xz:9, gzip:1"`
+	Timeout     time.Duration `name:"timeout" help:"Abort the build when it runs longer than the timeout, e.g. 10m"`
 }
 
-func (c *BuildCommand) Run(g *Globals) error {
-	b := barrow.BarrowCtx{
-		CWD:         g.M,
-		Out:         g.B,
-		Target:      c.Target,
-		Arch:        c.Arch,
-		Release:     c.Release,
-		Destination: c.Destination,
-		Pack:        c.Pack,
-		Compression: strings.ToLower(c.Compression),
-		Verbose:     g.Verbose,
-	}
-	if err := b.Initialize(context.Background()); err != nil {
+func (c *BuildCommand) Run(ctx context.Context, g *Globals) error {
+	logger, closeLogger := g.progressLogger()
+	defer closeLogger()
+	b := barrow.New(g.M,
+		barrow.WithOut(g.B),
+		barrow.WithTarget(c.Target, c.Arch),
+		barrow.WithRelease(c.Release),
+		barrow.WithDestination(c.Destination),
+		barrow.WithPack(c.Pack...),
+		barrow.WithCompression(strings.ToLower(c.Compression)),
+		barrow.WithTimeout(c.Timeout),
+		barrow.WithVerbose(g.Verbose > 0),
+		barrow.WithLogger(logger))
+	if err := b.Initialize(ctx); err != nil {
 		return err
 	}
-	return b.Run(context.Background())
+	_, err := b.Run(ctx)
+	return err
 }
@@ -10,11 +10,10 @@ type CleanCommand struct {
 }
 
 func (c *CleanCommand) Run(g *Globals) error {
-	b := barrow.BarrowCtx{
-		CWD:         g.M,
-		Out:         g.B,
-		Destination: c.Destination,
-		Verbose:     g.Verbose,
-	}
+	b := barrow.New(g.M,
+		barrow.WithOut(g.B),
+		barrow.WithDestination(c.Destination),
+		barrow.WithVerbose(g.Verbose > 0),
+		barrow.WithLogger(g.logger()))
 	return b.Cleanup(c.Force)
 }
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/balibuild/bali/v3/pkg/barrow"
+)
+
+type InspectCommand struct {
+	JSON      bool     `name:"json" help:"Print the artifact contents as JSON"`
+	Artifacts []string `arg:"" name:"artifact" help:"Produced packages to inspect" type:"path"`
+}
+
+func (c *InspectCommand) Run(g *Globals) error {
+	for i, name := range c.Artifacts {
+		a, err := barrow.OpenArtifact(name)
+		if err != nil {
+			return fmt.Errorf("inspect %s: %w", name, err)
+		}
+		if c.JSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(a); err != nil {
+				return err
+			}
+			continue
+		}
+		if i != 0 {
+			fmt.Fprintln(os.Stdout)
+		}
+		if err := a.WriteTable(os.Stdout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
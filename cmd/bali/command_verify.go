@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/balibuild/bali/v3/pkg/barrow"
+)
+
+type VerifyCommand struct {
+	Target    string   `name:"target" short:"T" help:"Target OS for which the code is compiled" default:"${target}"`
+	Arch      string   `name:"arch" short:"A" help:"Target architecture for which the code is compiled" default:"${arch}"`
+	Release   string   `name:"release" help:"Specifies the rpm package tag version"`
+	Artifacts []string `arg:"" name:"artifact" help:"Produced packages to verify" type:"path"`
+}
+
+func (c *VerifyCommand) Run(ctx context.Context, g *Globals) error {
+	b := barrow.New(g.M,
+		barrow.WithOut(g.B),
+		barrow.WithTarget(c.Target, c.Arch),
+		barrow.WithRelease(c.Release),
+		barrow.WithVerbose(g.Verbose > 0),
+		barrow.WithLogger(g.logger()))
+	if err := b.Initialize(ctx); err != nil {
+		return err
+	}
+	var failed int
+	for _, a := range c.Artifacts {
+		if r, err := b.Verify(ctx, a); err != nil {
+			failed++
+			if r == nil {
+				printError(err) // problems of a report are already listed
+			}
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("%d of %d artifacts failed verification", failed, len(c.Artifacts))
+	}
+	return nil
+}
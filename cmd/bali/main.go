@@ -1,13 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
 	"runtime"
 	"strings"
+	"syscall"
 
 	"github.com/alecthomas/kong"
+	"github.com/balibuild/bali/v3/modules/term"
 	"github.com/balibuild/bali/v3/modules/trace"
+	"github.com/balibuild/bali/v3/pkg/barrow"
 )
 
 // version info
@@ -63,15 +69,62 @@ func (v VersionFlag) BeforeApply(app *kong.Kong, vars kong.Vars) error {
 type Globals struct {
 	M       string      `name:"module" short:"M" help:"Explicitly specify a module directory" default:"." type:"path"`
 	B       string      `name:"build" short:"B" help:"Explicitly specify a build directory" default:"build" type:"path"`
-	Verbose bool        `name:"verbose" short:"V" help:"Make the operation more talkative"`
+	Verbose int         `name:"verbose" short:"V" help:"Make the operation more talkative, repeat for more details (-VV)" type:"counter"`
+	Color   string      `name:"color" help:"Colorize the output: auto, always or never" enum:"auto,always,never" default:"auto"`
+	LogFile string      `name:"log-file" help:"Append a JSON log of every level to the file" type:"path"`
 	Version VersionFlag `name:"version" short:"v" help:"Print version information and quit"`
+	logFile *slog.Logger
+}
+
+func (g *Globals) console() *barrow.ConsoleLogger {
+	return &barrow.ConsoleLogger{
+		Stdout:      os.Stdout,
+		Stderr:      os.Stderr,
+		StdoutLevel: term.StdoutLevel,
+		StderrLevel: term.StderrLevel,
+		Level:       trace.VerbosityLevel(g.Verbose),
+	}
+}
+
+// withLogFile records the build events in --log-file as well
+func (g *Globals) withLogFile(l barrow.Logger) barrow.Logger {
+	if len(g.LogFile) == 0 {
+		return l
+	}
+	return barrow.MultiLogger{l, &barrow.SlogLogger{Logger: g.logFile}}
+}
+
+// logger prints the build events on the console
+func (g *Globals) logger() barrow.Logger {
+	return g.withLogFile(g.console())
+}
+
+// progressLogger draws a live progress view on an interactive color terminal,
+// plain console lines when colors are off or the output is piped. Call the returned function after the build
+func (g *Globals) progressLogger() (barrow.Logger, func()) {
+	console := g.console()
+	if term.StdoutLevel == term.LevelNone || term.StderrLevel == term.LevelNone || !term.IsTerminal(os.Stderr.Fd()) {
+		return g.withLogFile(console), func() {}
+	}
+	v := barrow.NewProgressLogger(console, os.Stderr, term.StderrLevel)
+	return g.withLogFile(v), v.Close
+}
+
+// printError reports a failure once, with a hint when pkg/barrow knows how to fix it
+func printError(err error) {
+	slog.Error(err.Error())
+	if hint := barrow.Suggestion(err); len(hint) != 0 {
+		slog.Info("hint: " + hint)
+	}
 }
 
 type App struct {
 	Globals
-	Build  BuildCommand  `cmd:"build" help:"Compile the current module (default)" default:"withargs"`
-	Update UpdateCommand `cmd:"update" help:"Update dependencies as recorded in the go.mod"`
-	Clean  CleanCommand  `cmd:"clean" help:"Remove generated artifacts"`
+	Build   BuildCommand   `cmd:"build" help:"Compile the current module (default)" default:"withargs"`
+	Update  UpdateCommand  `cmd:"update" help:"Update dependencies as recorded in the go.mod"`
+	Clean   CleanCommand   `cmd:"clean" help:"Remove generated artifacts"`
+	Verify  VerifyCommand  `cmd:"verify" help:"Verify produced packages against the build metadata"`
+	Inspect InspectCommand `cmd:"inspect" help:"List the contents of produced packages"`
 }
 
 func main() {
@@ -87,12 +140,40 @@ func main() {
 		kong.Vars{
 			"target": runtime.GOOS,
 			"arch":   runtime.GOARCH,
+			"packs":  strings.Join(barrow.PackagerNames(), ", "),
 		})
-	if app.Verbose {
-		trace.EnableDebugMode()
+	// NO_COLOR and FORCE_COLOR are honored by auto
+	_ = term.SetColorMode(app.Color)
+	logFile, closeLog, err := trace.Setup(&trace.Options{
+		Verbosity: app.Verbose,
+		LogFile:   app.LogFile,
+		Console:   os.Stderr,
+		Color:     term.StderrLevel,
+	})
+	if err != nil {
+		slog.Error(err.Error())
+		os.Exit(1)
+	}
+	app.logFile = logFile
+	// SIGINT/SIGTERM cancel the build: go build and hooks are interrupted, partial artifacts and .syso files removed
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCtx.Done()
+		stop() // a second signal terminates immediately
+	}()
+	ctx.BindTo(sigCtx, (*context.Context)(nil))
+	err = ctx.Run(&app.Globals)
+	interrupted := sigCtx.Err() != nil // stop cancels sigCtx too, check before it
+	stop()
+	if interrupted {
+		slog.Error("interrupted")
+		_ = closeLog()
+		os.Exit(130)
 	}
-	err := ctx.Run(&app.Globals)
 	if err != nil {
+		printError(err)
+		_ = closeLog()
 		os.Exit(1)
 	}
+	_ = closeLog()
 }
@@ -0,0 +1,204 @@
+// Package cab writes Microsoft Cabinet files with a single MSZIP compressed folder,
+// as embedded in Windows Installer packages.
+//
+// https://learn.microsoft.com/en-us/previous-versions/bb417343(v=msdn.10)
+package cab
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	blockSize       = 32 * 1024 // MSZIP uncompressed block size
+	headerSize      = 36
+	folderSize      = 8
+	fileFixedSize   = 16
+	dataHeaderSize  = 8
+	typeCompressZip = 1
+	attribArchive   = 0x20
+	attribNameUTF   = 0x80
+	maxFiles        = 0xFFFF
+)
+
+var (
+	ErrTooManyFiles = errors.New("cab: too many files")
+)
+
+type file struct {
+	name    string
+	size    uint32
+	offset  uint32 // uncompressed offset in folder
+	modTime time.Time
+}
+
+// Writer compresses files into a spool, WriteTo assembles the cabinet
+type Writer struct {
+	spool    io.ReadWriteSeeker
+	level    int
+	files    []*file
+	block    []byte // pending uncompressed data
+	prev     []byte // previous block, MSZIP history
+	blocks   int
+	spooled  int64
+	folderSz uint32
+	buf      bytes.Buffer
+}
+
+// NewWriter: compressed data blocks are written to spool (usually a temp file)
+func NewWriter(spool io.ReadWriteSeeker, level int) *Writer {
+	return &Writer{spool: spool, level: level, block: make([]byte, 0, blockSize)}
+}
+
+// AddFile appends a file to the cabinet folder
+func (w *Writer) AddFile(name string, modTime time.Time, r io.Reader) error {
+	if len(w.files) >= maxFiles {
+		return ErrTooManyFiles
+	}
+	f := &file{name: name, offset: w.folderSz, modTime: modTime}
+	var size int64
+	for {
+		n, err := r.Read(w.block[len(w.block):blockSize])
+		w.block = w.block[:len(w.block)+n]
+		size += int64(n)
+		if len(w.block) == blockSize {
+			if err := w.flushBlock(); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if int64(w.folderSz)+size > 0x7FFF8000 {
+		return fmt.Errorf("cab: folder too large")
+	}
+	f.size = uint32(size)
+	w.folderSz += uint32(size)
+	w.files = append(w.files, f)
+	return nil
+}
+
+// flushBlock compresses the pending block: 'CK' + a complete deflate stream using the previous block as dictionary
+func (w *Writer) flushBlock() error {
+	if len(w.block) == 0 {
+		return nil
+	}
+	w.buf.Reset()
+	w.buf.WriteString("CK")
+	fw, err := flate.NewWriterDict(&w.buf, w.level, w.prev)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(w.block); err != nil {
+		return err
+	}
+	if err := fw.Close(); err != nil {
+		return err
+	}
+	if w.blocks == 0xFFFF {
+		return fmt.Errorf("cab: too many data blocks")
+	}
+	var hdr [dataHeaderSize]byte
+	binary.LittleEndian.PutUint32(hdr[0:], 0) // checksum not computed
+	binary.LittleEndian.PutUint16(hdr[4:], uint16(w.buf.Len()))
+	binary.LittleEndian.PutUint16(hdr[6:], uint16(len(w.block)))
+	if _, err := w.spool.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := w.spool.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+	w.spooled += int64(dataHeaderSize + w.buf.Len())
+	w.blocks++
+	w.prev = append(w.prev[:0], w.block...)
+	w.block = w.block[:0]
+	return nil
+}
+
+func dosDateTime(t time.Time) (uint16, uint16) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	date := uint16((t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day())
+	tm := uint16(t.Hour()<<11 | t.Minute()<<5 | t.Second()/2)
+	return date, tm
+}
+
+func isASCII(s string) bool {
+	for i := range len(s) {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTo flushes pending data and writes the complete cabinet to out
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	if err := w.flushBlock(); err != nil {
+		return 0, err
+	}
+	var entries bytes.Buffer
+	for _, f := range w.files {
+		var b [fileFixedSize]byte
+		le := binary.LittleEndian
+		le.PutUint32(b[0:], f.size)
+		le.PutUint32(b[4:], f.offset)
+		le.PutUint16(b[8:], 0) // folder index
+		date, tm := dosDateTime(f.modTime)
+		le.PutUint16(b[10:], date)
+		le.PutUint16(b[12:], tm)
+		attribs := uint16(attribArchive)
+		if !isASCII(f.name) {
+			attribs |= attribNameUTF
+		}
+		le.PutUint16(b[14:], attribs)
+		entries.Write(b[:])
+		entries.WriteString(f.name)
+		entries.WriteByte(0)
+	}
+	coffFiles := uint32(headerSize + folderSize)
+	coffCabStart := coffFiles + uint32(entries.Len())
+	total := int64(coffCabStart) + w.spooled
+	if total > 0xFFFFFFFF {
+		return 0, fmt.Errorf("cab: cabinet too large")
+	}
+	var hdr [headerSize + folderSize]byte
+	le := binary.LittleEndian
+	copy(hdr[0:], "MSCF")
+	le.PutUint32(hdr[8:], uint32(total))
+	le.PutUint32(hdr[16:], coffFiles)
+	hdr[24] = 3 // version minor
+	hdr[25] = 1 // version major
+	le.PutUint16(hdr[26:], 1)
+	le.PutUint16(hdr[28:], uint16(len(w.files)))
+	// CFFOLDER
+	le.PutUint32(hdr[36:], coffCabStart)
+	le.PutUint16(hdr[40:], uint16(w.blocks))
+	le.PutUint16(hdr[42:], typeCompressZip)
+	var written int64
+	n, err := out.Write(hdr[:])
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+	n, err = out.Write(entries.Bytes())
+	written += int64(n)
+	if err != nil {
+		return written, err
+	}
+	if _, err := w.spool.Seek(0, io.SeekStart); err != nil {
+		return written, err
+	}
+	copied, err := io.CopyN(out, w.spool, w.spooled)
+	return written + copied, err
+}
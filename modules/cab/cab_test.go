@@ -0,0 +1,110 @@
+package cab
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"os"
+	"testing"
+	"time"
+)
+
+type extracted struct {
+	name string
+	data []byte
+}
+
+// extract: minimal single folder MSZIP reader
+func extract(t *testing.T, cab []byte) []extracted {
+	t.Helper()
+	le := binary.LittleEndian
+	if string(cab[:4]) != "MSCF" {
+		t.Fatal("bad signature")
+	}
+	if int(le.Uint32(cab[8:])) != len(cab) {
+		t.Fatalf("cbCabinet %d != %d", le.Uint32(cab[8:]), len(cab))
+	}
+	coffFiles := le.Uint32(cab[16:])
+	nfiles := int(le.Uint16(cab[28:]))
+	coffCabStart := le.Uint32(cab[36:])
+	nblocks := int(le.Uint16(cab[40:]))
+	if le.Uint16(cab[42:]) != typeCompressZip {
+		t.Fatal("not MSZIP")
+	}
+	var folder bytes.Buffer
+	var history []byte
+	p := cab[coffCabStart:]
+	for range nblocks {
+		cb := le.Uint16(p[4:])
+		uncomp := le.Uint16(p[6:])
+		data := p[dataHeaderSize : dataHeaderSize+int(cb)]
+		if string(data[:2]) != "CK" {
+			t.Fatal("bad MSZIP block signature")
+		}
+		block, err := io.ReadAll(flate.NewReaderDict(bytes.NewReader(data[2:]), history))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(block) != int(uncomp) {
+			t.Fatalf("block size %d != %d", len(block), uncomp)
+		}
+		folder.Write(block)
+		history = block
+		p = p[dataHeaderSize+int(cb):]
+	}
+	files := make([]extracted, 0, nfiles)
+	p = cab[coffFiles:]
+	for range nfiles {
+		size := le.Uint32(p[0:])
+		offset := le.Uint32(p[4:])
+		end := bytes.IndexByte(p[fileFixedSize:], 0)
+		name := string(p[fileFixedSize : fileFixedSize+end])
+		files = append(files, extracted{name: name, data: folder.Bytes()[offset : offset+size]})
+		p = p[fileFixedSize+end+1:]
+	}
+	return files
+}
+
+func TestWriter(t *testing.T) {
+	spool, err := os.CreateTemp(t.TempDir(), "spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	random := make([]byte, 100*1024+7)
+	rng := rand.New(rand.NewPCG(1, 2))
+	for i := range random {
+		random[i] = byte(rng.Uint32())
+	}
+	inputs := []extracted{
+		{name: "empty", data: nil},
+		{name: "text", data: bytes.Repeat([]byte("Bali - Minimalist Golang build and packaging tool\n"), 3000)},
+		{name: "random", data: random},
+		{name: "small", data: []byte("jack")},
+	}
+	w := NewWriter(spool, flate.BestCompression)
+	for _, in := range inputs {
+		if err := w.AddFile(in.name, time.Now(), bytes.NewReader(in.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	n, err := w.WriteTo(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(out.Len()) {
+		t.Fatalf("WriteTo returned %d, wrote %d", n, out.Len())
+	}
+	files := extract(t, out.Bytes())
+	if len(files) != len(inputs) {
+		t.Fatalf("expected %d files, got %d", len(inputs), len(files))
+	}
+	for i, f := range files {
+		if f.name != inputs[i].name || !bytes.Equal(f.data, inputs[i].data) {
+			t.Fatalf("file %s mismatch", inputs[i].name)
+		}
+	}
+}
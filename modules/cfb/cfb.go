@@ -0,0 +1,147 @@
+// Package cfb implements the Compound File Binary format (MS-CFB) version 3 (512 byte sectors),
+// the container used by Windows Installer databases.
+//
+// Only a flat root storage with streams is supported, which is all MSI needs.
+package cfb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	sectorSize       = 512
+	miniSectorSize   = 64
+	miniStreamCutoff = 4096
+	dirEntrySize     = 128
+	headerDIFATCount = 109
+
+	// special sector numbers
+	maxRegSect = 0xFFFFFFFA
+	difSect    = 0xFFFFFFFC
+	fatSect    = 0xFFFFFFFD
+	endOfChain = 0xFFFFFFFE
+	freeSect   = 0xFFFFFFFF
+	noStream   = 0xFFFFFFFF
+
+	// directory object types
+	typeStream  = 2
+	typeRoot    = 5
+	colorRed    = 0
+	colorBlack  = 1
+	maxNameSize = 31 // UTF-16 code units, without the terminating null
+)
+
+var (
+	signature = []byte{0xD0, 0xCF, 0x11, 0xE0, 0xA1, 0xB1, 0x1A, 0xE1}
+)
+
+var (
+	ErrNotCompoundFile = errors.New("cfb: not a compound file")
+	ErrCorrupt         = errors.New("cfb: corrupt compound file")
+)
+
+// CLSID: a COM class id in its on-disk (mixed endian) layout
+type CLSID [16]byte
+
+// ParseCLSID parses {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}
+func ParseCLSID(s string) (CLSID, error) {
+	var c CLSID
+	s = strings.Trim(s, "{}")
+	raw := strings.ReplaceAll(s, "-", "")
+	if len(raw) != 32 || len(s) != 36 {
+		return c, fmt.Errorf("cfb: bad clsid '%s'", s)
+	}
+	var b [16]byte
+	for i := range 16 {
+		var v byte
+		if _, err := fmt.Sscanf(raw[i*2:i*2+2], "%02x", &v); err != nil {
+			return c, fmt.Errorf("cfb: bad clsid '%s'", s)
+		}
+		b[i] = v
+	}
+	// Data1, Data2, Data3 are little endian
+	c[0], c[1], c[2], c[3] = b[3], b[2], b[1], b[0]
+	c[4], c[5] = b[5], b[4]
+	c[6], c[7] = b[7], b[6]
+	copy(c[8:], b[8:])
+	return c, nil
+}
+
+// compareNames: directory entries are ordered by length first, then by upper-cased code units
+func compareNames(a, b []uint16) int {
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+	for i := range a {
+		x, y := upper(a[i]), upper(b[i])
+		if x != y {
+			return int(x) - int(y)
+		}
+	}
+	return 0
+}
+
+func upper(c uint16) uint16 {
+	if c >= 'a' && c <= 'z' {
+		return c - 'a' + 'A'
+	}
+	return c
+}
+
+func encodeName(name string) ([]uint16, error) {
+	u := utf16.Encode([]rune(name))
+	if len(u) == 0 || len(u) > maxNameSize {
+		return nil, fmt.Errorf("cfb: bad stream name length %d", len(u))
+	}
+	for _, c := range u {
+		switch c {
+		case '/', '\\', ':', '!':
+			return nil, fmt.Errorf("cfb: illegal character %q in stream name", rune(c))
+		}
+	}
+	return u, nil
+}
+
+func decodeName(u []uint16) []rune {
+	return utf16.Decode(u)
+}
+
+func sectors(size int64, unit int64) int64 {
+	return (size + unit - 1) / unit
+}
+
+type header struct {
+	numFATSectors      uint32
+	firstDirSector     uint32
+	firstMiniFATSector uint32
+	numMiniFATSectors  uint32
+	firstDIFATSector   uint32
+	numDIFATSectors    uint32
+	difat              [headerDIFATCount]uint32
+}
+
+func (h *header) marshal() []byte {
+	b := make([]byte, sectorSize)
+	copy(b, signature)
+	le := binary.LittleEndian
+	le.PutUint16(b[24:], 0x003E) // minor version
+	le.PutUint16(b[26:], 0x0003) // major version
+	le.PutUint16(b[28:], 0xFFFE) // byte order
+	le.PutUint16(b[30:], 9)      // sector shift
+	le.PutUint16(b[32:], 6)      // mini sector shift
+	le.PutUint32(b[44:], h.numFATSectors)
+	le.PutUint32(b[48:], h.firstDirSector)
+	le.PutUint32(b[56:], miniStreamCutoff)
+	le.PutUint32(b[60:], h.firstMiniFATSector)
+	le.PutUint32(b[64:], h.numMiniFATSectors)
+	le.PutUint32(b[68:], h.firstDIFATSector)
+	le.PutUint32(b[72:], h.numDIFATSectors)
+	for i, s := range h.difat {
+		le.PutUint32(b[76+i*4:], s)
+	}
+	return b
+}
@@ -0,0 +1,61 @@
+package cfb
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	clsid, err := ParseCLSID("{000C1084-0000-0000-C000-000000000046}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter()
+	w.SetCLSID(clsid)
+	streams := map[string][]byte{
+		"empty":                  {},
+		"\x05SummaryInformation": []byte("summary"),
+		"large":                  bytes.Repeat([]byte("0123456789abcdef"), 4096),
+		"䡀㽿":                     bytes.Repeat([]byte{0x42}, 4095),
+	}
+	// enough streams and FAT sectors to exercise DIFAT and multiple directory sectors
+	for i := range 40 {
+		streams[fmt.Sprintf("s%02d", i)] = bytes.Repeat([]byte{byte(i)}, i*97)
+	}
+	streams["huge"] = bytes.Repeat([]byte("bali"), 2*1024*1024) // 8 MiB > 109 FAT sectors
+	for name, data := range streams {
+		if err := w.Create(name, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Create("LARGE", nil); err == nil {
+		t.Fatal("expected duplicate name error")
+	}
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len()%sectorSize != 0 {
+		t.Fatalf("file size %d is not sector aligned", buf.Len())
+	}
+	r, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CLSID != clsid {
+		t.Fatalf("clsid mismatch")
+	}
+	if len(r.Entries) != len(streams) {
+		t.Fatalf("expected %d streams, got %d", len(streams), len(r.Entries))
+	}
+	for name, data := range streams {
+		got, err := r.ReadStream(name)
+		if err != nil {
+			t.Fatalf("read %q error: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("stream %q mismatch", name)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package cfb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// Entry: a stream in the compound file
+type Entry struct {
+	Name  string
+	Size  int64
+	start uint32
+}
+
+// Reader reads streams from a compound file
+type Reader struct {
+	r          io.ReaderAt
+	sectorSize int64
+	fat        []uint32
+	miniFAT    []uint32
+	mini       []byte // mini stream
+	CLSID      CLSID
+	Entries    []*Entry
+}
+
+func (r *Reader) readSector(sector uint32) ([]byte, error) {
+	b := make([]byte, r.sectorSize)
+	if _, err := r.r.ReadAt(b, (int64(sector)+1)*r.sectorSize); err != nil {
+		return nil, fmt.Errorf("cfb: read sector %d: %w", sector, err)
+	}
+	return b, nil
+}
+
+// readChain reads a sector chain from the FAT
+func (r *Reader) readChain(start uint32, limit int64) ([]byte, error) {
+	var out bytes.Buffer
+	for s := start; s != endOfChain; {
+		if s > maxRegSect || int(s) >= len(r.fat) || int64(out.Len()) > limit {
+			return nil, ErrCorrupt
+		}
+		b, err := r.readSector(s)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(b)
+		s = r.fat[s]
+	}
+	return out.Bytes(), nil
+}
+
+func uint32s(b []byte) []uint32 {
+	values := make([]uint32, len(b)/4)
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint32(b[i*4:])
+	}
+	return values
+}
+
+// NewReader parses the header, allocation tables and directory of a compound file
+func NewReader(ra io.ReaderAt, size int64) (*Reader, error) {
+	hdr := make([]byte, sectorSize)
+	if _, err := ra.ReadAt(hdr, 0); err != nil {
+		return nil, ErrNotCompoundFile
+	}
+	if !bytes.Equal(hdr[:8], signature) {
+		return nil, ErrNotCompoundFile
+	}
+	le := binary.LittleEndian
+	shift := le.Uint16(hdr[30:])
+	if shift != 9 && shift != 12 {
+		return nil, ErrCorrupt
+	}
+	r := &Reader{r: ra, sectorSize: 1 << shift}
+	numFAT := le.Uint32(hdr[44:])
+	firstDir := le.Uint32(hdr[48:])
+	firstMiniFAT := le.Uint32(hdr[60:])
+	firstDIFAT := le.Uint32(hdr[68:])
+	maxSectors := size/r.sectorSize + 1
+	if int64(numFAT) > maxSectors {
+		return nil, ErrCorrupt
+	}
+	fatSectors := make([]uint32, 0, numFAT)
+	for i := range headerDIFATCount {
+		if uint32(len(fatSectors)) == numFAT {
+			break
+		}
+		fatSectors = append(fatSectors, le.Uint32(hdr[76+i*4:]))
+	}
+	for s := firstDIFAT; s != endOfChain && s != freeSect && uint32(len(fatSectors)) < numFAT; {
+		b, err := r.readSector(s)
+		if err != nil {
+			return nil, err
+		}
+		values := uint32s(b)
+		for _, v := range values[:len(values)-1] {
+			if uint32(len(fatSectors)) < numFAT {
+				fatSectors = append(fatSectors, v)
+			}
+		}
+		s = values[len(values)-1]
+	}
+	for _, s := range fatSectors {
+		b, err := r.readSector(s)
+		if err != nil {
+			return nil, err
+		}
+		r.fat = append(r.fat, uint32s(b)...)
+	}
+	if firstMiniFAT != endOfChain {
+		b, err := r.readChain(firstMiniFAT, size)
+		if err != nil {
+			return nil, err
+		}
+		r.miniFAT = uint32s(b)
+	}
+	dir, err := r.readChain(firstDir, size)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+dirEntrySize <= len(dir); i += dirEntrySize {
+		e := dir[i : i+dirEntrySize]
+		nameLen := int(le.Uint16(e[64:]))
+		if nameLen < 2 || nameLen > 64 {
+			continue
+		}
+		name := make([]uint16, nameLen/2-1)
+		for j := range name {
+			name[j] = le.Uint16(e[j*2:])
+		}
+		start := le.Uint32(e[116:])
+		streamSize := int64(le.Uint64(e[120:]))
+		if shift == 9 {
+			streamSize &= 0xFFFFFFFF
+		}
+		switch e[66] {
+		case typeRoot:
+			copy(r.CLSID[:], e[80:96])
+			if start != endOfChain {
+				if r.mini, err = r.readChain(start, size); err != nil {
+					return nil, err
+				}
+			}
+		case typeStream:
+			r.Entries = append(r.Entries, &Entry{Name: string(utf16.Decode(name)), Size: streamSize, start: start})
+		}
+	}
+	return r, nil
+}
+
+// ReadStream returns the contents of the named stream
+func (r *Reader) ReadStream(name string) ([]byte, error) {
+	for _, e := range r.Entries {
+		if e.Name == name {
+			return r.readEntry(e)
+		}
+	}
+	return nil, fmt.Errorf("cfb: stream '%s' not found", name)
+}
+
+func (r *Reader) readEntry(e *Entry) ([]byte, error) {
+	if e.Size >= miniStreamCutoff {
+		b, err := r.readChain(e.start, e.Size)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(b)) < e.Size {
+			return nil, ErrCorrupt
+		}
+		return b[:e.Size], nil
+	}
+	out := make([]byte, 0, e.Size)
+	for s := e.start; s != endOfChain && int64(len(out)) < e.Size; {
+		off := int64(s) * miniSectorSize
+		if int(s) >= len(r.miniFAT) || off+miniSectorSize > int64(len(r.mini)) {
+			return nil, ErrCorrupt
+		}
+		out = append(out, r.mini[off:off+miniSectorSize]...)
+		s = r.miniFAT[s]
+	}
+	if int64(len(out)) < e.Size {
+		return nil, ErrCorrupt
+	}
+	return out[:e.Size], nil
+}
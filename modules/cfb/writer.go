@@ -0,0 +1,380 @@
+package cfb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+)
+
+type stream struct {
+	name  []uint16
+	size  int64
+	data  []byte    // stored in the mini stream
+	r     io.Reader // large stream, read while writing
+	start uint32
+	// red-black tree
+	left, right uint32
+	color       byte
+}
+
+// Writer creates a compound file with streams under the root storage
+type Writer struct {
+	clsid   CLSID
+	streams []*stream
+}
+
+func NewWriter() *Writer {
+	return &Writer{}
+}
+
+// SetCLSID sets the class id of the root storage
+func (w *Writer) SetCLSID(clsid CLSID) {
+	w.clsid = clsid
+}
+
+func (w *Writer) add(s *stream) error {
+	for _, o := range w.streams {
+		if compareNames(o.name, s.name) == 0 {
+			return fmt.Errorf("cfb: duplicate stream name '%s'", string(decodeName(s.name)))
+		}
+	}
+	w.streams = append(w.streams, s)
+	return nil
+}
+
+// Create adds a stream with the contents of data
+func (w *Writer) Create(name string, data []byte) error {
+	u, err := encodeName(name)
+	if err != nil {
+		return err
+	}
+	s := &stream{name: u, size: int64(len(data))}
+	if s.size < miniStreamCutoff {
+		s.data = data
+	} else {
+		s.r = bytes.NewReader(data)
+	}
+	return w.add(s)
+}
+
+// CreateFrom adds a stream of size bytes, r is read when the compound file is written
+func (w *Writer) CreateFrom(name string, r io.Reader, size int64) error {
+	u, err := encodeName(name)
+	if err != nil {
+		return err
+	}
+	if size > 0xFFFFFFFF {
+		return fmt.Errorf("cfb: stream '%s' too large for version 3", name)
+	}
+	s := &stream{name: u, size: size}
+	if size < miniStreamCutoff {
+		s.data = make([]byte, size)
+		if _, err := io.ReadFull(r, s.data); err != nil {
+			return err
+		}
+	} else {
+		s.r = r
+	}
+	return w.add(s)
+}
+
+// buildTree builds a balanced binary search tree over sorted entries and returns the root id,
+// nodes on the deepest level are red, which keeps the black height equal on every path
+func buildTree(entries []*stream, ids []uint32, lo, hi, depth int, depths []int) uint32 {
+	if lo >= hi {
+		return noStream
+	}
+	mid := (lo + hi) / 2
+	depths[mid] = depth
+	entries[mid].left = buildTree(entries, ids, lo, mid, depth+1, depths)
+	entries[mid].right = buildTree(entries, ids, mid+1, hi, depth+1, depths)
+	return ids[mid]
+}
+
+type layout struct {
+	h           header
+	fat         []uint32
+	miniFAT     []uint32
+	miniSize    int64
+	miniStart   uint32
+	dirSectors  int64
+	difatSector []uint32
+}
+
+func chain(fat []uint32, start uint32, n int64) {
+	for i := range n {
+		s := start + uint32(i)
+		if i == n-1 {
+			fat[s] = endOfChain
+		} else {
+			fat[s] = s + 1
+		}
+	}
+}
+
+func (w *Writer) layout() (*layout, error) {
+	l := &layout{}
+	var large, mini []*stream
+	for _, s := range w.streams {
+		if s.size < miniStreamCutoff {
+			mini = append(mini, s)
+			continue
+		}
+		large = append(large, s)
+	}
+	var largeSectors, miniSectors int64
+	for _, s := range large {
+		largeSectors += sectors(s.size, sectorSize)
+	}
+	for _, s := range mini {
+		miniSectors += sectors(s.size, miniSectorSize)
+	}
+	l.miniSize = miniSectors * miniSectorSize
+	numMiniStream := sectors(l.miniSize, sectorSize)
+	numMiniFAT := sectors(miniSectors*4, sectorSize)
+	l.dirSectors = sectors(int64(len(w.streams)+1)*dirEntrySize, sectorSize)
+	base := largeSectors + numMiniStream + numMiniFAT + l.dirSectors
+	var numFAT, numDIFAT int64
+	for {
+		total := base + numFAT + numDIFAT
+		needFAT := sectors(total, sectorSize/4)
+		needDIFAT := int64(0)
+		if needFAT > headerDIFATCount {
+			needDIFAT = sectors(needFAT-headerDIFATCount, sectorSize/4-1)
+		}
+		if needFAT == numFAT && needDIFAT == numDIFAT {
+			break
+		}
+		numFAT, numDIFAT = needFAT, needDIFAT
+	}
+	total := base + numFAT + numDIFAT
+	if total > maxRegSect {
+		return nil, fmt.Errorf("cfb: compound file too large")
+	}
+	l.fat = make([]uint32, numFAT*sectorSize/4)
+	for i := range l.fat {
+		l.fat[i] = freeSect
+	}
+	var cur uint32
+	for _, s := range large {
+		n := sectors(s.size, sectorSize)
+		s.start = cur
+		chain(l.fat, cur, n)
+		cur += uint32(n)
+	}
+	l.miniStart = endOfChain
+	if numMiniStream > 0 {
+		l.miniStart = cur
+		chain(l.fat, cur, numMiniStream)
+		cur += uint32(numMiniStream)
+	}
+	l.h.firstMiniFATSector = endOfChain
+	if numMiniFAT > 0 {
+		l.h.firstMiniFATSector = cur
+		l.h.numMiniFATSectors = uint32(numMiniFAT)
+		chain(l.fat, cur, numMiniFAT)
+		cur += uint32(numMiniFAT)
+	}
+	l.h.firstDirSector = cur
+	chain(l.fat, cur, l.dirSectors)
+	cur += uint32(l.dirSectors)
+	l.h.numFATSectors = uint32(numFAT)
+	fatSectors := make([]uint32, 0, numFAT)
+	for range numFAT {
+		l.fat[cur] = fatSect
+		fatSectors = append(fatSectors, cur)
+		cur++
+	}
+	l.h.firstDIFATSector = endOfChain
+	if numDIFAT > 0 {
+		l.h.firstDIFATSector = cur
+		l.h.numDIFATSectors = uint32(numDIFAT)
+	}
+	for range numDIFAT {
+		l.fat[cur] = difSect
+		l.difatSector = append(l.difatSector, cur)
+		cur++
+	}
+	for i := range l.h.difat {
+		l.h.difat[i] = freeSect
+		if i < len(fatSectors) {
+			l.h.difat[i] = fatSectors[i]
+		}
+	}
+	// DIFAT sectors: 127 FAT sector numbers and the next DIFAT sector
+	if numDIFAT > 0 {
+		rest := fatSectors[headerDIFATCount:]
+		difat := make([]uint32, 0, numDIFAT*sectorSize/4)
+		for i := range numDIFAT {
+			for j := range int64(sectorSize/4 - 1) {
+				k := i*(sectorSize/4-1) + j
+				if k < int64(len(rest)) {
+					difat = append(difat, rest[k])
+				} else {
+					difat = append(difat, freeSect)
+				}
+			}
+			if i == numDIFAT-1 {
+				difat = append(difat, endOfChain)
+			} else {
+				difat = append(difat, l.difatSector[i+1])
+			}
+		}
+		l.difatSector = difat
+	}
+	// mini FAT
+	l.miniFAT = make([]uint32, numMiniFAT*sectorSize/4)
+	for i := range l.miniFAT {
+		l.miniFAT[i] = freeSect
+	}
+	var miniCur uint32
+	for _, s := range mini {
+		n := sectors(s.size, miniSectorSize)
+		if n == 0 {
+			s.start = endOfChain
+			continue
+		}
+		s.start = miniCur
+		chain(l.miniFAT, miniCur, n)
+		miniCur += uint32(n)
+	}
+	return l, nil
+}
+
+func putDirEntry(b []byte, name []uint16, typ byte, color byte, left, right, child uint32, clsid *CLSID, start uint32, size int64) {
+	le := binary.LittleEndian
+	for i, c := range name {
+		le.PutUint16(b[i*2:], c)
+	}
+	if len(name) != 0 {
+		le.PutUint16(b[64:], uint16((len(name)+1)*2))
+	}
+	b[66] = typ
+	b[67] = color
+	le.PutUint32(b[68:], left)
+	le.PutUint32(b[72:], right)
+	le.PutUint32(b[76:], child)
+	if clsid != nil {
+		copy(b[80:96], clsid[:])
+	}
+	le.PutUint32(b[116:], start)
+	le.PutUint64(b[120:], uint64(size))
+}
+
+func (w *Writer) directory(l *layout) []byte {
+	sorted := slices.Clone(w.streams)
+	slices.SortFunc(sorted, func(a, b *stream) int {
+		return compareNames(a.name, b.name)
+	})
+	ids := make([]uint32, len(sorted))
+	for i := range sorted {
+		ids[i] = uint32(i + 1)
+	}
+	depths := make([]int, len(sorted))
+	rootChild := buildTree(sorted, ids, 0, len(sorted), 0, depths)
+	maxDepth := 0
+	for _, d := range depths {
+		maxDepth = max(maxDepth, d)
+	}
+	for i, s := range sorted {
+		s.color = colorBlack
+		if maxDepth > 0 && depths[i] == maxDepth {
+			s.color = colorRed
+		}
+	}
+	b := make([]byte, l.dirSectors*sectorSize)
+	putDirEntry(b, utf16Root, typeRoot, colorBlack, noStream, noStream, rootChild, &w.clsid, l.miniStart, l.miniSize)
+	for i, s := range sorted {
+		putDirEntry(b[(i+1)*dirEntrySize:], s.name, typeStream, s.color, s.left, s.right, noStream, nil, s.start, s.size)
+	}
+	for i := len(sorted) + 1; i < len(b)/dirEntrySize; i++ {
+		putDirEntry(b[i*dirEntrySize:], nil, 0, colorRed, noStream, noStream, noStream, nil, 0, 0)
+	}
+	return b
+}
+
+var (
+	utf16Root = []uint16{'R', 'o', 'o', 't', ' ', 'E', 'n', 't', 'r', 'y'}
+)
+
+func writeUint32s(w io.Writer, values []uint32) error {
+	b := make([]byte, len(values)*4)
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(b[i*4:], v)
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+func pad(w io.Writer, n int64, unit int64) error {
+	if r := n % unit; r != 0 {
+		_, err := w.Write(make([]byte, unit-r))
+		return err
+	}
+	return nil
+}
+
+// WriteTo writes the compound file, large streams are copied from their readers
+func (w *Writer) WriteTo(out io.Writer) (int64, error) {
+	l, err := w.layout()
+	if err != nil {
+		return 0, err
+	}
+	cw := &countWriter{w: bufio.NewWriterSize(out, 64*1024)}
+	if _, err := cw.Write(l.h.marshal()); err != nil {
+		return cw.n, err
+	}
+	var mini []*stream
+	for _, s := range w.streams {
+		if s.size < miniStreamCutoff {
+			mini = append(mini, s)
+			continue
+		}
+		n, err := io.CopyN(cw, s.r, s.size)
+		if err != nil {
+			return cw.n, fmt.Errorf("cfb: write stream '%s' error: %w", string(decodeName(s.name)), err)
+		}
+		if err := pad(cw, n, sectorSize); err != nil {
+			return cw.n, err
+		}
+	}
+	// same order as layout
+	for _, s := range mini {
+		if _, err := cw.Write(s.data); err != nil {
+			return cw.n, err
+		}
+		if err := pad(cw, s.size, miniSectorSize); err != nil {
+			return cw.n, err
+		}
+	}
+	if err := pad(cw, l.miniSize, sectorSize); err != nil {
+		return cw.n, err
+	}
+	if err := writeUint32s(cw, l.miniFAT); err != nil {
+		return cw.n, err
+	}
+	if _, err := cw.Write(w.directory(l)); err != nil {
+		return cw.n, err
+	}
+	if err := writeUint32s(cw, l.fat); err != nil {
+		return cw.n, err
+	}
+	if err := writeUint32s(cw, l.difatSector); err != nil {
+		return cw.n, err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+type countWriter struct {
+	w *bufio.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -5,7 +5,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -114,7 +114,7 @@ func str2Uint32(s string) uint32 {
 	}
 	u, err := strconv.ParseUint(s, 16, 32)
 	if err != nil {
-		log.Printf("Error parsing %q as uint32: %v", s, err)
+		slog.Warn("goversioninfo: invalid uint32", "value", s, "error", err)
 		return 0
 	}
 
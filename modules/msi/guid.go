@@ -0,0 +1,49 @@
+package msi
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"strings"
+)
+
+// GUID formats 16 bytes as an uppercase registry GUID {XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX}
+func GUID(b [16]byte) string {
+	return fmt.Sprintf("{%X-%X-%X-%X-%X}", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// ParseGUID accepts a GUID with or without braces
+func ParseGUID(s string) ([16]byte, error) {
+	var b [16]byte
+	raw := strings.ReplaceAll(strings.Trim(strings.TrimSpace(s), "{}"), "-", "")
+	if len(raw) != 32 {
+		return b, fmt.Errorf("msi: bad guid '%s'", s)
+	}
+	for i := range 16 {
+		if _, err := fmt.Sscanf(raw[i*2:i*2+2], "%02x", &b[i]); err != nil {
+			return b, fmt.Errorf("msi: bad guid '%s'", s)
+		}
+	}
+	return b, nil
+}
+
+// NameGUID: a name based (version 5) GUID, stable for the same namespace and name
+func NameGUID(namespace [16]byte, name string) [16]byte {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	var b [16]byte
+	copy(b[:], h.Sum(nil))
+	b[6] = (b[6] & 0x0F) | 0x50
+	b[8] = (b[8] & 0x3F) | 0x80
+	return b
+}
+
+// RandomGUID: a version 4 GUID
+func RandomGUID() [16]byte {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0F) | 0x40
+	b[8] = (b[8] & 0x3F) | 0x80
+	return b
+}
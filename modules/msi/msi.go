@@ -0,0 +1,514 @@
+// Package msi writes Windows Installer databases: tables, string pool, streams and
+// summary information stored in a compound file.
+//
+// https://learn.microsoft.com/en-us/windows/win32/msi/database-tables
+package msi
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/balibuild/bali/v3/modules/cfb"
+)
+
+const (
+	// column type bits, as stored in _Columns
+	colValid       = 0x0100
+	colLocalizable = 0x0200
+	colNonBinary   = 0x0400
+	colString      = 0x0800
+	colNullable    = 0x1000
+	colKey         = 0x2000
+
+	tableStreamPrefix = 0x4840
+
+	CodepageWestern = 1252
+	CodepageUTF8    = 65001
+)
+
+var (
+	// {000C1084-0000-0000-C000-000000000046}: installer package
+	classInstallerPackage = cfb.CLSID{0x84, 0x10, 0x0C, 0x00, 0x00, 0x00, 0x00, 0x00, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+)
+
+var (
+	ErrNullKey = errors.New("msi: primary key column cannot be null")
+)
+
+// ColumnType: integer or string column type
+type ColumnType int
+
+const (
+	Int16 ColumnType = iota
+	Int32
+	String
+)
+
+// Column describes a table column, Size is the maximum string length (0: unlimited)
+type Column struct {
+	Name        string
+	Type        ColumnType
+	Size        int
+	Key         bool
+	Nullable    bool
+	Localizable bool
+}
+
+func (c *Column) bits() uint16 {
+	var v uint16
+	switch c.Type {
+	case Int16:
+		v = colValid | colNonBinary | 2
+	case Int32:
+		v = colValid | 4
+	default:
+		v = colValid | colString | colNonBinary | uint16(c.Size&0xFF)
+	}
+	if c.Localizable {
+		v |= colLocalizable
+	}
+	if c.Nullable {
+		v |= colNullable
+	}
+	if c.Key {
+		v |= colKey
+	}
+	return v
+}
+
+func (c *Column) width() int {
+	if c.Type == Int32 {
+		return 4
+	}
+	return 2 // Int16 and string pool index
+}
+
+// I2, I4, S and L create columns in the notation of the Windows Installer SDK:
+// 16/32 bit integers, strings and localizable strings
+func I2(name string) Column {
+	return Column{Name: name, Type: Int16}
+}
+
+func I4(name string) Column {
+	return Column{Name: name, Type: Int32}
+}
+
+func S(name string, size int) Column {
+	return Column{Name: name, Type: String, Size: size}
+}
+
+func L(name string, size int) Column {
+	return Column{Name: name, Type: String, Size: size, Localizable: true}
+}
+
+// PrimaryKey marks the column as part of the primary key
+func (c Column) PrimaryKey() Column {
+	c.Key = true
+	return c
+}
+
+// AllowNull marks the column as nullable
+func (c Column) AllowNull() Column {
+	c.Nullable = true
+	return c
+}
+
+// Table: rows are []any with string, int or nil values
+type Table struct {
+	Name    string
+	Columns []Column
+	rows    [][]any
+}
+
+// Insert appends a row, values must match the column types
+func (t *Table) Insert(values ...any) error {
+	if len(values) != len(t.Columns) {
+		return fmt.Errorf("msi: table %s expects %d values, got %d", t.Name, len(t.Columns), len(values))
+	}
+	for i, v := range values {
+		c := &t.Columns[i]
+		switch x := v.(type) {
+		case nil:
+			if c.Key && !c.Nullable {
+				return fmt.Errorf("msi: table %s column %s: %w", t.Name, c.Name, ErrNullKey)
+			}
+		case int:
+			if c.Type == String {
+				return fmt.Errorf("msi: table %s column %s expects string", t.Name, c.Name)
+			}
+			if c.Type == Int16 && (x < -32767 || x > 32767) {
+				return fmt.Errorf("msi: table %s column %s value %d out of range", t.Name, c.Name, x)
+			}
+		case string:
+			if c.Type != String {
+				return fmt.Errorf("msi: table %s column %s expects integer", t.Name, c.Name)
+			}
+			if c.Size != 0 && utf8.RuneCountInString(x) > c.Size {
+				return fmt.Errorf("msi: table %s column %s value '%s' longer than %d", t.Name, c.Name, x, c.Size)
+			}
+		default:
+			return fmt.Errorf("msi: table %s column %s unsupported value type %T", t.Name, c.Name, v)
+		}
+	}
+	t.rows = append(t.rows, values)
+	return nil
+}
+
+// Rows returns the number of rows
+func (t *Table) Rows() int {
+	return len(t.rows)
+}
+
+type streamSource struct {
+	name string
+	r    io.Reader
+	size int64
+}
+
+// Database: an installer database being built in memory, binary streams are copied on write
+type Database struct {
+	Codepage int
+	Summary  *SummaryInfo
+	tables   []*Table
+	streams  []*streamSource
+}
+
+func NewDatabase() *Database {
+	return &Database{Codepage: CodepageWestern}
+}
+
+// CreateTable adds an empty table
+func (d *Database) CreateTable(name string, columns ...Column) *Table {
+	t := &Table{Name: name, Columns: columns}
+	d.tables = append(d.tables, t)
+	return t
+}
+
+// Table returns the named table or nil
+func (d *Database) Table(name string) *Table {
+	for _, t := range d.tables {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// AddStream adds a row to the _Streams table (e.g. an embedded cabinet '#name')
+func (d *Database) AddStream(name string, r io.Reader, size int64) {
+	d.streams = append(d.streams, &streamSource{name: name, r: r, size: size})
+}
+
+// stringPool: index 0 is the null string
+type stringPool struct {
+	index map[string]int
+	refs  []uint16
+	data  []string
+}
+
+func newStringPool() *stringPool {
+	return &stringPool{index: make(map[string]int), refs: []uint16{0}, data: []string{""}}
+}
+
+func (p *stringPool) ref(s string) uint32 {
+	if len(s) == 0 {
+		return 0
+	}
+	i, ok := p.index[s]
+	if !ok {
+		i = len(p.data)
+		p.index[s] = i
+		p.data = append(p.data, s)
+		p.refs = append(p.refs, 0)
+	}
+	if p.refs[i] < 0xFFFF {
+		p.refs[i]++
+	}
+	return uint32(i)
+}
+
+// encodeString converts to the database codepage
+func encodeString(s string, codepage int) ([]byte, error) {
+	if codepage == CodepageUTF8 {
+		return []byte(s), nil
+	}
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		c, ok := toWindows1252(r)
+		if !ok {
+			return nil, fmt.Errorf("msi: character %q cannot be represented in codepage %d", r, codepage)
+		}
+		b = append(b, c)
+	}
+	return b, nil
+}
+
+var (
+	cp1252High = []rune{
+		0x20AC, 0, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021, 0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0, 0x017D, 0,
+		0, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014, 0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0, 0x017E, 0x0178,
+	}
+)
+
+func toWindows1252(r rune) (byte, bool) {
+	switch {
+	case r < 0x80, r >= 0xA0 && r <= 0xFF:
+		return byte(r), true
+	}
+	for i, c := range cp1252High {
+		if c != 0 && c == r {
+			return byte(0x80 + i), true
+		}
+	}
+	return 0, false
+}
+
+// usableCodepage: Western when every string fits, otherwise UTF-8
+func (d *Database) usableCodepage(pool *stringPool) int {
+	if d.Codepage != CodepageWestern {
+		return d.Codepage
+	}
+	for _, s := range pool.data {
+		if _, err := encodeString(s, CodepageWestern); err != nil {
+			return CodepageUTF8
+		}
+	}
+	return CodepageWestern
+}
+
+// utf2mime maps characters allowed in compressed stream names
+func utf2mime(c rune) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	case c >= 'a' && c <= 'z':
+		return int(c-'a') + 36
+	case c == '.':
+		return 62
+	case c == '_':
+		return 63
+	}
+	return -1
+}
+
+// StreamName encodes a table or stream name the way Windows Installer stores it in the compound file:
+// two characters of the base64-like alphabet are packed in one UTF-16 unit
+func StreamName(name string, table bool) string {
+	out := make([]rune, 0, len(name)+1)
+	if table {
+		out = append(out, tableStreamPrefix)
+	}
+	in := []rune(name)
+	for i := 0; i < len(in); i++ {
+		ch := in[i]
+		m := utf2mime(ch)
+		if m < 0 {
+			out = append(out, ch)
+			continue
+		}
+		if i+1 < len(in) {
+			if next := utf2mime(in[i+1]); next >= 0 {
+				out = append(out, rune(0x3800+m+(next<<6)))
+				i++
+				continue
+			}
+		}
+		out = append(out, rune(0x4800+m))
+	}
+	return string(out)
+}
+
+// DecodeStreamName reverses StreamName, table reports the table stream prefix
+func DecodeStreamName(name string) (string, bool) {
+	in := []rune(name)
+	table := len(in) > 0 && in[0] == tableStreamPrefix
+	if table {
+		in = in[1:]
+	}
+	const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz._"
+	var sb strings.Builder
+	for _, c := range in {
+		switch {
+		case c >= 0x3800 && c < 0x4800:
+			c -= 0x3800
+			sb.WriteByte(alphabet[c&0x3F])
+			sb.WriteByte(alphabet[c>>6])
+		case c >= 0x4800 && c < 0x4840:
+			sb.WriteByte(alphabet[c-0x4800])
+		default:
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String(), table
+}
+
+type encodedTable struct {
+	name string
+	data []byte
+}
+
+// stored values: integers are offset so that 0 means null
+func storedInt(v any, c *Column) uint32 {
+	i, ok := v.(int)
+	if !ok {
+		return 0
+	}
+	if c.Type == Int16 {
+		return uint32(uint16(int16(i)) ^ 0x8000)
+	}
+	return uint32(int32(i)) ^ 0x80000000
+}
+
+func (t *Table) encode(pool *stringPool) (*encodedTable, error) {
+	stored := make([][]uint32, len(t.rows))
+	for i, row := range t.rows {
+		values := make([]uint32, len(row))
+		for j, v := range row {
+			c := &t.Columns[j]
+			if c.Type == String {
+				s, _ := v.(string)
+				values[j] = pool.ref(s)
+				continue
+			}
+			values[j] = storedInt(v, c)
+		}
+		stored[i] = values
+	}
+	// rows are kept sorted by primary key
+	slices.SortStableFunc(stored, func(a, b []uint32) int {
+		for j := range t.Columns {
+			if !t.Columns[j].Key {
+				continue
+			}
+			if n := cmp.Compare(a[j], b[j]); n != 0 {
+				return n
+			}
+		}
+		return 0
+	})
+	for i := 1; i < len(stored); i++ {
+		same := true
+		for j := range t.Columns {
+			if t.Columns[j].Key && stored[i][j] != stored[i-1][j] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return nil, fmt.Errorf("msi: table %s has duplicate primary key", t.Name)
+		}
+	}
+	return &encodedTable{name: t.Name, data: columnMajor(t.Columns, stored)}, nil
+}
+
+// columnMajor: table streams store all values of the first column, then the second ...
+func columnMajor(columns []Column, rows [][]uint32) []byte {
+	var buf bytes.Buffer
+	for j := range columns {
+		w := columns[j].width()
+		for _, row := range rows {
+			switch w {
+			case 4:
+				_ = binary.Write(&buf, binary.LittleEndian, row[j])
+			default:
+				_ = binary.Write(&buf, binary.LittleEndian, uint16(row[j]))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+var (
+	columnsColumns = []Column{S("Table", 64).PrimaryKey(), I2("Number").PrimaryKey(), S("Name", 64), I2("Type")}
+	tablesColumns  = []Column{S("Name", 64).PrimaryKey()}
+)
+
+// WriteTo writes the database as a compound file
+func (d *Database) WriteTo(out io.Writer) (int64, error) {
+	pool := newStringPool()
+	encoded := make([]*encodedTable, 0, len(d.tables)+2)
+	tables := make([][]uint32, 0, len(d.tables))
+	columns := make([][]uint32, 0, len(d.tables)*8)
+	for _, t := range d.tables {
+		tables = append(tables, []uint32{pool.ref(t.Name)})
+		for i := range t.Columns {
+			c := &t.Columns[i]
+			columns = append(columns, []uint32{
+				pool.ref(t.Name),
+				storedInt(i+1, &Column{Type: Int16}),
+				pool.ref(c.Name),
+				storedInt(int(int16(c.bits())), &Column{Type: Int16}),
+			})
+		}
+		e, err := t.encode(pool)
+		if err != nil {
+			return 0, err
+		}
+		encoded = append(encoded, e)
+	}
+	slices.SortFunc(tables, func(a, b []uint32) int { return cmp.Compare(a[0], b[0]) })
+	slices.SortFunc(columns, func(a, b []uint32) int {
+		if n := cmp.Compare(a[0], b[0]); n != 0 {
+			return n
+		}
+		return cmp.Compare(a[1], b[1])
+	})
+	encoded = append(encoded,
+		&encodedTable{name: "_Tables", data: columnMajor(tablesColumns, tables)},
+		&encodedTable{name: "_Columns", data: columnMajor(columnsColumns, columns)})
+	codepage := d.usableCodepage(pool)
+	var poolData, stringData bytes.Buffer
+	_ = binary.Write(&poolData, binary.LittleEndian, uint32(codepage))
+	for i := 1; i < len(pool.data); i++ {
+		b, err := encodeString(pool.data[i], codepage)
+		if err != nil {
+			return 0, err
+		}
+		if len(b) > 0xFFFF {
+			return 0, fmt.Errorf("msi: string too long (%d bytes)", len(b))
+		}
+		_ = binary.Write(&poolData, binary.LittleEndian, uint16(len(b)))
+		_ = binary.Write(&poolData, binary.LittleEndian, pool.refs[i])
+		stringData.Write(b)
+	}
+	if len(pool.data) > 0xFFFF {
+		return 0, fmt.Errorf("msi: too many strings (%d)", len(pool.data))
+	}
+	w := cfb.NewWriter()
+	w.SetCLSID(classInstallerPackage)
+	if err := w.Create(StreamName("_StringPool", true), poolData.Bytes()); err != nil {
+		return 0, err
+	}
+	if err := w.Create(StreamName("_StringData", true), stringData.Bytes()); err != nil {
+		return 0, err
+	}
+	for _, e := range encoded {
+		if err := w.Create(StreamName(e.name, true), e.data); err != nil {
+			return 0, fmt.Errorf("msi: table %s: %w", e.name, err)
+		}
+	}
+	for _, s := range d.streams {
+		if err := w.CreateFrom(StreamName(s.name, false), s.r, s.size); err != nil {
+			return 0, fmt.Errorf("msi: stream %s: %w", s.name, err)
+		}
+	}
+	if d.Summary != nil {
+		summary, err := d.Summary.marshal(codepage)
+		if err != nil {
+			return 0, err
+		}
+		if err := w.Create(summaryStreamName, summary); err != nil {
+			return 0, err
+		}
+	}
+	return w.WriteTo(out)
+}
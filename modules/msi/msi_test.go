@@ -0,0 +1,127 @@
+package msi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/balibuild/bali/v3/modules/cfb"
+)
+
+func TestStreamName(t *testing.T) {
+	for _, name := range []string{"_StringPool", "Property", "File", "product.cab", "a-b"} {
+		encoded := StreamName(name, true)
+		decoded, table := DecodeStreamName(encoded)
+		if decoded != name || !table {
+			t.Fatalf("stream name %q decoded as %q", name, decoded)
+		}
+		if len([]rune(encoded)) > (len(name)+1)/2+2 && !strings.Contains(name, "-") {
+			t.Fatalf("stream name %q not compressed", name)
+		}
+	}
+}
+
+func TestDatabase(t *testing.T) {
+	d := NewDatabase()
+	d.Summary = &SummaryInfo{Title: "Installation Database", Template: "x64;1033", PackageCode: GUID(RandomGUID()), PageCount: 500, WordCount: WordCountCompressed}
+	property := d.CreateTable("Property", S("Property", 72).PrimaryKey(), L("Value", 0))
+	if err := property.Insert("ProductName", "Jack"); err != nil {
+		t.Fatal(err)
+	}
+	if err := property.Insert("Manufacturer", "Bali Café"); err != nil {
+		t.Fatal(err)
+	}
+	if err := property.Insert(nil, "x"); err == nil {
+		t.Fatal("expected null key error")
+	}
+	media := d.CreateTable("Media", I2("DiskId").PrimaryKey(), I4("LastSequence"), S("Cabinet", 255).AllowNull())
+	if err := media.Insert(1, 70000, "#product.cab"); err != nil {
+		t.Fatal(err)
+	}
+	payload := bytes.Repeat([]byte("cab"), 3000)
+	d.AddStream("product.cab", bytes.NewReader(payload), int64(len(payload)))
+	var buf bytes.Buffer
+	if _, err := d.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfb.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CLSID != classInstallerPackage {
+		t.Fatal("class id mismatch")
+	}
+	poolData, err := r.ReadStream(StreamName("_StringPool", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stringData, err := r.ReadStream(StreamName("_StringData", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	le := binary.LittleEndian
+	if cp := le.Uint32(poolData); cp != CodepageWestern {
+		t.Fatalf("codepage %d", cp)
+	}
+	strs := []string{""}
+	for off, p := 0, poolData[4:]; len(p) >= 4; p = p[4:] {
+		n := int(le.Uint16(p))
+		strs = append(strs, string(stringData[off:off+n]))
+		off += n
+	}
+	tableData, err := r.ReadStream(StreamName("_Tables", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for p := tableData; len(p) >= 2; p = p[2:] {
+		tables = append(tables, strs[le.Uint16(p)])
+	}
+	if strings.Join(tables, ",") != "Property,Media" {
+		t.Fatalf("unexpected tables %v", tables)
+	}
+	// Property: 2 rows sorted by key string index, 2 string columns
+	propData, err := r.ReadStream(StreamName("Property", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(propData) != 2*2*2 {
+		t.Fatalf("Property table size %d", len(propData))
+	}
+	if strs[le.Uint16(propData[0:])] != "ProductName" || strs[le.Uint16(propData[6:])] != "Bali Caf\xe9" {
+		t.Fatal("Property table content mismatch")
+	}
+	mediaData, err := r.ReadStream(StreamName("Media", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if le.Uint16(mediaData) != 1^0x8000 || le.Uint32(mediaData[2:]) != 70000^0x80000000 {
+		t.Fatal("Media table integers mismatch")
+	}
+	cab, err := r.ReadStream(StreamName("product.cab", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(cab, payload) {
+		t.Fatal("stream mismatch")
+	}
+	summary, err := r.ReadStream(summaryStreamName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if le.Uint16(summary) != 0xFFFE || !bytes.Equal(summary[28:44], fmtidSummaryInformation[:]) {
+		t.Fatal("bad summary information")
+	}
+}
+
+func TestNameGUID(t *testing.T) {
+	ns, err := ParseGUID("{6BA7B810-9DAD-11D1-80B4-00C04FD430C8}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// uuid.NewSHA1(uuid.NameSpaceDNS, []byte("python.org"))
+	if g := GUID(NameGUID(ns, "python.org")); g != "{886313E1-3B8A-5372-9B90-0C9AEE199E5D}" {
+		t.Fatalf("unexpected guid %s", g)
+	}
+}
@@ -0,0 +1,157 @@
+package msi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"time"
+
+	"github.com/balibuild/bali/v3/modules/cfb"
+)
+
+const (
+	summaryStreamName = "\x05SummaryInformation"
+
+	vtI2       = 2
+	vtI4       = 3
+	vtLPSTR    = 30
+	vtFILETIME = 64
+
+	pidCodepage   = 1
+	pidTitle      = 2
+	pidSubject    = 3
+	pidAuthor     = 4
+	pidKeywords   = 5
+	pidComments   = 6
+	pidTemplate   = 7
+	pidRevNumber  = 9
+	pidCreateTime = 12
+	pidSaveTime   = 13
+	pidPageCount  = 14
+	pidWordCount  = 15
+	pidAppName    = 18
+	pidSecurity   = 19
+
+	// word count: long file names, compressed source
+	WordCountCompressed = 2
+)
+
+var (
+	// {F29F85E0-4FF9-1068-AB91-08002B27B3D9}
+	fmtidSummaryInformation = cfb.CLSID{0xE0, 0x85, 0x9F, 0xF2, 0xF9, 0x4F, 0x68, 0x10, 0xAB, 0x91, 0x08, 0x00, 0x2B, 0x27, 0xB3, 0xD9}
+)
+
+// SummaryInfo: the summary information stream of an installer package
+//
+// https://learn.microsoft.com/en-us/windows/win32/msi/summary-information-stream-property-set
+type SummaryInfo struct {
+	Title       string
+	Subject     string
+	Author      string
+	Keywords    string
+	Comments    string
+	Template    string // platform;language e.g. x64;1033
+	PackageCode string // revision number: the package code GUID
+	PageCount   int    // minimum installer version
+	WordCount   int
+	AppName     string
+	Security    int
+	Time        time.Time
+}
+
+type property struct {
+	id    uint32
+	value []byte
+}
+
+func typedValue(vt uint32, payload []byte) []byte {
+	b := make([]byte, 4, 4+len(payload)+3)
+	binary.LittleEndian.PutUint32(b, vt)
+	b = append(b, payload...)
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func filetime(t time.Time) []byte {
+	// 100-nanosecond intervals since January 1, 1601 (UTC)
+	const epochDelta = 116444736000000000
+	v := uint64(t.UnixNano()/100 + epochDelta)
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, v)
+	return b
+}
+
+func (s *SummaryInfo) marshal(codepage int) ([]byte, error) {
+	var props []property
+	addString := func(id uint32, v string) error {
+		if len(v) == 0 {
+			return nil
+		}
+		b, err := encodeString(v, codepage)
+		if err != nil {
+			return err
+		}
+		payload := binary.LittleEndian.AppendUint32(nil, uint32(len(b)+1))
+		payload = append(payload, b...)
+		payload = append(payload, 0)
+		props = append(props, property{id: id, value: typedValue(vtLPSTR, payload)})
+		return nil
+	}
+	addInt := func(id uint32, v int) {
+		props = append(props, property{id: id, value: typedValue(vtI4, binary.LittleEndian.AppendUint32(nil, uint32(int32(v))))})
+	}
+	props = append(props, property{id: pidCodepage, value: typedValue(vtI2, binary.LittleEndian.AppendUint16(nil, uint16(int16(codepage))))})
+	for _, sp := range []struct {
+		id uint32
+		v  string
+	}{
+		{pidTitle, s.Title},
+		{pidSubject, s.Subject},
+		{pidAuthor, s.Author},
+		{pidKeywords, s.Keywords},
+		{pidComments, s.Comments},
+		{pidTemplate, s.Template},
+		{pidRevNumber, s.PackageCode},
+		{pidAppName, s.AppName},
+	} {
+		if err := addString(sp.id, sp.v); err != nil {
+			return nil, err
+		}
+	}
+	t := s.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	props = append(props,
+		property{id: pidCreateTime, value: typedValue(vtFILETIME, filetime(t))},
+		property{id: pidSaveTime, value: typedValue(vtFILETIME, filetime(t))})
+	addInt(pidPageCount, s.PageCount)
+	addInt(pidWordCount, s.WordCount)
+	addInt(pidSecurity, s.Security)
+	slices.SortFunc(props, func(a, b property) int { return int(a.id) - int(b.id) })
+
+	// section: size, count, (id, offset) pairs, values
+	offset := 8 + 8*len(props)
+	var index, values bytes.Buffer
+	for _, p := range props {
+		_ = binary.Write(&index, binary.LittleEndian, p.id)
+		_ = binary.Write(&index, binary.LittleEndian, uint32(offset+values.Len()))
+		values.Write(p.value)
+	}
+	var out bytes.Buffer
+	le := binary.LittleEndian
+	_ = binary.Write(&out, le, uint16(0xFFFE)) // byte order
+	_ = binary.Write(&out, le, uint16(0))      // format
+	_ = binary.Write(&out, le, uint32(0x00020006))
+	out.Write(make([]byte, 16)) // class id
+	_ = binary.Write(&out, le, uint32(1))
+	out.Write(fmtidSummaryInformation[:])
+	_ = binary.Write(&out, le, uint32(48))
+	_ = binary.Write(&out, le, uint32(offset+values.Len()))
+	_ = binary.Write(&out, le, uint32(len(props)))
+	out.Write(index.Bytes())
+	out.Write(values.Bytes())
+	return out.Bytes(), nil
+}
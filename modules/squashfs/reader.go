@@ -0,0 +1,325 @@
+package squashfs
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// File: an entry of the image, directories included
+type File struct {
+	Name    string // slash separated path relative to the root
+	Mode    fs.FileMode
+	Size    int64
+	ModTime time.Time
+	Target  string // symlink target
+	start   int64
+	blocks  []uint32
+}
+
+// Reader reads images without fragments, as written by Writer and mksquashfs -no-fragments
+type Reader struct {
+	r           io.ReaderAt
+	sb          superblock
+	codec       *codec
+	Compression Compression
+	BlockSize   int
+	ModTime     time.Time
+	Files       []*File
+}
+
+// metaReader reads records spanning consecutive metadata blocks
+type metaReader struct {
+	r    *Reader
+	next int64
+	buf  []byte
+}
+
+func (m *metaReader) fill() error {
+	if m.next+2 > int64(m.r.sb.BytesUsed) {
+		return ErrCorrupt
+	}
+	var h [2]byte
+	if _, err := m.r.r.ReadAt(h[:], m.next); err != nil {
+		return err
+	}
+	header := le.Uint16(h[:])
+	size := int64(header &^ metaUncompressed)
+	if size == 0 || size > metadataSize || m.next+2+size > int64(m.r.sb.BytesUsed) {
+		return ErrCorrupt
+	}
+	data := make([]byte, size)
+	if _, err := m.r.r.ReadAt(data, m.next+2); err != nil {
+		return err
+	}
+	if header&metaUncompressed == 0 {
+		var err error
+		if data, err = m.r.codec.decompress(data, metadataSize); err != nil {
+			return fmt.Errorf("squashfs: metadata block at %d: %w", m.next, err)
+		}
+	}
+	m.next += 2 + size
+	m.buf = append(m.buf, data...)
+	return nil
+}
+
+func (m *metaReader) Read(p []byte) (int, error) {
+	if len(m.buf) == 0 {
+		if err := m.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, m.buf)
+	m.buf = m.buf[n:]
+	return n, nil
+}
+
+func (r *Reader) metaReader(start int64, offset int) (*metaReader, error) {
+	m := &metaReader{r: r, next: start}
+	if err := m.fill(); err != nil {
+		return nil, err
+	}
+	if offset > len(m.buf) {
+		return nil, ErrCorrupt
+	}
+	m.buf = m.buf[offset:]
+	return m, nil
+}
+
+// NewReader reads the superblock and lists all entries, r starts at the superblock
+func NewReader(r io.ReaderAt) (*Reader, error) {
+	sr := &Reader{r: r}
+	if err := binary.Read(io.NewSectionReader(r, 0, superblockSize), le, &sr.sb); err != nil {
+		return nil, fmt.Errorf("squashfs: read superblock: %w", err)
+	}
+	if sr.sb.Magic != Magic {
+		return nil, fmt.Errorf("squashfs: bad magic %#x", sr.sb.Magic)
+	}
+	if sr.sb.VersionMajor != 4 {
+		return nil, fmt.Errorf("%w: version %d.%d", ErrUnsupported, sr.sb.VersionMajor, sr.sb.VersionMinor)
+	}
+	if sr.sb.FragmentCount != 0 {
+		return nil, fmt.Errorf("%w: fragments", ErrUnsupported)
+	}
+	if sr.sb.BlockSize < MinBlockSize || sr.sb.BlockSize > MaxBlockSize {
+		return nil, ErrCorrupt
+	}
+	var err error
+	if sr.codec, err = newCodec(sr.sb.Compression); err != nil {
+		return nil, err
+	}
+	sr.Compression = sr.sb.Compression
+	sr.BlockSize = int(sr.sb.BlockSize)
+	sr.ModTime = time.Unix(int64(sr.sb.ModTime), 0)
+	if err := sr.walk(sr.sb.RootInode, ""); err != nil {
+		return nil, err
+	}
+	return sr, nil
+}
+
+func (r *Reader) walk(ref uint64, name string) error {
+	if len(r.Files) > int(r.sb.InodeCount) {
+		return ErrCorrupt
+	}
+	m, err := r.metaReader(int64(r.sb.InodeTableStart+ref>>16), int(ref&0xFFFF))
+	if err != nil {
+		return err
+	}
+	var h inodeHeader
+	if err := binary.Read(m, le, &h); err != nil {
+		return err
+	}
+	f := &File{Name: name, Mode: fileMode(h.Type, h.Permissions), ModTime: time.Unix(int64(h.ModTime), 0)}
+	if len(name) != 0 {
+		r.Files = append(r.Files, f)
+	}
+	var fragment uint32
+	switch h.Type {
+	case typeDir:
+		var d struct {
+			Start  uint32
+			Links  uint32
+			Size   uint16
+			Offset uint16
+			Parent uint32
+		}
+		if err := binary.Read(m, le, &d); err != nil {
+			return err
+		}
+		return r.walkDir(name, d.Start, d.Offset, int64(d.Size))
+	case typeExtDir:
+		var d struct {
+			Links      uint32
+			Size       uint32
+			Start      uint32
+			Parent     uint32
+			IndexCount uint16
+			Offset     uint16
+			Xattr      uint32
+		}
+		if err := binary.Read(m, le, &d); err != nil {
+			return err
+		}
+		return r.walkDir(name, d.Start, d.Offset, int64(d.Size))
+	case typeFile:
+		var d struct {
+			Start      uint32
+			Fragment   uint32
+			FragOffset uint32
+			Size       uint32
+		}
+		if err := binary.Read(m, le, &d); err != nil {
+			return err
+		}
+		f.start, f.Size, fragment = int64(d.Start), int64(d.Size), d.Fragment
+	case typeExtFile:
+		var d struct {
+			Start      uint64
+			Size       uint64
+			Sparse     uint64
+			Links      uint32
+			Fragment   uint32
+			FragOffset uint32
+			Xattr      uint32
+		}
+		if err := binary.Read(m, le, &d); err != nil {
+			return err
+		}
+		f.start, f.Size, fragment = int64(d.Start), int64(d.Size), d.Fragment
+	case typeSymlink, typeExtSymlink:
+		var d struct {
+			Links uint32
+			Size  uint32
+		}
+		if err := binary.Read(m, le, &d); err != nil {
+			return err
+		}
+		if d.Size > 4096 {
+			return ErrCorrupt
+		}
+		target := make([]byte, d.Size)
+		if _, err := io.ReadFull(m, target); err != nil {
+			return err
+		}
+		f.Target = string(target)
+		return nil
+	default:
+		return fmt.Errorf("%w: inode type %d", ErrUnsupported, h.Type)
+	}
+	if fragment != noFragment {
+		return fmt.Errorf("%w: fragments", ErrUnsupported)
+	}
+	n := (f.Size + int64(r.sb.BlockSize) - 1) / int64(r.sb.BlockSize)
+	if f.Size < 0 || f.start > int64(r.sb.BytesUsed) || n > int64(r.sb.BytesUsed) {
+		return ErrCorrupt
+	}
+	f.blocks = make([]uint32, n)
+	return binary.Read(m, le, f.blocks)
+}
+
+func (r *Reader) walkDir(name string, start uint32, offset uint16, size int64) error {
+	if size <= 3 {
+		return nil
+	}
+	m, err := r.metaReader(int64(r.sb.DirectoryTableStart)+int64(start), int(offset))
+	if err != nil {
+		return err
+	}
+	lr := io.LimitReader(m, size-3)
+	for {
+		var h dirHeader
+		if err := binary.Read(lr, le, &h); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if h.Count >= 256 {
+			return ErrCorrupt
+		}
+		for i := uint32(0); i <= h.Count; i++ {
+			var e dirEntry
+			if err := binary.Read(lr, le, &e); err != nil {
+				return err
+			}
+			if e.NameSize >= maxNameLen {
+				return ErrCorrupt
+			}
+			b := make([]byte, int(e.NameSize)+1)
+			if _, err := io.ReadFull(lr, b); err != nil {
+				return err
+			}
+			child := string(b)
+			if child == "." || child == ".." || strings.Contains(child, "/") {
+				return ErrCorrupt
+			}
+			if err := r.walk(uint64(h.Start)<<16|uint64(e.Offset), path.Join(name, child)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type fileReader struct {
+	r      *Reader
+	f      *File
+	i      int
+	pos    int64
+	remain int64
+	buf    []byte
+}
+
+func (fr *fileReader) Read(p []byte) (int, error) {
+	for len(fr.buf) == 0 {
+		if fr.remain == 0 {
+			return 0, io.EOF
+		}
+		if fr.i >= len(fr.f.blocks) {
+			return 0, ErrCorrupt
+		}
+		bs := fr.f.blocks[fr.i]
+		fr.i++
+		want := min(fr.remain, int64(fr.r.sb.BlockSize))
+		size := int64(bs &^ dataUncompressed)
+		if size > int64(fr.r.sb.BlockSize) || fr.pos+size > int64(fr.r.sb.BytesUsed) {
+			return 0, ErrCorrupt
+		}
+		var data []byte
+		if size == 0 {
+			data = make([]byte, want) // sparse
+		} else {
+			data = make([]byte, size)
+			if _, err := fr.r.r.ReadAt(data, fr.pos); err != nil {
+				return 0, err
+			}
+			fr.pos += size
+			if bs&dataUncompressed == 0 {
+				var err error
+				if data, err = fr.r.codec.decompress(data, int(fr.r.sb.BlockSize)); err != nil {
+					return 0, fmt.Errorf("squashfs: %s: %w", fr.f.Name, err)
+				}
+			}
+		}
+		if int64(len(data)) != want {
+			return 0, ErrCorrupt
+		}
+		fr.remain -= want
+		fr.buf = data
+	}
+	n := copy(p, fr.buf)
+	fr.buf = fr.buf[n:]
+	return n, nil
+}
+
+// Open returns the content of a regular file
+func (r *Reader) Open(f *File) (io.Reader, error) {
+	if !f.Mode.IsRegular() {
+		return nil, fmt.Errorf("squashfs: '%s' is not a regular file", f.Name)
+	}
+	return &fileReader{r: r, f: f, pos: f.start, remain: f.Size}, nil
+}
@@ -0,0 +1,201 @@
+// Package squashfs writes and reads SquashFS 4.0 images without fragments or
+// extended attributes, as mounted by AppImage runtimes.
+//
+// https://dr-emann.github.io/squashfs/squashfs.html
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	Magic            = 0x73717368 // hsqs
+	DefaultBlockSize = 128 * 1024
+	MinBlockSize     = 4 * 1024
+	MaxBlockSize     = 1024 * 1024
+	superblockSize   = 96
+	metadataSize     = 8192
+	metaUncompressed = 0x8000
+	dataUncompressed = 1 << 24
+	invalidTable     = 0xFFFFFFFFFFFFFFFF
+	noFragment       = 0xFFFFFFFF
+	noXattr          = 0xFFFFFFFF
+	flagNoFragments  = 0x0010
+	flagNoXattrs     = 0x0200
+	devicePadding    = 4096
+	maxNameLen       = 256
+	typeDir          = 1
+	typeFile         = 2
+	typeSymlink      = 3
+	typeExtDir       = 8
+	typeExtFile      = 9
+	typeExtSymlink   = 10
+)
+
+var (
+	ErrCorrupt     = errors.New("squashfs: corrupt image")
+	ErrUnsupported = errors.New("squashfs: unsupported image")
+)
+
+// Compression: compressor id stored in the superblock
+type Compression uint16
+
+const (
+	Gzip Compression = 1 // zlib streams
+	Zstd Compression = 6
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("compression(%d)", uint16(c))
+}
+
+type superblock struct {
+	Magic               uint32
+	InodeCount          uint32
+	ModTime             uint32
+	BlockSize           uint32
+	FragmentCount       uint32
+	Compression         Compression
+	BlockLog            uint16
+	Flags               uint16
+	IDCount             uint16
+	VersionMajor        uint16
+	VersionMinor        uint16
+	RootInode           uint64
+	BytesUsed           uint64
+	IDTableStart        uint64
+	XattrIDTableStart   uint64
+	InodeTableStart     uint64
+	DirectoryTableStart uint64
+	FragmentTableStart  uint64
+	ExportTableStart    uint64
+}
+
+// inodeHeader: common to all inode types
+type inodeHeader struct {
+	Type        uint16
+	Permissions uint16
+	UID         uint16
+	GID         uint16
+	ModTime     uint32
+	Number      uint32
+}
+
+type dirHeader struct {
+	Count  uint32 // entries - 1
+	Start  uint32 // inode metadata block, relative to the inode table
+	Number uint32 // base inode number
+}
+
+type dirEntry struct {
+	Offset      uint16
+	InodeOffset int16
+	Type        uint16
+	NameSize    uint16 // len(name) - 1
+}
+
+type codec struct {
+	compress   func(src []byte) ([]byte, error)
+	decompress func(src []byte, limit int) ([]byte, error)
+}
+
+func newCodec(c Compression) (*codec, error) {
+	switch c {
+	case Gzip:
+		var buf bytes.Buffer
+		zw, _ := zlib.NewWriterLevel(&buf, zlib.BestCompression)
+		return &codec{
+			compress: func(src []byte) ([]byte, error) {
+				buf.Reset()
+				zw.Reset(&buf)
+				if _, err := zw.Write(src); err != nil {
+					return nil, err
+				}
+				if err := zw.Close(); err != nil {
+					return nil, err
+				}
+				return buf.Bytes(), nil
+			},
+			decompress: func(src []byte, limit int) ([]byte, error) {
+				zr, err := zlib.NewReader(bytes.NewReader(src))
+				if err != nil {
+					return nil, err
+				}
+				defer zr.Close()
+				return io.ReadAll(io.LimitReader(zr, int64(limit)))
+			},
+		}, nil
+	case Zstd:
+		enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBestCompression), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		var dst []byte
+		return &codec{
+			compress: func(src []byte) ([]byte, error) {
+				dst = enc.EncodeAll(src, dst[:0])
+				return dst, nil
+			},
+			decompress: func(src []byte, limit int) ([]byte, error) {
+				out, err := dec.DecodeAll(src, make([]byte, 0, limit))
+				if err == nil && len(out) > limit {
+					return nil, ErrCorrupt
+				}
+				return out, err
+			},
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupported, c)
+}
+
+// permissions: fs.FileMode to the unix mode bits of an inode
+func permissions(mode fs.FileMode) uint16 {
+	m := uint16(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		m |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		m |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		m |= 0o1000
+	}
+	return m
+}
+
+func fileMode(typ, perm uint16) fs.FileMode {
+	mode := fs.FileMode(perm & 0o777)
+	if perm&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if perm&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if perm&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	switch typ {
+	case typeDir, typeExtDir:
+		mode |= fs.ModeDir
+	case typeSymlink, typeExtSymlink:
+		mode |= fs.ModeSymlink
+	}
+	return mode
+}
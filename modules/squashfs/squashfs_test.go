@@ -0,0 +1,114 @@
+package squashfs
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	random := make([]byte, 300*1024)
+	rand.New(rand.NewSource(1)).Read(random)
+	text := bytes.Repeat([]byte("squashfs test data\n"), 20000)
+	modTime := time.Unix(1700000000, 0)
+	for _, c := range []Compression{Gzip, Zstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			fd, err := os.Create(filepath.Join(t.TempDir(), "image"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer fd.Close()
+			runtime := []byte("\x7fELF runtime")
+			if _, err := fd.Write(runtime); err != nil {
+				t.Fatal(err)
+			}
+			w, err := NewWriter(fd, &Options{Compression: c, ModTime: modTime})
+			if err != nil {
+				t.Fatal(err)
+			}
+			files := map[string][]byte{
+				"usr/bin/random":  random,
+				"usr/share/text":  text,
+				"usr/share/empty": nil,
+			}
+			// enough entries to span several metadata blocks
+			for i := range 600 {
+				files[fmt.Sprintf("usr/lib/many/file-%03d.txt", i)] = []byte(fmt.Sprintf("file %d\n", i))
+			}
+			for name, data := range files {
+				if err := w.AddFile(name, 0644, modTime, bytes.NewReader(data)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.AddDir("usr/bin", 0700, modTime); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.AddSymlink("AppRun", "usr/bin/random", modTime); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.AddFile("AppRun", 0755, modTime, bytes.NewReader(nil)); err == nil {
+				t.Fatal("duplicate entry accepted")
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			end, _ := fd.Seek(0, io.SeekCurrent)
+			if (end-int64(len(runtime)))%devicePadding != 0 {
+				t.Errorf("image is not padded: %d", end)
+			}
+			r, err := NewReader(io.NewSectionReader(fd, int64(len(runtime)), end))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.sb.FragmentTableStart >= r.sb.IDTableStart || r.sb.InodeTableStart >= r.sb.DirectoryTableStart {
+				t.Errorf("bad table layout: %+v", r.sb)
+			}
+			if r.Compression != c || !r.ModTime.Equal(modTime) {
+				t.Errorf("superblock: %v %v", r.Compression, r.ModTime)
+			}
+			seen := 0
+			for _, f := range r.Files {
+				switch {
+				case f.Mode.IsDir():
+					if f.Name == "usr/bin" && f.Mode.Perm() != 0700 {
+						t.Errorf("usr/bin mode %v", f.Mode)
+					}
+				case f.Mode&fs.ModeSymlink != 0:
+					if f.Name != "AppRun" || f.Target != "usr/bin/random" {
+						t.Errorf("symlink %s -> %s", f.Name, f.Target)
+					}
+				default:
+					want, ok := files[f.Name]
+					if !ok {
+						t.Errorf("unexpected file %s", f.Name)
+						continue
+					}
+					fr, err := r.Open(f)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, err := io.ReadAll(fr)
+					if err != nil {
+						t.Fatalf("%s: %v", f.Name, err)
+					}
+					if !bytes.Equal(got, want) || f.Size != int64(len(want)) {
+						t.Errorf("%s: content mismatch", f.Name)
+					}
+					if f.Mode.Perm() != 0644 || !f.ModTime.Equal(modTime) {
+						t.Errorf("%s: mode %v mtime %v", f.Name, f.Mode, f.ModTime)
+					}
+					seen++
+				}
+			}
+			if seen != len(files) {
+				t.Errorf("read %d files, want %d", seen, len(files))
+			}
+		})
+	}
+}
@@ -0,0 +1,442 @@
+package squashfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"math/bits"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+var le = binary.LittleEndian
+
+// Options: zero values select gzip, 128 KiB blocks and the Unix epoch
+type Options struct {
+	Compression Compression
+	BlockSize   int // power of two, 4 KiB to 1 MiB
+	ModTime     time.Time
+}
+
+type node struct {
+	name     string
+	mode     fs.FileMode
+	modTime  time.Time
+	children []*node
+	index    map[string]*node
+	target   string   // symlink
+	size     int64    // file
+	start    int64    // file, first data block relative to the image
+	blocks   []uint32 // file, on-disk block sizes
+	number   uint32
+	ref      uint64 // inode metadata block << 16 | offset
+}
+
+func (n *node) add(c *node) {
+	n.children = append(n.children, c)
+	n.index[c.name] = c
+}
+
+// metaWriter packs records into 8 KiB metadata blocks
+type metaWriter struct {
+	out     bytes.Buffer
+	pending []byte
+	codec   *codec
+}
+
+// pos returns the start of the next record: block offset in the table and offset in the uncompressed block
+func (m *metaWriter) pos() (uint32, uint16) {
+	return uint32(m.out.Len()), uint16(len(m.pending))
+}
+
+func (m *metaWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) != 0 {
+		k := min(metadataSize-len(m.pending), len(p))
+		m.pending = append(m.pending, p[:k]...)
+		p = p[k:]
+		if len(m.pending) == metadataSize {
+			if err := m.flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (m *metaWriter) flush() error {
+	if len(m.pending) == 0 {
+		return nil
+	}
+	data, err := m.codec.compress(m.pending)
+	if err != nil {
+		return err
+	}
+	header := uint16(len(data))
+	if len(data) >= len(m.pending) {
+		data = m.pending
+		header = uint16(len(data)) | metaUncompressed
+	}
+	_ = binary.Write(&m.out, le, header)
+	m.out.Write(data)
+	m.pending = m.pending[:0]
+	return nil
+}
+
+// Writer streams file data into the image as files are added, inode and directory tables are written by Close
+type Writer struct {
+	w      io.WriteSeeker
+	base   int64
+	off    int64 // relative to base
+	opts   Options
+	codec  *codec
+	root   *node
+	block  []byte
+	closed bool
+}
+
+// NewWriter starts an image at the current offset of w, e.g. after an AppImage runtime
+func NewWriter(w io.WriteSeeker, opts *Options) (*Writer, error) {
+	o := Options{Compression: Gzip, BlockSize: DefaultBlockSize, ModTime: time.Unix(0, 0)}
+	if opts != nil {
+		if opts.Compression != 0 {
+			o.Compression = opts.Compression
+		}
+		if opts.BlockSize != 0 {
+			o.BlockSize = opts.BlockSize
+		}
+		if !opts.ModTime.IsZero() {
+			o.ModTime = opts.ModTime
+		}
+	}
+	if o.BlockSize < MinBlockSize || o.BlockSize > MaxBlockSize || bits.OnesCount(uint(o.BlockSize)) != 1 {
+		return nil, fmt.Errorf("squashfs: invalid block size %d", o.BlockSize)
+	}
+	c, err := newCodec(o.Compression)
+	if err != nil {
+		return nil, err
+	}
+	base, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	sw := &Writer{
+		w:     w,
+		base:  base,
+		opts:  o,
+		codec: c,
+		root:  &node{mode: fs.ModeDir | 0755, modTime: o.ModTime, index: make(map[string]*node)},
+		block: make([]byte, o.BlockSize),
+	}
+	// superblock placeholder
+	if err := sw.write(make([]byte, superblockSize)); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (w *Writer) write(p []byte) error {
+	n, err := w.w.Write(p)
+	w.off += int64(n)
+	return err
+}
+
+// parent returns the directory of name, missing directories are created with mode 0755
+func (w *Writer) parent(name string) (*node, string, error) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if len(name) == 0 {
+		return nil, "", fmt.Errorf("squashfs: invalid name '%s'", name)
+	}
+	elems := strings.Split(name, "/")
+	dir := w.root
+	for _, e := range elems[:len(elems)-1] {
+		c := dir.index[e]
+		if c == nil {
+			c = &node{name: e, mode: fs.ModeDir | 0755, modTime: w.opts.ModTime, index: make(map[string]*node)}
+			dir.add(c)
+		}
+		if !c.mode.IsDir() {
+			return nil, "", fmt.Errorf("squashfs: '%s' is not a directory", e)
+		}
+		dir = c
+	}
+	base := elems[len(elems)-1]
+	if len(base) > maxNameLen {
+		return nil, "", fmt.Errorf("squashfs: name '%s' too long", base)
+	}
+	return dir, base, nil
+}
+
+// AddDir adds a directory, or updates the mode of an implicitly created one
+func (w *Writer) AddDir(name string, mode fs.FileMode, modTime time.Time) error {
+	dir, base, err := w.parent(name)
+	if err != nil {
+		return err
+	}
+	if c := dir.index[base]; c != nil {
+		if !c.mode.IsDir() {
+			return fmt.Errorf("squashfs: duplicate entry '%s'", name)
+		}
+		c.mode, c.modTime = fs.ModeDir|mode.Perm(), modTime
+		return nil
+	}
+	dir.add(&node{name: base, mode: fs.ModeDir | mode.Perm(), modTime: modTime, index: make(map[string]*node)})
+	return nil
+}
+
+// AddSymlink adds a symbolic link to target
+func (w *Writer) AddSymlink(name, target string, modTime time.Time) error {
+	dir, base, err := w.parent(name)
+	if err != nil {
+		return err
+	}
+	if dir.index[base] != nil {
+		return fmt.Errorf("squashfs: duplicate entry '%s'", name)
+	}
+	dir.add(&node{name: base, mode: fs.ModeSymlink | 0777, modTime: modTime, target: target})
+	return nil
+}
+
+// AddFile compresses the content of r into data blocks
+func (w *Writer) AddFile(name string, mode fs.FileMode, modTime time.Time, r io.Reader) error {
+	dir, base, err := w.parent(name)
+	if err != nil {
+		return err
+	}
+	if dir.index[base] != nil {
+		return fmt.Errorf("squashfs: duplicate entry '%s'", name)
+	}
+	n := &node{name: base, mode: mode &^ fs.ModeType, modTime: modTime, start: w.off}
+	for {
+		k, err := io.ReadFull(r, w.block)
+		if k != 0 {
+			if err := w.writeBlock(n, w.block[:k]); err != nil {
+				return err
+			}
+			n.size += int64(k)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	dir.add(n)
+	return nil
+}
+
+func (w *Writer) writeBlock(n *node, data []byte) error {
+	c, err := w.codec.compress(data)
+	if err != nil {
+		return err
+	}
+	size := uint32(len(c))
+	if len(c) >= len(data) {
+		c = data
+		size = uint32(len(data)) | dataUncompressed
+	}
+	n.blocks = append(n.blocks, size)
+	return w.write(c)
+}
+
+func unixTime(t time.Time) uint32 {
+	return uint32(min(max(t.Unix(), 0), math.MaxUint32))
+}
+
+func (w *Writer) inodeHeader(n *node, typ uint16) inodeHeader {
+	return inodeHeader{Type: typ, Permissions: permissions(n.mode), ModTime: unixTime(n.modTime), Number: n.number}
+}
+
+// writeDir writes the directory listing then the directory inode, children are already written
+func (w *Writer) writeDir(inodes, dirs *metaWriter, n *node, parent uint32) error {
+	block, offset := dirs.pos()
+	var listing bytes.Buffer
+	links := uint32(2)
+	for i := 0; i < len(n.children); {
+		start, number := uint32(n.children[i].ref>>16), n.children[i].number
+		j := i
+		for j < len(n.children) && j-i < 256 && uint32(n.children[j].ref>>16) == start && int64(n.children[j].number)-int64(number) <= math.MaxInt16 {
+			j++
+		}
+		_ = binary.Write(&listing, le, &dirHeader{Count: uint32(j - i - 1), Start: start, Number: number})
+		for _, c := range n.children[i:j] {
+			typ := uint16(typeFile)
+			switch {
+			case c.mode.IsDir():
+				typ = typeDir
+				links++
+			case c.mode&fs.ModeSymlink != 0:
+				typ = typeSymlink
+			}
+			_ = binary.Write(&listing, le, &dirEntry{Offset: uint16(c.ref), InodeOffset: int16(c.number - number), Type: typ, NameSize: uint16(len(c.name) - 1)})
+			listing.WriteString(c.name)
+		}
+		i = j
+	}
+	if _, err := dirs.Write(listing.Bytes()); err != nil {
+		return err
+	}
+	size := listing.Len() + 3 // . and ..
+	if size <= math.MaxUint16 {
+		_ = binary.Write(inodes, le, w.inodeHeader(n, typeDir))
+		return binary.Write(inodes, le, &struct {
+			Start  uint32
+			Links  uint32
+			Size   uint16
+			Offset uint16
+			Parent uint32
+		}{block, links, uint16(size), offset, parent})
+	}
+	_ = binary.Write(inodes, le, w.inodeHeader(n, typeExtDir))
+	return binary.Write(inodes, le, &struct {
+		Links      uint32
+		Size       uint32
+		Start      uint32
+		Parent     uint32
+		IndexCount uint16
+		Offset     uint16
+		Xattr      uint32
+	}{links, uint32(size), block, parent, 0, offset, noXattr})
+}
+
+func (w *Writer) writeFile(inodes *metaWriter, n *node) error {
+	if n.start <= math.MaxUint32 && n.size <= math.MaxUint32 {
+		_ = binary.Write(inodes, le, w.inodeHeader(n, typeFile))
+		_ = binary.Write(inodes, le, &struct {
+			Start      uint32
+			Fragment   uint32
+			FragOffset uint32
+			Size       uint32
+		}{uint32(n.start), noFragment, 0, uint32(n.size)})
+	} else {
+		_ = binary.Write(inodes, le, w.inodeHeader(n, typeExtFile))
+		_ = binary.Write(inodes, le, &struct {
+			Start      uint64
+			Size       uint64
+			Sparse     uint64
+			Links      uint32
+			Fragment   uint32
+			FragOffset uint32
+			Xattr      uint32
+		}{uint64(n.start), uint64(n.size), 0, 1, noFragment, 0, noXattr})
+	}
+	return binary.Write(inodes, le, n.blocks)
+}
+
+func (w *Writer) writeSymlink(inodes *metaWriter, n *node) error {
+	_ = binary.Write(inodes, le, w.inodeHeader(n, typeSymlink))
+	_ = binary.Write(inodes, le, &struct {
+		Links uint32
+		Size  uint32
+	}{1, uint32(len(n.target))})
+	_, err := inodes.Write([]byte(n.target))
+	return err
+}
+
+// Close writes the inode, directory and id tables and the superblock, the image is padded to 4 KiB
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	// inodes are numbered and written children first, a directory needs the references of its entries
+	var count uint32
+	var number func(n *node)
+	number = func(n *node) {
+		slices.SortFunc(n.children, func(a, b *node) int {
+			return strings.Compare(a.name, b.name)
+		})
+		for _, c := range n.children {
+			number(c)
+		}
+		count++
+		n.number = count
+	}
+	number(w.root)
+	inodes, dirs := &metaWriter{codec: w.codec}, &metaWriter{codec: w.codec}
+	var write func(n *node, parent uint32) error
+	write = func(n *node, parent uint32) error {
+		for _, c := range n.children {
+			if err := write(c, n.number); err != nil {
+				return err
+			}
+		}
+		block, offset := inodes.pos()
+		n.ref = uint64(block)<<16 | uint64(offset)
+		switch {
+		case n.mode.IsDir():
+			return w.writeDir(inodes, dirs, n, parent)
+		case n.mode&fs.ModeSymlink != 0:
+			return w.writeSymlink(inodes, n)
+		}
+		return w.writeFile(inodes, n)
+	}
+	if err := write(w.root, count+1); err != nil {
+		return err
+	}
+	if err := inodes.flush(); err != nil {
+		return err
+	}
+	if err := dirs.flush(); err != nil {
+		return err
+	}
+	sb := &superblock{
+		Magic:             Magic,
+		InodeCount:        count,
+		ModTime:           unixTime(w.opts.ModTime),
+		BlockSize:         uint32(w.opts.BlockSize),
+		Compression:       w.opts.Compression,
+		BlockLog:          uint16(bits.TrailingZeros(uint(w.opts.BlockSize))),
+		Flags:             flagNoFragments | flagNoXattrs,
+		IDCount:           1,
+		VersionMajor:      4,
+		RootInode:         w.root.ref,
+		XattrIDTableStart: invalidTable,
+		ExportTableStart:  invalidTable,
+	}
+	sb.InodeTableStart = uint64(w.off)
+	if err := w.write(inodes.out.Bytes()); err != nil {
+		return err
+	}
+	sb.DirectoryTableStart = uint64(w.off)
+	if err := w.write(dirs.out.Bytes()); err != nil {
+		return err
+	}
+	// no fragments: the fragment table is empty and starts where the id table does
+	sb.FragmentTableStart = uint64(w.off)
+	// a single id: every entry is owned by root
+	ids := &metaWriter{codec: w.codec}
+	_ = binary.Write(ids, le, uint32(0))
+	if err := ids.flush(); err != nil {
+		return err
+	}
+	idBlock := uint64(w.off)
+	if err := w.write(ids.out.Bytes()); err != nil {
+		return err
+	}
+	sb.IDTableStart = uint64(w.off)
+	if err := w.write(le.AppendUint64(nil, idBlock)); err != nil {
+		return err
+	}
+	sb.BytesUsed = uint64(w.off)
+	if pad := (devicePadding - w.off%devicePadding) % devicePadding; pad != 0 {
+		if err := w.write(make([]byte, pad)); err != nil {
+			return err
+		}
+	}
+	end := w.base + w.off
+	if _, err := w.w.Seek(w.base, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(w.w, le, sb); err != nil {
+		return err
+	}
+	_, err := w.w.Seek(end, io.SeekStart)
+	return err
+}
@@ -1,16 +1,20 @@
 package term
 
+import (
+	"fmt"
+)
+
 // Red returns the string s wrapped in red ANSI color codes.
 // The color format depends on the Level:
 //   - Level16M: Uses RGB #f43b47 (truecolor)
-//   - Level256: Uses standard ANSI red
+//   - Level256, Level16: Use standard ANSI red
 //   - LevelNone: Returns s unchanged
 func (v Level) Red(s string) string {
 	switch v {
 	case Level16M:
 		// #f43b47
 		return "\x1b[38;2;244;59;71m" + s + "\x1b[0m"
-	case Level256:
+	case Level256, Level16:
 		// \e[0;31m	Red
 		return "\x1b[31m" + s + "\x1b[0m"
 	default:
@@ -21,14 +25,14 @@ func (v Level) Red(s string) string {
 // Green returns the string s wrapped in green ANSI color codes.
 // The color format depends on the Level:
 //   - Level16M: Uses RGB #43e97a (truecolor)
-//   - Level256: Uses standard ANSI green
+//   - Level256, Level16: Use standard ANSI green
 //   - LevelNone: Returns s unchanged
 func (v Level) Green(s string) string {
 	switch v {
 	case Level16M:
 		// #43e97a
 		return "\x1b[38;2;67;233;123m" + s + "\x1b[0m"
-	case Level256:
+	case Level256, Level16:
 		// \e[0;32m	Green
 		return "\x1b[32m" + s + "\x1b[0m"
 	default:
@@ -39,14 +43,14 @@ func (v Level) Green(s string) string {
 // Yellow returns the string s wrapped in yellow ANSI color codes.
 // The color format depends on the Level:
 //   - Level16M: Uses RGB #fee240 (truecolor)
-//   - Level256: Uses standard ANSI yellow
+//   - Level256, Level16: Use standard ANSI yellow
 //   - LevelNone: Returns s unchanged
 func (v Level) Yellow(s string) string {
 	switch v {
 	case Level16M:
 		// #fee240
 		return "\x1b[38;2;254;225;64m" + s + "\x1b[0m"
-	case Level256:
+	case Level256, Level16:
 		// \e[0;33m	Yellow
 		return "\x1b[33m" + s + "\x1b[0m"
 	default:
@@ -57,14 +61,14 @@ func (v Level) Yellow(s string) string {
 // Blue returns the string s wrapped in blue ANSI color codes.
 // The color format depends on the Level:
 //   - Level16M: Uses RGB #00c8ff (truecolor)
-//   - Level256: Uses standard ANSI blue
+//   - Level256, Level16: Use standard ANSI blue
 //   - LevelNone: Returns s unchanged
 func (v Level) Blue(s string) string {
 	switch v {
 	case Level16M:
 		// #00c8ff
 		return "\x1b[38;2;0;201;255m" + s + "\x1b[0m"
-	case Level256:
+	case Level256, Level16:
 		// \e[0;34m	Blue
 		return "\x1b[34m" + s + "\x1b[0m"
 	default:
@@ -75,17 +79,100 @@ func (v Level) Blue(s string) string {
 // Purple returns the string s wrapped in purple ANSI color codes.
 // The color format depends on the Level:
 //   - Level16M: Uses RGB #7028e4 (truecolor)
-//   - Level256: Uses standard ANSI purple
+//   - Level256, Level16: Use standard ANSI purple
 //   - LevelNone: Returns s unchanged
 func (v Level) Purple(s string) string {
 	switch v {
 	case Level16M:
 		// #7028e4
 		return "\x1b[38;2;112;40;228m" + s + "\x1b[0m"
-	case Level256:
+	case Level256, Level16:
 		// \e[0;35m	Purple
 		return "\x1b[35m" + s + "\x1b[0m"
 	default:
 	}
 	return s
 }
+
+// RGB is a truecolor, used as is on Level16M terminals and downgraded to the nearest
+// entry of the 256 color palette or of the 16 standard colors
+type RGB struct {
+	R, G, B uint8
+}
+
+// ansi16Palette: the xterm values of the 16 standard colors, 30-37 then 90-97
+var ansi16Palette = [16]RGB{
+	{0, 0, 0}, {205, 0, 0}, {0, 205, 0}, {205, 205, 0}, {0, 0, 238}, {205, 0, 205}, {0, 205, 205}, {229, 229, 229},
+	{127, 127, 127}, {255, 0, 0}, {0, 255, 0}, {255, 255, 0}, {92, 92, 255}, {255, 0, 255}, {0, 255, 255}, {255, 255, 255},
+}
+
+// cubeLevels: the channel values of the 6x6x6 color cube of the 256 color palette (16-231)
+var cubeLevels = [6]int{0, 95, 135, 175, 215, 255}
+
+func (c RGB) distance(o RGB) int {
+	dr, dg, db := int(c.R)-int(o.R), int(c.G)-int(o.G), int(c.B)-int(o.B)
+	return dr*dr + dg*dg + db*db
+}
+
+// ansi16 returns the SGR foreground code of the nearest standard color
+func (c RGB) ansi16() int {
+	best := 0
+	for i, p := range ansi16Palette {
+		if c.distance(p) < c.distance(ansi16Palette[best]) {
+			best = i
+		}
+	}
+	if best < 8 {
+		return 30 + best
+	}
+	return 90 + best - 8
+}
+
+// ansi256 returns the nearest index of the color cube (16-231) or of the gray ramp (232-255)
+func (c RGB) ansi256() int {
+	nearest := func(v uint8) int {
+		best := 0
+		for i, l := range cubeLevels {
+			if abs(int(v)-l) < abs(int(v)-cubeLevels[best]) {
+				best = i
+			}
+		}
+		return best
+	}
+	r, g, b := nearest(c.R), nearest(c.G), nearest(c.B)
+	cube := RGB{uint8(cubeLevels[r]), uint8(cubeLevels[g]), uint8(cubeLevels[b])}
+	// gray ramp: 8, 18 ... 238
+	avg := (int(c.R) + int(c.G) + int(c.B)) / 3
+	step := min(max((avg-8+5)/10, 0), 23)
+	gv := uint8(8 + step*10)
+	if c.distance(RGB{gv, gv, gv}) < c.distance(cube) {
+		return 232 + step
+	}
+	return 16 + 36*r + 6*g + b
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Paint returns the string s wrapped in the foreground color c.
+// The color format depends on the Level:
+//   - Level16M: Uses c (truecolor)
+//   - Level256: Uses the nearest entry of the 256 color palette
+//   - Level16: Uses the nearest standard ANSI color
+//   - LevelNone: Returns s unchanged
+func (v Level) Paint(c RGB, s string) string {
+	switch v {
+	case Level16M:
+		return fmt.Sprintf("\x1b[38;2;%d;%d;%dm%s\x1b[0m", c.R, c.G, c.B, s)
+	case Level256:
+		return fmt.Sprintf("\x1b[38;5;%dm%s\x1b[0m", c.ansi256(), s)
+	case Level16:
+		return fmt.Sprintf("\x1b[%dm%s\x1b[0m", c.ansi16(), s)
+	default:
+	}
+	return s
+}
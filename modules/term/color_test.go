@@ -0,0 +1,39 @@
+package term
+
+import (
+	"testing"
+)
+
+func TestPaint(t *testing.T) {
+	tests := []struct {
+		level Level
+		c     RGB
+		want  string
+	}{
+		{Level16M, RGB{63, 247, 166}, "\x1b[38;2;63;247;166mjack\x1b[0m"},
+		{Level256, RGB{63, 247, 166}, "\x1b[38;5;85mjack\x1b[0m"},
+		{Level256, RGB{255, 0, 0}, "\x1b[38;5;196mjack\x1b[0m"},
+		{Level256, RGB{128, 128, 128}, "\x1b[38;5;244mjack\x1b[0m"},
+		{Level16, RGB{63, 247, 166}, "\x1b[36mjack\x1b[0m"},
+		{Level16, RGB{200, 10, 10}, "\x1b[31mjack\x1b[0m"},
+		{LevelNone, RGB{200, 10, 10}, "jack"},
+	}
+	for _, tt := range tests {
+		if got := tt.level.Paint(tt.c, "jack"); got != tt.want {
+			t.Errorf("Level(%d).Paint(%v) = %q, want %q", tt.level, tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestSetColorMode(t *testing.T) {
+	defer detectAuto()
+	if err := SetColorMode("never"); err != nil || StderrLevel != LevelNone || StdoutLevel != LevelNone {
+		t.Fatalf("never: %v %d %d", err, StderrLevel, StdoutLevel)
+	}
+	if err := SetColorMode("always"); err != nil || StderrLevel < Level16 || StdoutLevel < Level16 {
+		t.Fatalf("always: %v %d %d", err, StderrLevel, StdoutLevel)
+	}
+	if err := SetColorMode("sometimes"); err == nil {
+		t.Fatal("sometimes: expected an error")
+	}
+}
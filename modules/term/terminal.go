@@ -1,6 +1,7 @@
 package term
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
@@ -11,12 +12,14 @@ import (
 //
 // The levels are:
 //   - LevelNone: No color support, ANSI codes are stripped
+//   - Level16: the 16 standard ANSI colors
 //   - Level256: 256-color palette support (standard ANSI colors)
 //   - Level16M: 16 million colors (24-bit truecolor/RGB) support
 type Level int
 
 const (
 	LevelNone Level = iota
+	Level16
 	Level256
 	Level16M
 )
@@ -107,10 +110,19 @@ func detectColorLevel() Level {
 	if strings.Contains(termEnv, "256") || strings.Contains(colorTermEnv, "256") {
 		return Level256
 	}
-	return detectColorLevelHijack()
+	if colorLevel := detectColorLevelHijack(); colorLevel != LevelNone {
+		return colorLevel
+	}
+	// xterm, screen, linux console ...
+	if len(termEnv) != 0 && termEnv != "dumb" {
+		return Level16
+	}
+	return LevelNone
 }
 
-func init() {
+// detectAuto sets StderrLevel and StdoutLevel from the environment and whether they are terminals
+func detectAuto() {
+	StderrLevel, StdoutLevel = LevelNone, LevelNone
 	// Detect FORCE_COLOR and override detection
 	if colorLevel, ok := detectForceColor(); ok {
 		StderrLevel = colorLevel
@@ -131,6 +143,29 @@ func init() {
 	}
 }
 
+func init() {
+	detectAuto()
+}
+
+// SetColorMode applies a --color flag:
+//   - auto: detect from FORCE_COLOR, NO_COLOR, the terminal type and whether the output is a terminal
+//   - always: colors even when the output is redirected, at least the 16 standard colors
+//   - never: no colors
+func SetColorMode(mode string) error {
+	switch strings.ToLower(mode) {
+	case "auto", "":
+		detectAuto()
+	case "always":
+		colorLevel := max(detectColorLevel(), Level16)
+		StderrLevel, StdoutLevel = colorLevel, colorLevel
+	case "never":
+		StderrLevel, StdoutLevel = LevelNone, LevelNone
+	default:
+		return fmt.Errorf("invalid color mode '%s', expected auto, always or never", mode)
+	}
+	return nil
+}
+
 // IsTerminal returns true if the given file descriptor is connected to a terminal.
 // This works for both native terminals and Cygwin/MSYS2 pseudo-terminals.
 func IsTerminal(fd uintptr) bool {
@@ -1,46 +1,182 @@
 package trace
 
 import (
-	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/balibuild/bali/v3/modules/term"
 )
 
+// LevelTrace is below slog.LevelDebug: command output, progress and state changes
+const LevelTrace = slog.LevelDebug - 4
+
 var (
-	verbose bool
+	// level of the console handler installed by Setup
+	level = new(slog.LevelVar)
+	// colors of the console handler, downgraded by term.Level on 256 and 16 color terminals
+	colorDebug = term.RGB{R: 254, G: 225, B: 64}
+	colorTrace = term.RGB{R: 128, G: 128, B: 128}
 )
 
-func EnableDebugMode() {
-	verbose = true
+// VerbosityLevel: 0 info, -V debug, -VV and more trace
+func VerbosityLevel(verbosity int) slog.Level {
+	switch {
+	case verbosity <= 0:
+		return slog.LevelInfo
+	case verbosity == 1:
+		return slog.LevelDebug
+	}
+	return LevelTrace
 }
 
-func DbgPrint(format string, args ...any) {
-	if !verbose {
-		return
+// Options of Setup
+type Options struct {
+	Verbosity int        // number of -V
+	LogFile   string     // JSON lines of every level, empty: no log file
+	Console   io.Writer  // usually os.Stderr
+	Color     term.Level // colors of Console
+}
+
+// Setup installs the default slog logger: a colored console handler at the level of the verbosity and,
+// with a log file, a JSON handler receiving every level. The returned logger writes to the log file only,
+// for records the console already shows in another form, it discards them without a log file.
+// Call closeLog before exiting
+func Setup(o *Options) (file *slog.Logger, closeLog func() error, err error) {
+	level.Set(VerbosityLevel(o.Verbosity))
+	console := NewConsoleHandler(o.Console, o.Color, level)
+	if len(o.LogFile) == 0 {
+		slog.SetDefault(slog.New(console))
+		return slog.New(slog.DiscardHandler), func() error { return nil }, nil
+	}
+	fd, err := os.OpenFile(o.LogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open log file: %w", err)
+	}
+	jsonHandler := slog.NewJSONHandler(fd, &slog.HandlerOptions{Level: LevelTrace, ReplaceAttr: replaceLevel})
+	slog.SetDefault(slog.New(slog.NewMultiHandler(console, jsonHandler)))
+	return slog.New(jsonHandler), fd.Close, nil
+}
+
+// replaceLevel names LevelTrace TRACE instead of DEBUG-4
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key == slog.LevelKey && len(groups) == 0 {
+		if l, ok := a.Value.Any().(slog.Level); ok && l <= LevelTrace {
+			a.Value = slog.StringValue("TRACE")
+		}
+	}
+	return a
+}
+
+// ConsoleHandler prints records for humans: errors and warnings prefixed and colored,
+// info as is, debug and trace as '* ' lines. Attributes follow the message as key=value
+type ConsoleHandler struct {
+	w      io.Writer
+	color  term.Level
+	level  slog.Leveler
+	prefix string // group of WithGroup, dot terminated
+	attrs  string // preformatted attributes of WithAttrs
+	mu     *sync.Mutex
+}
+
+// NewConsoleHandler returns a handler writing to w with the colors of color, level nil: slog.LevelInfo
+func NewConsoleHandler(w io.Writer, color term.Level, level slog.Leveler) *ConsoleHandler {
+	if level == nil {
+		level = slog.LevelInfo
 	}
-	message := fmt.Sprintf(format, args...)
-	var buffer bytes.Buffer
-	switch term.StderrLevel {
-	case term.Level16M:
-		for s := range strings.SplitSeq(message, "\n") {
-			_, _ = buffer.WriteString("\x1b[38;2;254;225;64m* ")
-			_, _ = buffer.WriteString(s)
-			_, _ = buffer.WriteString("\x1b[0m\n")
+	return &ConsoleHandler{w: w, color: color, level: level, mu: &sync.Mutex{}}
+}
+
+func (h *ConsoleHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= h.level.Level()
+}
+
+func (h *ConsoleHandler) Handle(_ context.Context, r slog.Record) error {
+	var attrs strings.Builder
+	attrs.WriteString(h.attrs)
+	r.Attrs(func(a slog.Attr) bool {
+		appendAttr(&attrs, h.prefix, a)
+		return true
+	})
+	var sb strings.Builder
+	for line := range strings.SplitSeq(r.Message+attrs.String(), "\n") {
+		switch {
+		case r.Level >= slog.LevelError:
+			sb.WriteString(h.color.Red("error: " + line))
+		case r.Level >= slog.LevelWarn:
+			sb.WriteString(h.color.Yellow("warning: " + line))
+		case r.Level >= slog.LevelInfo:
+			sb.WriteString(line)
+		case r.Level >= slog.LevelDebug:
+			sb.WriteString(h.color.Paint(colorDebug, "* "+line))
+		default:
+			sb.WriteString(h.color.Paint(colorTrace, "* "+line))
 		}
-	case term.Level256:
-		for s := range strings.SplitSeq(message, "\n") {
-			_, _ = buffer.WriteString("\x1b[33m* ")
-			_, _ = buffer.WriteString(s)
-			_, _ = buffer.WriteString("\x1b[0m\n")
+		sb.WriteByte('\n')
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := io.WriteString(h.w, sb.String())
+	return err
+}
+
+func (h *ConsoleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	var sb strings.Builder
+	sb.WriteString(h.attrs)
+	for _, a := range attrs {
+		appendAttr(&sb, h.prefix, a)
+	}
+	h2 := *h
+	h2.attrs = sb.String()
+	return &h2
+}
+
+func (h *ConsoleHandler) WithGroup(name string) slog.Handler {
+	if len(name) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+func appendAttr(sb *strings.Builder, prefix string, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(a.Key) != 0 {
+			prefix += a.Key + "."
 		}
-	default:
-		for s := range strings.SplitSeq(message, "\n") {
-			_, _ = buffer.WriteString(s)
-			_ = buffer.WriteByte('\n')
+		for _, ga := range attrs {
+			appendAttr(sb, prefix, ga)
 		}
+		return
 	}
-	_, _ = os.Stderr.Write(buffer.Bytes())
+	value := a.Value.String()
+	if len(value) == 0 || strings.ContainsFunc(value, func(r rune) bool { return r <= ' ' || r == '"' || r == '=' }) {
+		value = strconv.Quote(value)
+	}
+	sb.WriteString(" " + prefix + a.Key + "=" + value)
+}
+
+// EnableDebugMode lowers the console level to debug
+//
+// Deprecated: use Setup with a verbosity of 1
+func EnableDebugMode() {
+	level.Set(min(level.Level(), slog.LevelDebug))
+}
+
+// DbgPrint logs a debug message with the default logger
+//
+// Deprecated: use slog.Debug
+func DbgPrint(format string, args ...any) {
+	slog.Debug(strings.TrimRight(fmt.Sprintf(format, args...), "\n"))
 }
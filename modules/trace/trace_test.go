@@ -0,0 +1,67 @@
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/balibuild/bali/v3/modules/term"
+)
+
+func TestConsoleHandler(t *testing.T) {
+	var buf bytes.Buffer
+	l := slog.New(NewConsoleHandler(&buf, term.LevelNone, slog.LevelDebug))
+	l.Error("inspect jack.deb", "error", errors.New("not found"))
+	l.Warn("skip", "format", "msi")
+	l.With("crate", "jack").Info("compiled")
+	l.WithGroup("pack").Debug("line 1\nline 2", "format", "tar")
+	l.Log(t.Context(), LevelTrace, "hidden")
+	want := `error: inspect jack.deb error="not found"
+warning: skip format=msi
+compiled crate=jack
+* line 1
+* line 2 pack.format=tar
+`
+	if buf.String() != want {
+		t.Fatalf("console:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestSetupLogFile(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	var console bytes.Buffer
+	logFile := filepath.Join(t.TempDir(), "bali.log")
+	file, closeLog, err := Setup(&Options{LogFile: logFile, Console: &console})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.Debug("env: GOOS=linux")
+	file.Log(t.Context(), LevelTrace, "progress", "written", 42)
+	if err := closeLog(); err != nil {
+		t.Fatal(err)
+	}
+	if console.Len() != 0 {
+		t.Fatalf("console at info level: %q", console.String())
+	}
+	data, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var levels []string
+	for line := range bytes.Lines(data) {
+		var record struct {
+			Level string `json:"level"`
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			t.Fatal(err)
+		}
+		levels = append(levels, record.Level)
+	}
+	if len(levels) != 2 || levels[0] != "DEBUG" || levels[1] != "TRACE" {
+		t.Fatalf("log file levels: %v\n%s", levels, data)
+	}
+}
@@ -0,0 +1,242 @@
+package barrow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"debug/elf"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/balibuild/bali/v3/modules/squashfs"
+)
+
+type AppImageConfig struct {
+	Runtime    string   `toml:"runtime,omitempty"`    // local AppImage type 2 runtime for the target arch, default: $BALI_APPIMAGE_RUNTIME
+	Desktop    string   `toml:"desktop,omitempty"`    // desktop entry, generated when empty
+	Icon       string   `toml:"icon,omitempty"`       // png or svg icon, required
+	Exec       string   `toml:"exec,omitempty"`       // AppRun target relative to the prefix, default: the first crate
+	Categories []string `toml:"categories,omitempty"` // generated desktop entry, default: Utility
+	Terminal   bool     `toml:"terminal,omitempty"`   // generated desktop entry
+}
+
+const (
+	appDirPrefix = "usr"
+)
+
+var (
+	appImageArchs = map[string]struct {
+		name    string
+		machine elf.Machine
+	}{
+		"amd64": {"x86_64", elf.EM_X86_64},
+		"arm64": {"aarch64", elf.EM_AARCH64},
+		"386":   {"i686", elf.EM_386},
+		"arm":   {"armhf", elf.EM_ARM},
+	}
+)
+
+// appImageRuntime checks the runtime is an ELF executable of the target arch
+func (b *BarrowCtx) appImageRuntime(cfg *AppImageConfig) (string, error) {
+	runtime := b.ExpandEnv(nonEmpty(cfg.Runtime, b.Getenv("BALI_APPIMAGE_RUNTIME")))
+	if len(runtime) == 0 {
+		return "", fmt.Errorf("appimage: runtime is not configured, set [appimage] runtime or BALI_APPIMAGE_RUNTIME")
+	}
+	if !filepath.IsAbs(runtime) {
+		runtime = filepath.Join(b.CWD, runtime)
+	}
+	ef, err := elf.Open(runtime)
+	if err != nil {
+		return "", fmt.Errorf("appimage: runtime '%s' is not an ELF executable: %w", runtime, err)
+	}
+	defer ef.Close()
+	if ef.Machine != appImageArchs[b.Arch].machine {
+		return "", fmt.Errorf("appimage: runtime '%s' is built for %s, target arch: %s", runtime, ef.Machine, b.Arch)
+	}
+	return runtime, nil
+}
+
+// desktopIconName returns the Icon key of a desktop entry
+func desktopIconName(data []byte) string {
+	br := bufio.NewScanner(bytes.NewReader(data))
+	for br.Scan() {
+		k, v, ok := strings.Cut(strings.TrimSpace(br.Text()), "=")
+		if ok && strings.TrimSpace(k) == "Icon" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func (b *BarrowCtx) desktopEntry(p *Package, cfg *AppImageConfig, exec string) []byte {
+	categories := cfg.Categories
+	if len(categories) == 0 {
+		categories = []string{"Utility"}
+	}
+	var sb strings.Builder
+	sb.WriteString("[Desktop Entry]\nType=Application\n")
+	fmt.Fprintf(&sb, "Name=%s\n", p.Name)
+	if len(p.Summary) != 0 {
+		fmt.Fprintf(&sb, "Comment=%s\n", p.Summary)
+	}
+	fmt.Fprintf(&sb, "Exec=%s\n", path.Base(exec))
+	fmt.Fprintf(&sb, "Icon=%s\n", p.Name)
+	fmt.Fprintf(&sb, "Categories=%s;\n", strings.Join(categories, ";"))
+	fmt.Fprintf(&sb, "Terminal=%v\n", cfg.Terminal)
+	return []byte(sb.String())
+}
+
+func addStaged2Squashfs(ctx context.Context, w *squashfs.Writer, f *StagedFile) error {
+	name := AsRelativePath(f.Name)
+	switch {
+	case f.Mode&fs.ModeSymlink != 0:
+		return w.AddSymlink(name, ToNixPath(f.Link), f.ModTime)
+	case f.Mode.IsDir():
+		return w.AddDir(name, f.Mode, f.ModTime)
+	}
+	fd, err := os.Open(f.Source)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return w.AddFile(name, f.Mode, f.ModTime, &contextReader{ctx: ctx, r: fd})
+}
+
+// appDirInternal lays out the AppDir: package contents below usr, AppRun, desktop entry and icon at the root
+func (b *BarrowCtx) appDirInternal(ctx context.Context, p *Package, crates []*Crate, cfg *AppImageConfig, w *squashfs.Writer) error {
+	exec := cfg.Exec
+	if len(exec) == 0 {
+		if len(crates) == 0 {
+			return fmt.Errorf("appimage: exec is required when the package has no crates")
+		}
+		exec = path.Join(ToNixPath(crates[0].Destination), b.basename(crates[0].Name))
+	}
+	exec = path.Join(appDirPrefix, AsRelativePath(b.ExpandEnv(exec)))
+	if len(cfg.Icon) == 0 {
+		return fmt.Errorf("appimage: icon is required")
+	}
+	iconExt := strings.ToLower(filepath.Ext(cfg.Icon))
+	if iconExt != ".png" && iconExt != ".svg" {
+		return fmt.Errorf("appimage: icon '%s' must be a png or svg file", cfg.Icon)
+	}
+	desktopName, iconName := p.Name+".desktop", p.Name
+	var desktop []byte
+	if len(cfg.Desktop) != 0 {
+		var err error
+		if desktop, err = os.ReadFile(filepath.Join(b.CWD, cfg.Desktop)); err != nil {
+			return err
+		}
+		if iconName = desktopIconName(desktop); len(iconName) == 0 {
+			return fmt.Errorf("appimage: desktop entry '%s' has no Icon key", cfg.Desktop)
+		}
+		desktopName = filepath.Base(cfg.Desktop)
+	} else {
+		desktop = b.desktopEntry(p, cfg, exec)
+	}
+	now := time.Now()
+	staged, err := b.Stage(p, crates, appDirPrefix)
+	if err != nil {
+		return err
+	}
+	for _, f := range staged {
+		if err := addStaged2Squashfs(ctx, w, f); err != nil {
+			return err
+		}
+	}
+	if err := w.AddSymlink("AppRun", exec, now); err != nil {
+		return err
+	}
+	if err := w.AddFile(desktopName, 0644, now, bytes.NewReader(desktop)); err != nil {
+		return err
+	}
+	icon, err := os.Open(filepath.Join(b.CWD, cfg.Icon))
+	if err != nil {
+		return err
+	}
+	defer icon.Close()
+	if err := w.AddFile(iconName+iconExt, 0644, now, icon); err != nil {
+		return err
+	}
+	return w.AddSymlink(".DirIcon", iconName+iconExt, now)
+}
+
+func (b *BarrowCtx) appimage(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	arch, ok := appImageArchs[b.Arch]
+	if b.Target != "linux" || !ok {
+		return "", fmt.Errorf("appimage is not supported for %s/%s", b.Target, b.Arch)
+	}
+	cfg := p.AppImage
+	if cfg == nil {
+		cfg = &AppImageConfig{}
+	}
+	c, err := b.formatCompression(p, "appimage")
+	if err != nil {
+		return "", err
+	}
+	compression := squashfs.Gzip
+	if c.Method == "zstd" {
+		compression = squashfs.Zstd
+	}
+	runtime, err := b.appImageRuntime(cfg)
+	if err != nil {
+		return "", err
+	}
+	appImageName, err := b.ArtifactName("appimage", p, map[string]string{"arch": arch.name})
+	if err != nil {
+		return "", err
+	}
+	appImagePath := b.destinationPath(appImageName)
+	fd, err := createAtomic(appImagePath, 0755)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Abort()
+	if err := b.appImageInternal(ctx, p, crates, cfg, runtime, compression, fd.File); err != nil {
+		return "", err
+	}
+	// the squashfs superblock is written last, hash the finished file
+	h := sha256.New()
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	if err := fd.Commit(ctx); err != nil {
+		return "", err
+	}
+	b.artifactWritten(appImageName, appImagePath, h)
+	return appImagePath, nil
+}
+
+func (b *BarrowCtx) appImageInternal(ctx context.Context, p *Package, crates []*Crate, cfg *AppImageConfig, runtime string, compression squashfs.Compression, fd *os.File) error {
+	rfd, err := os.Open(runtime)
+	if err != nil {
+		return err
+	}
+	defer rfd.Close()
+	// the runtime locates the image right after its own ELF sections
+	if _, err := io.Copy(fd, rfd); err != nil {
+		return err
+	}
+	w, err := squashfs.NewWriter(fd, &squashfs.Options{Compression: compression, ModTime: time.Now()})
+	if err != nil {
+		return err
+	}
+	if err := b.appDirInternal(ctx, p, crates, cfg, w); err != nil {
+		return err
+	}
+	return w.Close()
+}
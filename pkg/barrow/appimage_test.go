@@ -0,0 +1,87 @@
+package barrow
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/balibuild/bali/v3/modules/squashfs"
+)
+
+func TestAppImage(t *testing.T) {
+	if _, ok := appImageArchs[runtime.GOARCH]; runtime.GOOS != "linux" || !ok {
+		t.Skip("the test binary is used as the AppImage runtime")
+	}
+	b, p, crates := newTestModule(t)
+	b.Arch = runtime.GOARCH
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(b.CWD, "jack.png"), []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p.AppImage = &AppImageConfig{Runtime: exe, Icon: "jack.png", Terminal: true}
+	artifact, err := b.appimage(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	si, err := os.Stat(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd, err := os.Open(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	r, err := squashfs.NewReader(io.NewSectionReader(fd, si.Size(), 1<<40))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := make(map[string]*squashfs.File)
+	for _, f := range r.Files {
+		entries[f.Name] = f
+	}
+	for name, target := range map[string]string{
+		"AppRun":                     "usr/bin/jack",
+		".DirIcon":                   "jack.png",
+		"usr/bin/jack-alias":         "jack",
+		"jack.desktop":               "",
+		"jack.png":                   "",
+		"usr/share/JACK-LICENSE.txt": "",
+	} {
+		f, ok := entries[name]
+		switch {
+		case !ok:
+			t.Errorf("missing %s", name)
+		case len(target) != 0 && (f.Mode&fs.ModeSymlink == 0 || f.Target != target):
+			t.Errorf("%s -> %s, want %s", name, f.Target, target)
+		}
+	}
+	if f := entries["usr/bin/jack"]; f == nil || f.Mode.Perm() != 0755 {
+		t.Errorf("usr/bin/jack: %+v", f)
+	}
+	dr, err := r.Open(entries["jack.desktop"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	desktop, err := io.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"Exec=jack\n", "Icon=jack\n", "Terminal=true\n", "Categories=Utility;\n"} {
+		if !strings.Contains(string(desktop), line) {
+			t.Errorf("desktop entry missing %q:\n%s", line, desktop)
+		}
+	}
+	b.Arch = "riscv64"
+	if _, err := b.appimage(context.Background(), p, crates); err == nil {
+		t.Errorf("appimage built for an unsupported arch")
+	}
+}
@@ -0,0 +1,471 @@
+package barrow
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/andybalholm/brotli"
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Entry: a file, directory or symlink stored in an artifact
+type Entry struct {
+	Path     string      `json:"path"` // slash separated, relative to the archive root
+	Mode     fs.FileMode `json:"mode"`
+	Owner    string      `json:"owner,omitempty"`
+	Group    string      `json:"group,omitempty"`
+	Size     int64       `json:"size"`
+	Linkname string      `json:"linkname,omitempty"` // symlink target
+	Digest   string      `json:"digest,omitempty"`   // sha256 of regular file contents
+	md5      string
+}
+
+// Artifact: the parsed contents of a produced package
+type Artifact struct {
+	Path       string            `json:"path"`
+	Format     string            `json:"format"`               // zip, tar, sh, rpm, deb, apk, arch, msi, exe
+	Metadata   map[string]string `json:"metadata,omitempty"`   // name, version, release, arch, license ...
+	Signatures []string          `json:"signatures,omitempty"` // rpm: signature tags, deb: _gpg members, apk: .SIGN. files, msi/exe: authenticode
+	Entries    []*Entry          `json:"entries"`
+	MD5Sums    map[string]string `json:"-"` // deb: control md5sums
+}
+
+var (
+	ErrUnknownArtifact = errors.New("unknown artifact format")
+)
+
+var (
+	rpmLeadMagic = []byte{0xed, 0xab, 0xee, 0xdb}
+	arMagic      = []byte("!<arch>\n")
+	zipMagic     = []byte("PK\x03\x04")
+	cfbMagic     = []byte{0xd0, 0xcf, 0x11, 0xe0, 0xa1, 0xb1, 0x1a, 0xe1}
+	peMagic      = []byte("MZ")
+)
+
+// DetectArtifactFormat detects the pack format of a produced artifact by its name and magic
+func DetectArtifactFormat(name string) (string, error) {
+	base := strings.ToLower(filepath.Base(name))
+	switch {
+	case strings.HasSuffix(base, ".rpm"):
+		return "rpm", nil
+	case strings.HasSuffix(base, ".deb"):
+		return "deb", nil
+	case strings.HasSuffix(base, ".apk"):
+		return "apk", nil
+	case strings.HasSuffix(base, ".pkg.tar.zst"):
+		return "arch", nil
+	case strings.HasSuffix(base, ".msi"):
+		return "msi", nil
+	case strings.HasSuffix(base, ".exe"):
+		return "exe", nil
+	case strings.HasSuffix(base, ".zip"):
+		return "zip", nil
+	case strings.HasSuffix(base, ".sh"):
+		return "sh", nil
+	case strings.Contains(base, ".tar"):
+		return "tar", nil
+	}
+	fd, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	magic := make([]byte, 8)
+	n, _ := io.ReadFull(fd, magic)
+	magic = magic[:n]
+	switch {
+	case bytes.HasPrefix(magic, rpmLeadMagic):
+		return "rpm", nil
+	case bytes.HasPrefix(magic, arMagic):
+		return "deb", nil
+	case bytes.HasPrefix(magic, zipMagic):
+		return "zip", nil
+	case bytes.HasPrefix(magic, cfbMagic):
+		return "msi", nil
+	case bytes.HasPrefix(magic, peMagic):
+		return "exe", nil
+	}
+	return "", fmt.Errorf("%s: %w", name, ErrUnknownArtifact)
+}
+
+// OpenArtifact parses a produced artifact back into its metadata and entries
+func OpenArtifact(name string) (*Artifact, error) {
+	format, err := DetectArtifactFormat(name)
+	if err != nil {
+		return nil, err
+	}
+	a := &Artifact{
+		Path:     name,
+		Format:   format,
+		Metadata: make(map[string]string),
+	}
+	switch format {
+	case "zip":
+		err = a.readZip()
+	case "tar":
+		err = a.readTarFile()
+	case "sh":
+		err = a.readSh()
+	case "rpm":
+		err = a.readRPM()
+	case "deb":
+		err = a.readDeb()
+	case "apk", "arch":
+		err = a.readPkgInfoTar()
+	case "msi":
+		err = a.readMsi()
+	case "exe":
+		err = a.readExe()
+	default:
+		err = fmt.Errorf("%s: %w", name, ErrUnknownArtifact)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read %s artifact %s error: %w", format, filepath.Base(name), err)
+	}
+	return a, nil
+}
+
+// Lookup returns the entry with the given path
+func (a *Artifact) Lookup(name string) *Entry {
+	name = cleanEntryPath(name)
+	for _, e := range a.Entries {
+		if e.Path == name {
+			return e
+		}
+	}
+	return nil
+}
+
+func cleanEntryPath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+}
+
+type digestWriter struct {
+	sha256 hashWriter
+	md5    hashWriter
+}
+
+type hashWriter interface {
+	io.Writer
+	Sum([]byte) []byte
+}
+
+func newDigestWriter() *digestWriter {
+	return &digestWriter{sha256: sha256.New(), md5: md5.New()}
+}
+
+func (d *digestWriter) Write(p []byte) (int, error) {
+	_, _ = d.sha256.Write(p)
+	return d.md5.Write(p)
+}
+
+func (d *digestWriter) apply(e *Entry) {
+	e.Digest = hex.EncodeToString(d.sha256.Sum(nil))
+	e.md5 = hex.EncodeToString(d.md5.Sum(nil))
+}
+
+func (a *Artifact) readZip() error {
+	zr, err := zip.OpenReader(a.Path)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	if len(zr.Comment) != 0 {
+		a.Metadata["summary"] = zr.Comment
+	}
+	for _, f := range zr.File {
+		e := &Entry{
+			Path: cleanEntryPath(f.Name),
+			Mode: f.Mode(),
+			Size: int64(f.UncompressedSize64),
+		}
+		if e.Path == "" {
+			continue
+		}
+		if e.Mode.IsDir() {
+			a.Entries = append(a.Entries, e)
+			continue
+		}
+		if err := readZipFile(f, e); err != nil {
+			return fmt.Errorf("read %s error: %w", f.Name, err)
+		}
+		a.Entries = append(a.Entries, e)
+	}
+	return nil
+}
+
+func readZipFile(f *zip.File, e *Entry) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if e.Mode&fs.ModeSymlink != 0 {
+		target, err := io.ReadAll(io.LimitReader(r, 4096))
+		if err != nil {
+			return err
+		}
+		e.Linkname = string(target)
+		return nil
+	}
+	d := newDigestWriter()
+	if _, err := io.Copy(d, r); err != nil {
+		return err
+	}
+	d.apply(e)
+	return nil
+}
+
+// newDecompressor detects the compression of a stream by its magic, brotli has no magic
+func newDecompressor(br *bufio.Reader, name string, brotliFallback bool) (io.ReadCloser, error) {
+	magic, _ := br.Peek(262)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		xr, err := xz.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(xr), nil
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return zr.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, []byte("BZh")):
+		return bzip2.NewReader(br, nil)
+	case len(magic) >= 262 && string(magic[257:262]) == "ustar":
+		return io.NopCloser(br), nil
+	case brotliFallback:
+		return io.NopCloser(brotli.NewReader(br)), nil
+	}
+	return nil, fmt.Errorf("%s: unsupported compression", name)
+}
+
+func (a *Artifact) readTarFile() error {
+	fd, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	name := filepath.Base(a.Path)
+	return a.readCompressedTar(bufio.NewReader(fd), name, strings.HasSuffix(name, ".br"), nil)
+}
+
+const (
+	shArchiveMarker = "__ARCHIVE_BELOW__\n"
+)
+
+// readSh: the self-extracting installer is resources/template.sh followed by a compressed tar
+func (a *Artifact) readSh() error {
+	fd, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	br := bufio.NewReader(fd)
+	for {
+		line, err := br.ReadString('\n')
+		if line == shArchiveMarker {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("archive marker %q not found", strings.TrimSpace(shArchiveMarker))
+		}
+		if strings.HasPrefix(line, "#!") {
+			a.Metadata["interpreter"] = strings.TrimSpace(strings.TrimPrefix(line, "#!"))
+		}
+	}
+	return a.readCompressedTar(br, filepath.Base(a.Path), true, nil)
+}
+
+// tarSpecial handles control files, returns true when the entry is consumed
+type tarSpecial func(hdr *tar.Header, r io.Reader) (bool, error)
+
+func (a *Artifact) readCompressedTar(br *bufio.Reader, name string, brotliFallback bool, special tarSpecial) error {
+	dr, err := newDecompressor(br, name, brotliFallback)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+	return a.readTar(dr, special)
+}
+
+func (a *Artifact) readTar(r io.Reader, special tarSpecial) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if special != nil {
+			ok, err := special(hdr, tr)
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+		}
+		e := &Entry{
+			Path:     cleanEntryPath(hdr.Name),
+			Mode:     hdr.FileInfo().Mode(),
+			Owner:    nonEmpty(hdr.Uname, strconv.Itoa(hdr.Uid)),
+			Group:    nonEmpty(hdr.Gname, strconv.Itoa(hdr.Gid)),
+			Size:     hdr.Size,
+			Linkname: hdr.Linkname,
+		}
+		if e.Path == "" {
+			continue
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			d := newDigestWriter()
+			if _, err := io.Copy(d, tr); err != nil {
+				return err
+			}
+			d.apply(e)
+		}
+		a.Entries = append(a.Entries, e)
+	}
+}
+
+// parseKeyValues: .PKGINFO 'key = value' lines
+func parseKeyValues(r io.Reader, fn func(k, v string)) error {
+	br := bufio.NewScanner(r)
+	for br.Scan() {
+		line := strings.TrimSpace(br.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		fn(strings.TrimSpace(k), strings.TrimSpace(v))
+	}
+	return br.Err()
+}
+
+var (
+	pkgInfoKeys = map[string]string{
+		"pkgname":    "name",
+		"pkgdesc":    "description",
+		"url":        "homepage",
+		"arch":       "arch",
+		"license":    "license",
+		"maintainer": "maintainer",
+		"packager":   "packager",
+	}
+)
+
+// readPkgInfoTar: apk (concatenated gzip tar streams) and arch (tar.zst), both carry a .PKGINFO
+func (a *Artifact) readPkgInfoTar() error {
+	fd, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return a.readCompressedTar(bufio.NewReader(fd), filepath.Base(a.Path), false, func(hdr *tar.Header, r io.Reader) (bool, error) {
+		name := cleanEntryPath(hdr.Name)
+		switch {
+		case name == ".PKGINFO":
+			return true, parseKeyValues(r, func(k, v string) {
+				if k == "pkgver" {
+					version, release := splitRelease(v)
+					a.Metadata["version"] = version
+					a.Metadata["release"] = strings.TrimPrefix(release, "r")
+					return
+				}
+				if key, ok := pkgInfoKeys[k]; ok {
+					a.Metadata[key] = v
+				}
+			})
+		case strings.HasPrefix(name, ".SIGN."):
+			a.Signatures = append(a.Signatures, name)
+			return true, nil
+		case name == ".MTREE", name == ".BUILDINFO", name == ".INSTALL":
+			return true, nil
+		}
+		return false, nil
+	})
+}
+
+// splitRelease: 1.0.0-1 --> 1.0.0, 1
+func splitRelease(v string) (string, string) {
+	if i := strings.LastIndexByte(v, '-'); i != -1 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
+
+func entryModeString(m fs.FileMode) string {
+	s := m.String()
+	if strings.HasPrefix(s, "L") {
+		return "l" + s[1:] // like ls -l
+	}
+	return s
+}
+
+// WriteTable writes the package metadata and a `tar -tv` style listing of the entries
+func (a *Artifact) WriteTable(w io.Writer) error {
+	keys := make([]string, 0, len(a.Metadata))
+	for k := range a.Metadata {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "artifact:\t%s\n", filepath.Base(a.Path))
+	fmt.Fprintf(tw, "format:\t%s\n", a.Format)
+	for _, k := range keys {
+		v, _, _ := strings.Cut(a.Metadata[k], "\n")
+		fmt.Fprintf(tw, "%s:\t%s\n", k, v)
+	}
+	if pk, ok := LookupPackager(a.Format); ok && pk.Capabilities().Signing {
+		fmt.Fprintf(tw, "signed:\t%s\n", nonEmpty(strings.Join(a.Signatures, ", "), "no"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "MODE\tOWNER\tSIZE\t PATH\n")
+	for _, e := range a.Entries {
+		owner := "-"
+		if len(e.Owner) != 0 || len(e.Group) != 0 {
+			owner = nonEmpty(e.Owner, "-") + "/" + nonEmpty(e.Group, "-")
+		}
+		name := e.Path
+		if e.Mode.IsDir() {
+			name += "/"
+		}
+		if len(e.Linkname) != 0 {
+			name += " -> " + e.Linkname
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t %s\n", entryModeString(e.Mode), owner, e.Size, name)
+	}
+	return tw.Flush()
+}
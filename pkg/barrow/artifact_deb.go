@@ -0,0 +1,162 @@
+package barrow
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	arHeaderSize = 60
+)
+
+var (
+	debControlKeys = map[string]string{
+		"Package":      "name",
+		"Architecture": "arch",
+		"Maintainer":   "maintainer",
+		"Vendor":       "vendor",
+		"Homepage":     "homepage",
+		"Section":      "group",
+	}
+)
+
+// readDeb: ar archive with debian-binary, control.tar.* and data.tar.*
+func (a *Artifact) readDeb() error {
+	fd, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	br := bufio.NewReader(fd)
+	magic := make([]byte, len(arMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return err
+	}
+	if !bytes.Equal(magic, arMagic) {
+		return fmt.Errorf("bad ar magic")
+	}
+	var hasData bool
+	hdr := make([]byte, arHeaderSize)
+	for {
+		if _, err := io.ReadFull(br, hdr); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(string(hdr[0:16])), "/")
+		size, err := strconv.ParseInt(strings.TrimSpace(string(hdr[48:58])), 10, 64)
+		if err != nil {
+			return fmt.Errorf("bad ar member %s size: %w", name, err)
+		}
+		member := bufio.NewReader(io.LimitReader(br, size))
+		switch {
+		case name == "debian-binary":
+			version, _ := io.ReadAll(member)
+			a.Metadata["deb-format"] = strings.TrimSpace(string(version))
+		case strings.HasPrefix(name, "control.tar"):
+			if err := a.readCompressedTar(member, name, false, a.debControl); err != nil {
+				return fmt.Errorf("read %s error: %w", name, err)
+			}
+		case strings.HasPrefix(name, "_gpg"):
+			// debsigs signatures
+			a.Signatures = append(a.Signatures, name)
+		case strings.HasPrefix(name, "data.tar"):
+			hasData = true
+			if err := a.readCompressedTar(member, name, false, nil); err != nil {
+				return fmt.Errorf("read %s error: %w", name, err)
+			}
+		}
+		// skip unread data and padding
+		if _, err := io.Copy(io.Discard, member); err != nil {
+			return err
+		}
+		if size%2 != 0 {
+			if _, err := br.Discard(1); err != nil && err != io.EOF {
+				return err
+			}
+		}
+	}
+	if !hasData {
+		return fmt.Errorf("data.tar not found")
+	}
+	return nil
+}
+
+func (a *Artifact) debControl(hdr *tar.Header, r io.Reader) (bool, error) {
+	switch cleanEntryPath(hdr.Name) {
+	case "control":
+		return true, parseDebControl(r, func(k, v string) {
+			switch k {
+			case "Version":
+				version, release := splitRelease(v)
+				a.Metadata["version"] = version
+				a.Metadata["release"] = release
+			case "Description":
+				summary, description, _ := strings.Cut(v, "\n")
+				a.Metadata["summary"] = summary
+				if len(description) != 0 {
+					a.Metadata["description"] = description
+				}
+			default:
+				if key, ok := debControlKeys[k]; ok && len(v) != 0 {
+					a.Metadata[key] = v
+				}
+			}
+		})
+	case "md5sums":
+		a.MD5Sums = make(map[string]string)
+		br := bufio.NewScanner(r)
+		for br.Scan() {
+			sum, name, ok := strings.Cut(strings.TrimSpace(br.Text()), " ")
+			if !ok {
+				continue
+			}
+			a.MD5Sums[cleanEntryPath(strings.TrimSpace(name))] = sum
+		}
+		return true, br.Err()
+	}
+	// conffiles, maintainer scripts ...
+	return true, nil
+}
+
+// parseDebControl: RFC 822 style fields, continuation lines start with a space
+func parseDebControl(r io.Reader, fn func(k, v string)) error {
+	br := bufio.NewScanner(r)
+	var key string
+	var value strings.Builder
+	flush := func() {
+		if len(key) != 0 {
+			fn(key, value.String())
+		}
+		key = ""
+		value.Reset()
+	}
+	for br.Scan() {
+		line := br.Text()
+		if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+			line = strings.TrimSpace(line)
+			if line == "." {
+				line = ""
+			}
+			value.WriteByte('\n')
+			value.WriteString(line)
+			continue
+		}
+		flush()
+		k, v, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(k)
+		value.WriteString(strings.TrimSpace(v))
+	}
+	flush()
+	return br.Err()
+}
@@ -0,0 +1,26 @@
+package barrow
+
+import (
+	"debug/pe"
+)
+
+// readExe: the installer stub is followed by the zip payload, zip offsets include the stub
+func (a *Artifact) readExe() error {
+	f, err := pe.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// the certificate table of signtool is referenced by the security data directory
+	var security pe.DataDirectory
+	switch h := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		security = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+	case *pe.OptionalHeader64:
+		security = h.DataDirectory[pe.IMAGE_DIRECTORY_ENTRY_SECURITY]
+	}
+	if security.Size != 0 {
+		a.Signatures = append(a.Signatures, "authenticode")
+	}
+	return a.readZip()
+}
@@ -0,0 +1,44 @@
+package barrow
+
+import (
+	"os"
+	"strings"
+
+	"github.com/balibuild/bali/v3/modules/cfb"
+	"github.com/balibuild/bali/v3/modules/msi"
+)
+
+const (
+	msiDigitalSignature = "\x05DigitalSignature"
+)
+
+// readMsi: the streams of the compound file, files stay in the cabinet stream
+func (a *Artifact) readMsi() error {
+	fd, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	si, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	r, err := cfb.NewReader(fd, si.Size())
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for _, e := range r.Entries {
+		if e.Name == msiDigitalSignature {
+			a.Signatures = append(a.Signatures, "authenticode")
+		}
+		name, table := msi.DecodeStreamName(e.Name)
+		if table {
+			tables = append(tables, name)
+			continue
+		}
+		a.Entries = append(a.Entries, &Entry{Path: strings.TrimLeft(name, "\x05"), Mode: 0644, Size: e.Size})
+	}
+	a.Metadata["tables"] = strings.Join(tables, " ")
+	return nil
+}
@@ -0,0 +1,285 @@
+package barrow
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+)
+
+// https://rpm-software-management.github.io/rpm/manual/format.html
+
+const (
+	rpmLeadSize = 96
+	// header tags
+	rpmTagName              = 1000
+	rpmTagVersion           = 1001
+	rpmTagRelease           = 1002
+	rpmTagSummary           = 1004
+	rpmTagDescription       = 1005
+	rpmTagBuildHost         = 1007
+	rpmTagVendor            = 1011
+	rpmTagLicense           = 1014
+	rpmTagPackager          = 1015
+	rpmTagGroup             = 1016
+	rpmTagURL               = 1020
+	rpmTagArch              = 1022
+	rpmTagFileSizes         = 1028
+	rpmTagFileModes         = 1030
+	rpmTagFileDigests       = 1035
+	rpmTagFileLinkTos       = 1036
+	rpmTagFileUserName      = 1039
+	rpmTagFileGroupName     = 1040
+	rpmTagDirIndexes        = 1116
+	rpmTagBasenames         = 1117
+	rpmTagDirNames          = 1118
+	rpmTagPayloadCompressor = 1125
+	rpmTagLongFileSizes     = 5008
+	// signature header tags
+	rpmSigDSA = 267
+	rpmSigRSA = 268
+	rpmSigPGP = 1002
+	rpmSigGPG = 1005
+	// header types
+	rpmTypeInt16       = 3
+	rpmTypeInt32       = 4
+	rpmTypeInt64       = 5
+	rpmTypeString      = 6
+	rpmTypeStringArray = 8
+	rpmTypeI18NString  = 9
+)
+
+var (
+	rpmHeaderMagic   = []byte{0x8e, 0xad, 0xe8, 0x01}
+	rpmSignatureTags = []struct {
+		tag  int
+		name string
+	}{
+		{rpmSigRSA, "rsa"},
+		{rpmSigDSA, "dsa"},
+		{rpmSigPGP, "pgp"},
+		{rpmSigGPG, "gpg"},
+	}
+	rpmMetadataTag = map[int]string{
+		rpmTagName:              "name",
+		rpmTagVersion:           "version",
+		rpmTagRelease:           "release",
+		rpmTagSummary:           "summary",
+		rpmTagDescription:       "description",
+		rpmTagBuildHost:         "buildhost",
+		rpmTagVendor:            "vendor",
+		rpmTagLicense:           "license",
+		rpmTagPackager:          "packager",
+		rpmTagGroup:             "group",
+		rpmTagURL:               "homepage",
+		rpmTagArch:              "arch",
+		rpmTagPayloadCompressor: "compressor",
+	}
+)
+
+type rpmIndexEntry struct {
+	tag    int
+	typ    int
+	offset int
+	count  int
+}
+
+type rpmHeader struct {
+	entries map[int]rpmIndexEntry
+	store   []byte
+}
+
+func readRPMHeader(r io.Reader, pad bool) (*rpmHeader, error) {
+	intro := make([]byte, 16)
+	if _, err := io.ReadFull(r, intro); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(intro[:4], rpmHeaderMagic) {
+		return nil, fmt.Errorf("bad rpm header magic")
+	}
+	nindex := int(binary.BigEndian.Uint32(intro[8:12]))
+	hsize := int(binary.BigEndian.Uint32(intro[12:16]))
+	if nindex > 1<<16 || hsize > 256<<20 {
+		return nil, fmt.Errorf("rpm header too large: %d entries %d bytes", nindex, hsize)
+	}
+	index := make([]byte, nindex*16)
+	if _, err := io.ReadFull(r, index); err != nil {
+		return nil, err
+	}
+	h := &rpmHeader{entries: make(map[int]rpmIndexEntry, nindex), store: make([]byte, hsize)}
+	if _, err := io.ReadFull(r, h.store); err != nil {
+		return nil, err
+	}
+	for i := range nindex {
+		b := index[i*16:]
+		e := rpmIndexEntry{
+			tag:    int(binary.BigEndian.Uint32(b[0:4])),
+			typ:    int(binary.BigEndian.Uint32(b[4:8])),
+			offset: int(binary.BigEndian.Uint32(b[8:12])),
+			count:  int(binary.BigEndian.Uint32(b[12:16])),
+		}
+		if e.offset > hsize {
+			return nil, fmt.Errorf("rpm tag %d offset out of range", e.tag)
+		}
+		h.entries[e.tag] = e
+	}
+	if pad {
+		// signature header is aligned to 8 bytes
+		if n := (8 - hsize%8) % 8; n != 0 {
+			if _, err := io.CopyN(io.Discard, r, int64(n)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return h, nil
+}
+
+func (h *rpmHeader) strings(tag int) []string {
+	e, ok := h.entries[tag]
+	if !ok || (e.typ != rpmTypeString && e.typ != rpmTypeStringArray && e.typ != rpmTypeI18NString) {
+		return nil
+	}
+	values := make([]string, 0, e.count)
+	b := h.store[e.offset:]
+	for range e.count {
+		i := bytes.IndexByte(b, 0)
+		if i == -1 {
+			break
+		}
+		values = append(values, string(b[:i]))
+		b = b[i+1:]
+	}
+	return values
+}
+
+func (h *rpmHeader) ints(tag int) []int64 {
+	e, ok := h.entries[tag]
+	if !ok {
+		return nil
+	}
+	var size int
+	switch e.typ {
+	case rpmTypeInt16:
+		size = 2
+	case rpmTypeInt32:
+		size = 4
+	case rpmTypeInt64:
+		size = 8
+	default:
+		return nil
+	}
+	b := h.store[e.offset:]
+	if len(b) < size*e.count {
+		return nil
+	}
+	values := make([]int64, 0, e.count)
+	for i := range e.count {
+		switch size {
+		case 2:
+			values = append(values, int64(binary.BigEndian.Uint16(b[i*2:])))
+		case 4:
+			values = append(values, int64(binary.BigEndian.Uint32(b[i*4:])))
+		default:
+			values = append(values, int64(binary.BigEndian.Uint64(b[i*8:])))
+		}
+	}
+	return values
+}
+
+// rpmFileMode converts a st_mode to fs.FileMode
+func rpmFileMode(m int64) fs.FileMode {
+	mode := fs.FileMode(m & 0o777)
+	switch m & 0o170000 {
+	case 0o040000:
+		mode |= fs.ModeDir
+	case 0o120000:
+		mode |= fs.ModeSymlink
+	}
+	if m&0o4000 != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if m&0o2000 != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if m&0o1000 != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
+
+// readRPM: metadata and file list come from the main header, the payload is not decompressed
+func (a *Artifact) readRPM() error {
+	fd, err := os.Open(a.Path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	lead := make([]byte, rpmLeadSize)
+	if _, err := io.ReadFull(fd, lead); err != nil {
+		return err
+	}
+	if !bytes.Equal(lead[:4], rpmLeadMagic) {
+		return fmt.Errorf("bad rpm lead magic")
+	}
+	sig, err := readRPMHeader(fd, true)
+	if err != nil {
+		return fmt.Errorf("read signature header error: %w", err)
+	}
+	for _, s := range rpmSignatureTags {
+		if _, ok := sig.entries[s.tag]; ok {
+			a.Signatures = append(a.Signatures, s.name)
+		}
+	}
+	h, err := readRPMHeader(fd, false)
+	if err != nil {
+		return fmt.Errorf("read header error: %w", err)
+	}
+	for tag, key := range rpmMetadataTag {
+		if v := h.strings(tag); len(v) != 0 {
+			a.Metadata[key] = v[0]
+		}
+	}
+	basenames := h.strings(rpmTagBasenames)
+	dirnames := h.strings(rpmTagDirNames)
+	dirindexes := h.ints(rpmTagDirIndexes)
+	modes := h.ints(rpmTagFileModes)
+	sizes := h.ints(rpmTagLongFileSizes)
+	if len(sizes) == 0 {
+		sizes = h.ints(rpmTagFileSizes)
+	}
+	linktos := h.strings(rpmTagFileLinkTos)
+	digests := h.strings(rpmTagFileDigests)
+	owners := h.strings(rpmTagFileUserName)
+	groups := h.strings(rpmTagFileGroupName)
+	if len(dirindexes) != len(basenames) || len(modes) != len(basenames) {
+		return fmt.Errorf("rpm file list is inconsistent")
+	}
+	at := func(values []string, i int) string {
+		if i < len(values) {
+			return values[i]
+		}
+		return ""
+	}
+	for i, base := range basenames {
+		di := int(dirindexes[i])
+		if di >= len(dirnames) {
+			return fmt.Errorf("rpm dir index %d out of range", di)
+		}
+		e := &Entry{
+			Path:     cleanEntryPath(path.Join(dirnames[di], base)),
+			Mode:     rpmFileMode(modes[i]),
+			Owner:    at(owners, i),
+			Group:    at(groups, i),
+			Linkname: at(linktos, i),
+			Digest:   at(digests, i),
+		}
+		if i < len(sizes) {
+			e.Size = sizes[i]
+		}
+		a.Entries = append(a.Entries, e)
+	}
+	return nil
+}
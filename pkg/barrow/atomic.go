@@ -0,0 +1,85 @@
+package barrow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// atomicFile: an artifact is written to a temporary file beside it and renamed over it by Commit,
+// a failed or cancelled build never leaves a truncated artifact in Destination
+type atomicFile struct {
+	*os.File
+	path      string
+	committed bool
+}
+
+func createAtomic(path string, perm os.FileMode) (*atomicFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	fd, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := fd.Chmod(perm); err != nil {
+		_ = fd.Close()
+		_ = os.Remove(fd.Name())
+		return nil, err
+	}
+	return &atomicFile{File: fd, path: path}, nil
+}
+
+// Commit flushes the temporary file to disk and renames it to the artifact path
+func (f *atomicFile) Commit(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		return err
+	}
+	f.committed = true
+	return syncDir(filepath.Dir(f.path))
+}
+
+// syncDir flushes the rename to disk, Windows cannot open directories for Sync
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	return fd.Sync()
+}
+
+// Abort removes the temporary file unless it was committed, safe to defer
+func (f *atomicFile) Abort() {
+	if f.committed {
+		return
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
+
+// writeFileAtomic: os.WriteFile through a temporary file
+func writeFileAtomic(ctx context.Context, path string, data []byte, perm os.FileMode) error {
+	fd, err := createAtomic(path, perm)
+	if err != nil {
+		return err
+	}
+	defer fd.Abort()
+	if _, err := fd.Write(data); err != nil {
+		return err
+	}
+	return fd.Commit(ctx)
+}
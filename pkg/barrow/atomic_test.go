@@ -0,0 +1,140 @@
+package barrow
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "jack.tar.gz")
+	if err := os.WriteFile(dest, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	fd, err := createAtomic(dest, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Abort()
+	if _, err := fd.Write([]byte("truncated")); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err := fd.Commit(ctx); err == nil {
+		t.Fatal("commit after cancel succeeded")
+	}
+	fd.Abort()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("temporary file left behind: %v", entries)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "previous" {
+		t.Fatalf("artifact replaced by a cancelled build: %q", data)
+	}
+	if err := writeFileAtomic(context.Background(), dest, []byte("next"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(dest); string(data) != "next" {
+		t.Fatalf("artifact not replaced: %q", data)
+	}
+	// Destination below a regular file cannot be created
+	var pe *os.PathError
+	if _, err := createAtomic(filepath.Join(dest, "jack.zip"), 0644); !errors.As(err, &pe) || pe.Op != "mkdir" {
+		t.Fatalf("create below a file: %v", err)
+	}
+}
+
+func TestAtomicArtifactFailure(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	if err := os.Remove(filepath.Join(b.Out, "bin/jack")); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for format, pack := range map[string]func(context.Context, *Package, []*Crate) (string, error){
+		"zip":  b.zip,
+		"tar":  b.tar,
+		"sh":   b.sh,
+		"rpm":  b.rpm,
+		"deb":  b.deb,
+		"apk":  b.apk,
+		"arch": b.archLinux,
+	} {
+		if _, err := pack(ctx, p, crates); err == nil {
+			t.Fatalf("pack %s without the crate succeeded", format)
+		}
+	}
+	entries, _ := os.ReadDir(b.Destination)
+	for _, e := range entries {
+		t.Errorf("failed builds left %s in Destination", e.Name())
+	}
+}
+
+// cancelAfter cancels the build on the first write
+type cancelAfter struct {
+	cancel context.CancelFunc
+}
+
+func (c *cancelAfter) Write(p []byte) (int, error) {
+	c.cancel()
+	return len(p), nil
+}
+
+func TestCancelledCopy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	src := strings.NewReader(strings.Repeat("jack", 64*1024))
+	if _, err := copyContext(ctx, &cancelAfter{cancel: cancel}, src); !errors.Is(err, context.Canceled) {
+		t.Fatalf("copy after cancel: %v", err)
+	}
+	if src.Len() == 0 {
+		t.Fatal("copy did not stop after cancel")
+	}
+	b, p, crates := newTestModule(t)
+	for format, pack := range map[string]func(context.Context, *Package, []*Crate) (string, error){
+		"zip": b.zip,
+		"tar": b.tar,
+		"rpm": b.rpm,
+		"deb": b.deb,
+	} {
+		if _, err := pack(ctx, p, crates); !errors.Is(err, context.Canceled) {
+			t.Fatalf("pack %s after cancel: %v", format, err)
+		}
+	}
+	entries, _ := os.ReadDir(b.Destination)
+	for _, e := range entries {
+		t.Errorf("cancelled builds left %s in Destination", e.Name())
+	}
+}
+
+func TestCancelledWriteArtifact(t *testing.T) {
+	b, _, _ := newTestModule(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var writes int
+	_, err := b.WriteArtifact(ctx, "jack.bin", 0644, func(w io.Writer) error {
+		// a library writing its whole output without looking at ctx
+		for range 16 {
+			if _, err := w.Write([]byte("jack")); err != nil {
+				return err
+			}
+			writes++
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || writes != 1 {
+		t.Fatalf("write after cancel: %v, %d writes", err, writes)
+	}
+	if entries, _ := os.ReadDir(b.Destination); len(entries) != 0 {
+		t.Fatalf("cancelled artifact left in Destination: %v", entries)
+	}
+}
@@ -13,8 +13,6 @@ import (
 	"strings"
 	"time"
 	"unicode"
-
-	"github.com/balibuild/bali/v3/modules/trace"
 )
 
 type BarrowCtx struct {
@@ -24,11 +22,14 @@ type BarrowCtx struct {
 	Arch        string
 	Release     string
 	Destination string
-	Pack        []string // supported: zip, tar, sh, rpm
+	Pack        []string // registered pack formats, see PackagerNames
 	Compression string
+	Timeout     time.Duration // bounds the whole Run, zero: no limit
 	Verbose     bool
+	Logger      Logger // receives the build events, nil: none
 	extraEnv    map[string]string
 	environ     []string
+	written     []*ArtifactFile // files written by the running packager
 	// TODO signature
 }
 
@@ -66,17 +67,17 @@ func resolveGoVersion(ctx context.Context) (version string, host string) {
 	return
 }
 
-func isDistSupported(ctx context.Context, target, arch string) bool {
+func (b *BarrowCtx) isDistSupported(ctx context.Context, target, arch string) bool {
 	distName := target + "/" + arch
 	cmd := exec.CommandContext(ctx, "go", "tool", "dist", "list")
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "check dist is supported error: %v\n", err)
+		b.warnf("check dist is supported error: %v", err)
 		return false
 	}
 	defer stdout.Close()
 	if err := cmd.Start(); err != nil {
-		fmt.Fprintf(os.Stderr, "check dist is supported error: %v\n", err)
+		b.warnf("check dist is supported error: %v", err)
 		return false
 	}
 	defer cmd.Wait()
@@ -141,15 +142,25 @@ func (b *BarrowCtx) prepareReleaseEnv() {
 
 func (b *BarrowCtx) Initialize(ctx context.Context) error {
 	version, host := resolveGoVersion(ctx)
-	if !isDistSupported(ctx, b.Target, b.Arch) {
-		fmt.Fprintf(os.Stderr, "golang %s (dist: %s) not support: %s/%s\n", version, host, b.Target, b.Arch)
-		return errors.New("dist not supported")
+	if b.Arch == ArchUniversal {
+		if b.Target != "darwin" {
+			return fmt.Errorf("%w: arch '%s' is only supported by darwin, current target: %s", ErrUnsupportedTarget, ArchUniversal, b.Target)
+		}
+		for _, arch := range universalArchs {
+			if !b.isDistSupported(ctx, b.Target, arch) {
+				return fmt.Errorf("%w: go %s (dist: %s) does not support %s/%s", ErrUnsupportedTarget, version, host, b.Target, arch)
+			}
+		}
+	} else if !b.isDistSupported(ctx, b.Target, b.Arch) {
+		return fmt.Errorf("%w: go %s (dist: %s) does not support %s/%s", ErrUnsupportedTarget, version, host, b.Target, b.Arch)
 	}
 	b.extraEnv = make(map[string]string)
 	b.extraEnv["BUILD_GOVERSION"] = version
 	b.extraEnv["BUILD_HOST"] = host
 	b.extraEnv["GOOS"] = b.Target
-	b.extraEnv["GOARCH"] = b.Arch
+	if !b.isUniversal() {
+		b.extraEnv["GOARCH"] = b.Arch // universal: GOARCH set for each compilation
+	}
 	b.extraEnv["BUILD_TARGET"] = b.Target
 	b.extraEnv["BUILD_ARCH"] = b.Arch
 	if err := b.resolveGit(ctx); err != nil {
@@ -170,82 +181,108 @@ func (b *BarrowCtx) debugEnv() {
 	}
 	slices.Sort(lines)
 	for _, line := range lines {
-		fmt.Fprintf(os.Stderr, "\x1b[38;2;255;215;0m* env: %s\x1b[0m\n", line)
+		b.debugf("env: %s", line)
 	}
 }
 
-func (b *BarrowCtx) Run(ctx context.Context) error {
+// Run compiles the crates and creates the artifacts of the pack formats, the result lists what was built,
+// it is partial when Run fails
+func (b *BarrowCtx) Run(ctx context.Context) (*BuildResult, error) {
 	p, err := b.LoadPackage(b.CWD)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "parse package metadata error: %v\n", err)
-		return err
+		return nil, err
+	}
+	if b.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.Timeout)
+		defer cancel()
+	}
+	r := &BuildResult{Name: p.Name, Version: p.Version, Target: b.Target, Arch: b.Arch}
+	t := newTimings()
+	defer func() {
+		r.Elapsed = time.Since(t.start)
+		b.printTimings(t, p)
+	}()
+	if err := b.run(ctx, p, t, r); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return r, fmt.Errorf("build: %w after %s: %w", context.DeadlineExceeded, b.Timeout, err)
+		}
+		return r, err
 	}
-	trace.DbgPrint("Building %s version: %s target: %s arch: %s", p.Name, p.Version, b.Target, b.Arch)
+	return r, nil
+}
+
+func (b *BarrowCtx) run(ctx context.Context, p *Package, t *timings, r *BuildResult) error {
+	b.debugf("Building %s version: %s target: %s arch: %s", p.Name, p.Version, b.Target, b.Arch)
 	b.extraEnv["BUILD_VERSION"] = p.Version
 
 	if b.Verbose {
 		b.debugEnv()
 	}
 
+	if err := b.runHooks(ctx, p.Hooks, HookBeforeBuild, b.CWD, nil); err != nil {
+		return err
+	}
 	for _, item := range p.Include {
+		start := time.Now()
 		if err := b.apply(item); err != nil {
-			fmt.Fprintf(os.Stderr, "apply item %s error: %v\n", item.Path, err)
 			return err
 		}
+		t.record("include", item.Path, start)
 	}
 	// compile crates
 	crates := make([]*Crate, 0, len(p.Crates))
 	for _, location := range p.Crates {
+		b.crateStatus(location, filepath.Base(location), StatusPending)
+	}
+	var formats []string
+	if len(b.Pack) != 0 {
+		formats = b.packFormats(p)
+	}
+	for _, format := range formats {
+		b.packStatus(strings.ToLower(format), StatusPending)
+	}
+	for _, location := range p.Crates {
+		start := time.Now()
+		b.crateStatus(location, filepath.Base(location), StatusRunning)
 		crate, err := b.compile(ctx, location)
 		if err != nil {
+			b.crateStatus(location, filepath.Base(location), StatusFailed)
+			return err
+		}
+		b.crateStatus(location, crate.Name, StatusDone)
+		r.Crates = append(r.Crates, &CrateResult{
+			Name:    crate.Name,
+			Version: crate.Version,
+			Path:    filepath.Join(b.Out, crate.Destination, b.basename(crate.Name)),
+			Elapsed: t.record("compile", crate.Name, start),
+		})
+		if err := b.runHooks(ctx, p.Hooks, HookAfterCrate, b.CWD, b.crateHookEnv(crate)); err != nil {
 			return err
 		}
+		// generated completions and man pages are packed like [[include]] items
+		p.Include = append(p.Include, crate.generated...)
 		crates = append(crates, crate)
 	}
-	if len(b.Pack) == 0 {
-		return nil
-	}
-	for _, pack := range b.Pack {
-		switch strings.ToLower(pack) {
-		case "zip":
-			if err := b.zip(ctx, p, crates); err != nil {
-				fmt.Fprintf(os.Stderr, "bali create zip package error: %v\n", err)
-				return err
-			}
-		case "rpm":
-			if err := b.rpm(ctx, p, crates); err != nil {
-				fmt.Fprintf(os.Stderr, "bali create rpm package error: %v\n", err)
-				return err
-			}
-		case "sh":
-			if err := b.sh(ctx, p, crates); err != nil {
-				fmt.Fprintf(os.Stderr, "bali create sh package error: %v\n", err)
-				return err
-			}
-		case "tar":
-			if err := b.tar(ctx, p, crates); err != nil {
-				fmt.Fprintf(os.Stderr, "bali create tar package error: %v\n", err)
-				return err
-			}
-		case "deb":
-			if err := b.deb(ctx, p, crates); err != nil {
-				fmt.Fprintf(os.Stderr, "bali create deb package error: %v\n", err)
-				return err
-			}
-		case "apk":
-			if err := b.apk(ctx, p, crates); err != nil {
-				fmt.Fprintf(os.Stderr, "bali create deb package error: %v\n", err)
-				return err
-			}
-		case "arch":
-			if err := b.archLinux(ctx, p, crates); err != nil {
-				fmt.Fprintf(os.Stderr, "bali create deb package error: %v\n", err)
-				return err
-			}
-		default:
-			fmt.Fprintf(os.Stderr, "unsupported pack format '%s'\n", b.Pack)
-			return fmt.Errorf("unsupported pack format '%s'", b.Pack)
+	for _, pack := range formats {
+		format := strings.ToLower(pack)
+		start := time.Now()
+		if err := b.runHooks(ctx, p.Hooks, HookBeforePack, b.CWD, map[string]string{"BALI_PACK_FORMAT": format}); err != nil {
+			return err
 		}
+		pr, err := b.packArtifact(ctx, format, p, crates)
+		if err != nil {
+			return err
+		}
+		if err := b.runHooks(ctx, p.Hooks, HookAfterPack, b.CWD, map[string]string{
+			"BALI_PACK_FORMAT":   format,
+			"BALI_ARTIFACT_PATH": pr.Path,
+			"BALI_ARTIFACT_NAME": filepath.Base(pr.Path),
+		}); err != nil {
+			return err
+		}
+		pr.Elapsed = t.record("pack", format, start)
+		r.Artifacts = append(r.Artifacts, pr)
 	}
 	return nil
 }
@@ -258,8 +295,7 @@ func (b *BarrowCtx) makeAlias(from, to string) error {
 		_ = os.Remove(to)
 	}
 	if err := os.Symlink(from, to); err != nil {
-		fmt.Fprintf(os.Stderr, "create symlink error: %v\n", err)
-		return err
+		return fmt.Errorf("create alias: %w", err)
 	}
 	return nil
 }
@@ -269,67 +305,134 @@ func (b *BarrowCtx) compile(ctx context.Context, location string) (*Crate, error
 	if err != nil {
 		return nil, err
 	}
+	if crate.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, crate.timeout)
+		defer cancel()
+	}
+	if err := b.compileCrate(ctx, crate); err != nil {
+		if crate.timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("%w after %s: %w", context.DeadlineExceeded, crate.timeout, err)
+		}
+		return nil, newCompileError(crate.Name, err)
+	}
+	return crate, nil
+}
+
+// compileCrate: resources, hooks, go build, aliases and generated items of one crate
+func (b *BarrowCtx) compileCrate(ctx context.Context, crate *Crate) error {
 	releaseFn, err := b.MakeResources(crate)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "crate: %s build resources error \x1b[31m%s\x1b[0m\n", crate.Name, err)
-		return nil, err
+		return fmt.Errorf("build resources: %w", err)
 	}
 	if releaseFn != nil {
 		defer releaseFn() // remove it
 	}
-	trace.DbgPrint("crate: %s\n", crate.Name)
-	name := b.basename(crate.Name)
-	psArgs := make([]string, 0, 8)
-	psArgs = append(psArgs, "build", "-o", name)
-	for _, flag := range crate.GoFlags {
-		psArgs = append(psArgs, b.ExpandEnv(flag))
-	}
-	cmd := exec.CommandContext(ctx, "go", psArgs...)
-	cmd.Dir = crate.cwd
-	cmd.Stderr = os.Stderr
-	cmd.Stdout = os.Stdout
-	cmd.Env = b.environ
-	stage("compile", "crate: %s version: %s for %s/%s", crate.Name, crate.Version, b.Target, b.Arch)
-	status("%s", cmdStringsArgs(cmd))
-	if err := cmd.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "compile %s error \x1b[31m%s\x1b[0m\n", crate.Name, err)
-		return nil, err
+	b.debugf("crate: %s", crate.Name)
+	if err := b.runHooks(ctx, crate.Hooks, HookBeforeBuild, crate.cwd, nil); err != nil {
+		return err
 	}
+	name := b.basename(crate.Name)
 	crateDestination := filepath.Join(crate.Destination, name)
 	crateFullPath := filepath.Join(b.Out, crateDestination)
 	_ = os.MkdirAll(filepath.Dir(crateFullPath), 0755)
-	if err := os.Rename(filepath.Join(crate.cwd, name), crateFullPath); err != nil {
-		fmt.Fprintf(os.Stderr, "move out to dest error: %v\n", err)
-		return nil, err
+	if b.isUniversal() {
+		if err := b.compileUniversal(ctx, crate, name, crateFullPath); err != nil {
+			return err
+		}
+	} else {
+		if err := b.goBuild(ctx, crate, name, b.Target, b.Arch, b.environ); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(crate.cwd, name), crateFullPath); err != nil {
+			return fmt.Errorf("move to the build directory: %w", err)
+		}
 	}
 	for _, a := range crate.Alias {
 		aliasExpend := b.ExpandEnv(b.basename(a))
-		stage("compile", "Link \x1b[38;02;39;199;173m%s\x1b[0m --> \x1b[38;02;39;199;173m%s\x1b[0m ", filepath.ToSlash(crateDestination), filepath.ToSlash(aliasExpend))
+		b.stage("compile", "Link %s --> %s", filepath.ToSlash(crateDestination), filepath.ToSlash(aliasExpend))
 		if err := b.makeAlias(crateFullPath, aliasExpend); err != nil {
-			return nil, err
+			return err
 		}
 	}
-	return crate, nil
+	if crate.generated, err = b.generateItems(ctx, crate, crateFullPath); err != nil {
+		return fmt.Errorf("generate completions and man pages: %w", err)
+	}
+	if err := b.runHooks(ctx, crate.Hooks, HookAfterCrate, crate.cwd, b.crateHookEnv(crate)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// goBuild: environ must select target and arch, they are only printed
+func (b *BarrowCtx) goBuild(ctx context.Context, crate *Crate, output string, target, arch string, environ []string) error {
+	psArgs := make([]string, 0, 8)
+	psArgs = append(psArgs, "build", "-o", output)
+	for _, flag := range crate.GoFlags {
+		psArgs = append(psArgs, b.ExpandEnv(flag))
+	}
+	cmd := commandContext(ctx, "go", psArgs...)
+	cmd.Dir = crate.cwd
+	flush := b.captureOutput(cmd, "compile")
+	cmd.Env = environ
+	b.stage("compile", "crate: %s version: %s for %s/%s", crate.Name, crate.Version, target, arch)
+	b.status("%s", cmdStringsArgs(cmd))
+	err := cmd.Run()
+	flush()
+	if err != nil {
+		return fmt.Errorf("go build: %w", err)
+	}
+	return nil
+}
+
+// compileUniversal: build every universal arch then merge them into a fat Mach-O
+func (b *BarrowCtx) compileUniversal(ctx context.Context, crate *Crate, name string, crateFullPath string) error {
+	thinFiles := make([]string, 0, len(universalArchs))
+	defer func() {
+		for _, f := range thinFiles {
+			_ = os.Remove(f)
+		}
+	}()
+	for _, arch := range universalArchs {
+		output := name + "-" + arch
+		thinFiles = append(thinFiles, filepath.Join(crate.cwd, output))
+		if err := b.goBuild(ctx, crate, output, b.Target, arch, environWithArch(b.environ, arch)); err != nil {
+			return err
+		}
+	}
+	b.stage("compile", "lipo: %s (%s)", name, strings.Join(universalArchs, ", "))
+	if err := MakeFatMachO(crateFullPath, thinFiles...); err != nil {
+		return fmt.Errorf("make universal binary: %w", err)
+	}
+	return nil
+}
+
+func (b *BarrowCtx) crateHookEnv(crate *Crate) map[string]string {
+	return map[string]string{
+		"BALI_CRATE_NAME":    crate.Name,
+		"BALI_CRATE_VERSION": crate.Version,
+		"BALI_ARTIFACT_PATH": filepath.Join(b.Out, crate.Destination, b.basename(crate.Name)),
+		"BALI_ARTIFACT_NAME": b.basename(crate.Name),
+	}
 }
 
 func (b *BarrowCtx) Cleanup(force bool) error {
 	p, err := b.LoadPackage(b.CWD)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "parse package metadata error: %v\n", err)
 		return err
 	}
 	for _, item := range p.Include {
 		if err := b.cleanupItem(item, force); err != nil {
-			fmt.Fprintf(os.Stderr, "\x1b[31mcleanup %s error: %v\x1b[0m\n", item.Path, err)
+			b.warnf("cleanup %s error: %v", item.Path, err)
 		}
 	}
 	for _, location := range p.Crates {
 		if err := b.cleanupCrate(location); err != nil {
-			fmt.Fprintf(os.Stderr, "\x1b[31mcleanup %s error: %v\x1b[0m\n", location, err)
+			b.warnf("cleanup %s error: %v", location, err)
 		}
 	}
 	if err := b.cleanupPackages(); err != nil {
-		fmt.Fprintf(os.Stderr, "\x1b[31mcleanup packages error: %v\x1b[0m\n", err)
+		b.warnf("cleanup packages error: %v", err)
 	}
 	return nil
 }
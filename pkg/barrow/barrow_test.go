@@ -1,11 +1,16 @@
 package barrow
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pelletier/go-toml/v2"
 )
@@ -44,3 +49,54 @@ func TestEncodePackage(t *testing.T) {
 		fmt.Fprintf(os.Stderr, "encode error: %v\n", err)
 	}
 }
+
+func TestCrateTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run sleep")
+	}
+	b, _, _ := newTestModule(t)
+	crateFile := filepath.Join(b.CWD, "cmd/jack/crate.toml")
+	if err := os.WriteFile(crateFile, []byte("name = \"jack\"\ntimeout = \"soon\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.LoadCrate("cmd/jack"); err == nil {
+		t.Fatal("invalid crate timeout accepted")
+	}
+	if err := os.WriteFile(crateFile, []byte("name = \"jack\"\ntimeout = \"200ms\"\n\n[hooks]\nbefore-build = [\"sleep 10\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	_, err := b.compile(context.Background(), "cmd/jack")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("compile past the crate timeout: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("crate timeout did not interrupt the hook, elapsed %s", elapsed)
+	}
+}
+
+func TestIncludeTimings(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run sh")
+	}
+	b := newHookModule(t, "\n[[include]]\npath = \"LICENSE\"\n\n[[include]]\npath = \"go.mod\"\ndestination = \"share\"\n")
+	b.Pack = nil
+	if err := os.WriteFile(filepath.Join(b.CWD, "LICENSE"), []byte("MIT License\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := b.LoadPackage(b.CWD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timings := newTimings()
+	if err := b.run(context.Background(), p, timings, &BuildResult{}); err != nil {
+		t.Fatal(err)
+	}
+	var steps []string
+	for _, s := range timings.steps {
+		steps = append(steps, s.step+" "+s.name)
+	}
+	if strings.Join(steps, ", ") != "include LICENSE, include go.mod, compile jack" {
+		t.Fatalf("timings: %v", steps)
+	}
+}
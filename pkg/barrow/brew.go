@@ -0,0 +1,136 @@
+package barrow
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+type BrewConfig struct {
+	Test    string `toml:"test,omitempty"`    // body of the test block, default: the first crate is installed
+	Caveats string `toml:"caveats,omitempty"` // shown after installation
+}
+
+var (
+	brewClassSeparator = regexp.MustCompile(`[-_.\s]([a-zA-Z0-9])`)
+	brewClassAt        = regexp.MustCompile(`(.)@(\d)`)
+)
+
+// brewClassName: formula name to Ruby class name, like Homebrew's Formulary.class_s
+func brewClassName(name string) string {
+	if len(name) == 0 {
+		return name
+	}
+	class := string(unicode.ToUpper(rune(name[0]))) + strings.ToLower(name[1:])
+	class = brewClassSeparator.ReplaceAllStringFunc(class, func(s string) string {
+		return strings.ToUpper(s[1:])
+	})
+	class = strings.ReplaceAll(class, "+", "x")
+	return brewClassAt.ReplaceAllString(class, "${1}AT${2}")
+}
+
+// rubyString: double quoted, without interpolation
+func rubyString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `#`, `\#`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// brewCPU: Hardware::CPU condition of an arch, universal binaries run everywhere
+func brewCPU(arch string) (string, bool) {
+	switch arch {
+	case "amd64":
+		return "Hardware::CPU.intel? && Hardware::CPU.is_64_bit?", true
+	case "arm64":
+		return "Hardware::CPU.arm? && Hardware::CPU.is_64_bit?", true
+	case ArchUniversal:
+		return "", true
+	}
+	return "", false
+}
+
+func (b *BarrowCtx) brewFormula(p *Package, crates []*Crate, archives []*releaseArchive) string {
+	cfg := p.Brew
+	if cfg == nil {
+		cfg = &BrewConfig{}
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "class %s < Formula\n", brewClassName(p.Name))
+	for _, kv := range [][2]string{{"desc", p.Summary}, {"homepage", p.Homepage}, {"version", p.Version}, {"license", p.License}} {
+		if len(kv[1]) != 0 {
+			fmt.Fprintf(&sb, "  %s %s\n", kv[0], rubyString(kv[1]))
+		}
+	}
+	for _, system := range []struct{ target, block string }{{"darwin", "on_macos"}, {"linux", "on_linux"}} {
+		var platform []*releaseArchive
+		for _, a := range archives {
+			if _, ok := brewCPU(a.Arch); ok && a.Target == system.target {
+				if a.Arch == ArchUniversal {
+					platform = []*releaseArchive{a} // covers every CPU
+					break
+				}
+				platform = append(platform, a)
+			}
+		}
+		if len(platform) == 0 {
+			continue
+		}
+		fmt.Fprintf(&sb, "\n  %s do\n", system.block)
+		for i, a := range platform {
+			cond, _ := brewCPU(a.Arch)
+			indent := "    "
+			if len(cond) != 0 {
+				if i != 0 {
+					sb.WriteString("\n")
+				}
+				fmt.Fprintf(&sb, "    if %s\n", cond)
+				indent = "      "
+			}
+			fmt.Fprintf(&sb, "%surl %s\n%ssha256 %s\n", indent, rubyString(a.URL), indent, rubyString(a.SHA256))
+			if len(cond) != 0 {
+				sb.WriteString("    end\n")
+			}
+		}
+		sb.WriteString("  end\n")
+	}
+	// archives keep the package layout below name-version-target-arch, Homebrew enters that directory
+	sb.WriteString("\n  def install\n    prefix.install Dir[\"*\"]\n  end\n")
+	if len(cfg.Caveats) != 0 {
+		fmt.Fprintf(&sb, "\n  def caveats\n    %s\n  end\n", rubyString(cfg.Caveats))
+	}
+	test := cfg.Test
+	if len(test) == 0 && len(crates) != 0 {
+		test = fmt.Sprintf("assert_predicate prefix/%s, :exist?", rubyString(AsRelativePath(ToNixPath(crates[0].Destination)+"/"+crates[0].Name)))
+	}
+	if len(test) != 0 {
+		sb.WriteString("\n  test do\n")
+		for _, line := range strings.Split(strings.TrimSpace(test), "\n") {
+			fmt.Fprintf(&sb, "    %s\n", strings.TrimSpace(line))
+		}
+		sb.WriteString("  end\n")
+	}
+	sb.WriteString("end\n")
+	return sb.String()
+}
+
+// brew writes the Homebrew formula <name>.rb for the darwin and linux archives in Destination
+func (b *BarrowCtx) brew(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	archives, err := b.releaseArchives(p, []string{"darwin", "linux"}, releaseArchiveSuffixes)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range archives {
+		b.stage("brew", "%s/%s --> %s", a.Target, a.Arch, a.URL)
+	}
+	name, err := b.ArtifactName("brew", p, nil)
+	if err != nil {
+		return "", err
+	}
+	return b.writeManifest(ctx, name, []byte(b.brewFormula(p, crates, archives)))
+}
@@ -0,0 +1,235 @@
+package barrow
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type ChocolateyConfig struct {
+	ID         string   `toml:"id,omitempty"` // default: name
+	Title      string   `toml:"title,omitempty"`
+	Tags       []string `toml:"tags,omitempty"`
+	LicenseURL string   `toml:"license-url,omitempty"` // default: the SPDX page of license
+}
+
+const (
+	nuspecNamespace    = "http://schemas.microsoft.com/packaging/2015/06/nuspec.xsd"
+	chocolateyInstall  = "tools/chocolateyinstall.ps1"
+	nupkgContentTypes  = `<?xml version="1.0" encoding="utf-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml" /><Default Extension="nuspec" ContentType="application/octet" /><Default Extension="ps1" ContentType="application/octet" /><Default Extension="psmdcp" ContentType="application/vnd.openxmlformats-package.core-properties+xml" /></Types>`
+	nupkgRelsFormat    = `<?xml version="1.0" encoding="utf-8"?><Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Type="http://schemas.microsoft.com/packaging/2010/07/manifest" Target="/%s" Id="R%s" /><Relationship Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="/%s" Id="R%s" /></Relationships>`
+	nupkgCoreNamespace = "http://schemas.openxmlformats.org/package/2006/metadata/core-properties"
+)
+
+type nuspecFile struct {
+	Src    string `xml:"src,attr"`
+	Target string `xml:"target,attr"`
+}
+
+type nuspecMetadata struct {
+	ID          string `xml:"id"`
+	Version     string `xml:"version"`
+	Title       string `xml:"title,omitempty"`
+	Authors     string `xml:"authors"`
+	Owners      string `xml:"owners,omitempty"`
+	ProjectURL  string `xml:"projectUrl,omitempty"`
+	LicenseURL  string `xml:"licenseUrl,omitempty"`
+	Copyright   string `xml:"copyright,omitempty"`
+	Tags        string `xml:"tags,omitempty"`
+	Summary     string `xml:"summary,omitempty"`
+	Description string `xml:"description"`
+}
+
+type nuspec struct {
+	XMLName  xml.Name       `xml:"package"`
+	Xmlns    string         `xml:"xmlns,attr"`
+	Metadata nuspecMetadata `xml:"metadata"`
+	Files    []nuspecFile   `xml:"files>file"`
+}
+
+type nupkgCoreProperties struct {
+	XMLName        xml.Name `xml:"coreProperties"`
+	Xmlns          string   `xml:"xmlns,attr"`
+	XmlnsDC        string   `xml:"xmlns:dc,attr"`
+	Creator        string   `xml:"dc:creator"`
+	Description    string   `xml:"dc:description"`
+	Identifier     string   `xml:"dc:identifier"`
+	Version        string   `xml:"version"`
+	Keywords       string   `xml:"keywords"`
+	LastModifiedBy string   `xml:"lastModifiedBy"`
+}
+
+func xmlDocument(v any) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// powershellString: single quoted, no expansion
+func powershellString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// chocolateyScript downloads and extracts the zip archives, Chocolatey shims the executables
+func chocolateyScript(archives []*releaseArchive) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("$ErrorActionPreference = 'Stop'\n")
+	sb.WriteString("$toolsDir = Split-Path -Parent $MyInvocation.MyCommand.Definition\n\n")
+	sb.WriteString("$packageArgs = @{\n  packageName   = $env:ChocolateyPackageName\n  unzipLocation = $toolsDir\n")
+	found := false
+	for _, a := range archives {
+		var suffix string
+		switch a.Arch {
+		case "386":
+		case "amd64":
+			suffix = "64"
+		default:
+			continue // Install-ChocolateyZipPackage knows 32 and 64 bit only
+		}
+		urlKey := "url"
+		if len(suffix) != 0 {
+			urlKey = "url64bit"
+		}
+		fmt.Fprintf(&sb, "  %-13s = %s\n", urlKey, powershellString(a.URL))
+		fmt.Fprintf(&sb, "  %-13s = %s\n", "checksum"+suffix, powershellString(a.SHA256))
+		fmt.Fprintf(&sb, "  %-13s = 'sha256'\n", "checksumType"+suffix)
+		found = true
+	}
+	if !found {
+		return "", fmt.Errorf("chocolatey: no windows amd64 or 386 zip archives")
+	}
+	sb.WriteString("}\n\nInstall-ChocolateyZipPackage @packageArgs\n")
+	return sb.String(), nil
+}
+
+func (b *BarrowCtx) chocolateyNuspec(p *Package, crates []*Crate) (*nuspec, error) {
+	cfg := p.Chocolatey
+	if cfg == nil {
+		cfg = &ChocolateyConfig{}
+	}
+	sfi, err := b.stringFileInfo(crates)
+	if err != nil {
+		return nil, err
+	}
+	authors := strings.Join(p.Authors, ", ")
+	owner := nonEmpty(p.Vendor, sfi.CompanyName)
+	licenseURL := cfg.LicenseURL
+	if len(licenseURL) == 0 && len(p.License) != 0 && !strings.ContainsAny(p.License, " ()") {
+		licenseURL = "https://spdx.org/licenses/" + p.License + ".html"
+	}
+	n := &nuspec{
+		Xmlns: nuspecNamespace,
+		Metadata: nuspecMetadata{
+			ID:          strings.ToLower(nonEmpty(cfg.ID, p.Name)),
+			Version:     p.Version,
+			Title:       nonEmpty(cfg.Title, nonEmpty(sfi.ProductName, p.Name)),
+			Authors:     nonEmpty(authors, owner),
+			Owners:      owner,
+			ProjectURL:  p.Homepage,
+			LicenseURL:  licenseURL,
+			Copyright:   sfi.LegalCopyright,
+			Tags:        strings.Join(cfg.Tags, " "),
+			Summary:     nonEmpty(p.Summary, sfi.FileDescription),
+			Description: nonEmpty(p.Description, nonEmpty(p.Summary, sfi.FileDescription)),
+		},
+		Files: []nuspecFile{{Src: `tools\**`, Target: "tools"}},
+	}
+	if len(n.Metadata.Authors) == 0 || len(n.Metadata.Description) == 0 {
+		return nil, fmt.Errorf("chocolatey: authors and description are required, set authors/vendor and description")
+	}
+	return n, nil
+}
+
+// chocolateyPackage writes the .nupkg: an OPC zip with the nuspec, install script and core properties
+func chocolateyPackage(n *nuspec, nuspecData []byte, script string, w io.Writer) error {
+	id := n.Metadata.ID
+	h := sha256.Sum256(append([]byte(id+n.Metadata.Version), nuspecData...))
+	psmdcp := "package/services/metadata/core-properties/" + hex.EncodeToString(h[:16]) + ".psmdcp"
+	core, err := xmlDocument(&nupkgCoreProperties{
+		Xmlns:          nupkgCoreNamespace,
+		XmlnsDC:        "http://purl.org/dc/elements/1.1/",
+		Creator:        n.Metadata.Authors,
+		Description:    n.Metadata.Description,
+		Identifier:     id,
+		Version:        n.Metadata.Version,
+		Keywords:       n.Metadata.Tags,
+		LastModifiedBy: "bali",
+	})
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(w)
+	modTime := time.Now()
+	for _, e := range []struct {
+		name string
+		data []byte
+	}{
+		{"_rels/.rels", []byte(fmt.Sprintf(nupkgRelsFormat, id+".nuspec", hex.EncodeToString(h[16:24]), psmdcp, hex.EncodeToString(h[24:])))},
+		{id + ".nuspec", nuspecData},
+		{chocolateyInstall, []byte(script)},
+		{psmdcp, core},
+		{"[Content_Types].xml", []byte(nupkgContentTypes)},
+	} {
+		fw, err := z.CreateHeader(&zip.FileHeader{Name: e.name, Method: zip.Deflate, Modified: modTime})
+		if err != nil {
+			_ = z.Close()
+			return err
+		}
+		if _, err := fw.Write(e.data); err != nil {
+			_ = z.Close()
+			return err
+		}
+	}
+	return z.Close()
+}
+
+// chocolatey writes <id>.nuspec and <id>.<version>.nupkg for the windows zip archives in Destination
+func (b *BarrowCtx) chocolatey(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	n, err := b.chocolateyNuspec(p, crates)
+	if err != nil {
+		return "", err
+	}
+	archives, err := b.releaseArchives(p, []string{"windows"}, []string{".zip"})
+	if err != nil {
+		return "", err
+	}
+	script, err := chocolateyScript(archives)
+	if err != nil {
+		return "", err
+	}
+	nuspecData, err := xmlDocument(n)
+	if err != nil {
+		return "", err
+	}
+	if _, err := b.writeManifest(ctx, n.Metadata.ID+".nuspec", nuspecData); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := chocolateyPackage(n, nuspecData, script, &buf); err != nil {
+		return "", err
+	}
+	nupkgName, err := b.ArtifactName("chocolatey", p, map[string]string{"name": n.Metadata.ID, "version": n.Metadata.Version})
+	if err != nil {
+		return "", err
+	}
+	nupkgPath, err := b.writeManifest(ctx, nupkgName, buf.Bytes())
+	if err != nil {
+		return "", err
+	}
+	b.stage("chocolatey", "%s %s --> %s", n.Metadata.ID, n.Metadata.Version, nupkgName)
+	return nupkgPath, nil
+}
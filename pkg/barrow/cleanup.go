@@ -1,7 +1,6 @@
 package barrow
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
 )
@@ -14,11 +13,11 @@ func (b *BarrowCtx) cleanupCrate(location string) error {
 	b.cleanupResources(crate)
 	destTo := filepath.Join(b.Out, crate.Destination, crate.Name)
 	if err := os.Remove(destTo); err == nil {
-		fmt.Fprintf(os.Stderr, "rm: \x1b[33m%s\x1b[0m\n", destTo)
+		b.infof("rm: %s", destTo)
 	}
 	destToExe := destTo + ".exe"
 	if err := os.Remove(destToExe); err == nil {
-		fmt.Fprintf(os.Stderr, "rm: \x1b[33m%s\x1b[0m\n", destToExe)
+		b.infof("rm: %s", destToExe)
 	}
 	return nil
 }
@@ -44,7 +43,7 @@ func (b *BarrowCtx) cleanupItem(item *FileItem, force bool) error {
 		}
 	}
 	_ = os.Remove(destTo)
-	fmt.Fprintf(os.Stderr, "rm: \x1b[33m%s\x1b[0m\n", destTo)
+	b.infof("rm: %s", destTo)
 	return nil
 }
 
@@ -61,7 +60,7 @@ func (b *BarrowCtx) cleanupPackages() error {
 		return err
 	}
 	for _, item := range files {
-		fmt.Fprintf(os.Stderr, "rm: \x1b[33m%s\x1b[0m\n", item)
+		b.infof("rm: %s", item)
 		_ = os.Remove(item)
 	}
 	return nil
@@ -0,0 +1,17 @@
+//go:build !windows
+
+package barrow
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// interruptOnCancel runs the command in its own process group and interrupts the whole group,
+// the children of `sh -c` stop on timeouts too, not only on a terminal Ctrl-C
+func interruptOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build windows
+
+package barrow
+
+import (
+	"os/exec"
+)
+
+// interruptOnCancel: Windows cannot deliver an interrupt to a child, keep the default Kill
+func interruptOnCancel(cmd *exec.Cmd) {
+}
@@ -0,0 +1,160 @@
+package barrow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	// completion scripts are installed where the shells look for them by default
+	completionLocations = map[string]func(name string) (string, string){
+		"bash": func(name string) (string, string) { return "share/bash-completion/completions", name },
+		"zsh":  func(name string) (string, string) { return "share/zsh/site-functions", "_" + name },
+		"fish": func(name string) (string, string) { return "share/fish/vendor_completions.d", name + ".fish" },
+	}
+	defaultCompletionArgs = []string{"completion", "$BALI_SHELL"}
+	defaultManpageArgs    = []string{"man"}
+)
+
+const (
+	manpageDestination = "share/man/man1"
+)
+
+// hostRunnable: the crates compiled for the target run on this machine
+func (b *BarrowCtx) hostRunnable() bool {
+	if b.Target != runtime.GOOS {
+		return false
+	}
+	if b.isUniversal() {
+		return slices.Contains(universalArchs, runtime.GOARCH)
+	}
+	return b.Arch == runtime.GOARCH
+}
+
+// environWithHost: GOOS and GOARCH of this machine
+func environWithHost(environ []string) []string {
+	newEnv := make([]string, 0, len(environ)+2)
+	for _, e := range environ {
+		if strings.HasPrefix(e, "GOOS=") || strings.HasPrefix(e, "GOARCH=") {
+			continue
+		}
+		newEnv = append(newEnv, e)
+	}
+	return append(newEnv, "GOOS="+runtime.GOOS, "GOARCH="+runtime.GOARCH)
+}
+
+// generatedItem: a file generated into Out, packed like an [[include]] item
+func (b *BarrowCtx) generatedItem(destination, name string) (*FileItem, error) {
+	rel, err := filepath.Rel(b.CWD, filepath.Join(b.Out, destination, name))
+	if err != nil {
+		return nil, err
+	}
+	return &FileItem{Path: rel, Destination: destination, Permissions: "0644"}, nil
+}
+
+// generatedItems: completions and man pages declared by the crate
+func (b *BarrowCtx) generatedItems(crate *Crate) ([]*FileItem, error) {
+	items := make([]*FileItem, 0, len(crate.Completions)+1)
+	for _, shell := range crate.Completions {
+		location, ok := completionLocations[shell]
+		if !ok {
+			return nil, fmt.Errorf("crate %s: unsupported completion shell '%s', supported: bash, zsh, fish", crate.Name, shell)
+		}
+		item, err := b.generatedItem(location(crate.Name))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if crate.Manpages {
+		item, err := b.generatedItem(manpageDestination, crate.Name+".1")
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func (b *BarrowCtx) runGenerator(ctx context.Context, crate *Crate, program string, args []string, shell string, saveTo string) error {
+	expanded := make([]string, 0, len(args))
+	for _, a := range args {
+		expanded = append(expanded, os.Expand(a, func(key string) string {
+			if key == "BALI_SHELL" {
+				return shell
+			}
+			return b.Getenv(key)
+		}))
+	}
+	var stdout bytes.Buffer
+	cmd := commandContext(ctx, program, expanded...)
+	cmd.Dir = crate.cwd
+	cmd.Env = b.environ
+	stderr := &outputWriter{b: b, stage: "generate", stderr: true, mu: &sync.Mutex{}}
+	defer stderr.Flush()
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+	b.status("%s %s", filepath.Base(program), strings.Join(expanded, " "))
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("crate %s: run %s error: %w", crate.Name, strings.Join(expanded, " "), err)
+	}
+	if stdout.Len() == 0 {
+		return fmt.Errorf("crate %s: %s printed nothing", crate.Name, strings.Join(expanded, " "))
+	}
+	if err := os.MkdirAll(filepath.Dir(saveTo), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(saveTo, stdout.Bytes(), 0644)
+}
+
+// generateItems runs the built crate, or a host build of it when cross compiling, to write completions and man pages into Out
+func (b *BarrowCtx) generateItems(ctx context.Context, crate *Crate, crateFullPath string) ([]*FileItem, error) {
+	if len(crate.Completions) == 0 && !crate.Manpages {
+		return nil, nil
+	}
+	items, err := b.generatedItems(crate)
+	if err != nil {
+		return nil, err
+	}
+	program := crateFullPath
+	if !b.hostRunnable() {
+		output := crate.Name + "-host"
+		if runtime.GOOS == "windows" {
+			output += ".exe"
+		}
+		program = filepath.Join(crate.cwd, output)
+		defer os.Remove(program) // nolint
+		if err := b.goBuild(ctx, crate, output, runtime.GOOS, runtime.GOARCH, environWithHost(b.environ)); err != nil {
+			return nil, err
+		}
+	}
+	completionArgs := crate.CompletionArgs
+	if len(completionArgs) == 0 {
+		completionArgs = defaultCompletionArgs
+	}
+	for _, shell := range crate.Completions {
+		destination, name := completionLocations[shell](crate.Name)
+		b.stage("generate", "crate: %s %s completion --> %s/%s", crate.Name, shell, destination, name)
+		if err := b.runGenerator(ctx, crate, program, completionArgs, shell, filepath.Join(b.Out, destination, name)); err != nil {
+			return nil, err
+		}
+	}
+	if crate.Manpages {
+		manpageArgs := crate.ManpageArgs
+		if len(manpageArgs) == 0 {
+			manpageArgs = defaultManpageArgs
+		}
+		b.stage("generate", "crate: %s man page --> %s/%s.1", crate.Name, manpageDestination, crate.Name)
+		if err := b.runGenerator(ctx, crate, program, manpageArgs, "", filepath.Join(b.Out, manpageDestination, crate.Name+".1")); err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
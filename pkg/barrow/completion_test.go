@@ -0,0 +1,89 @@
+package barrow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestEnvironWithHost(t *testing.T) {
+	env := environWithHost([]string{"GOOS=windows", "PATH=/bin", "GOARCH=arm64"})
+	if !slices.Equal(env, []string{"PATH=/bin", "GOOS=" + runtime.GOOS, "GOARCH=" + runtime.GOARCH}) {
+		t.Errorf("environ: %v", env)
+	}
+	b := &BarrowCtx{Target: "windows", Arch: runtime.GOARCH}
+	if runtime.GOOS != "windows" && b.hostRunnable() {
+		t.Errorf("windows binaries runnable on %s", runtime.GOOS)
+	}
+}
+
+func TestGenerateItems(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test crate is a shell script")
+	}
+	b, p, _ := newTestModule(t)
+	b.Target, b.Arch = runtime.GOOS, runtime.GOARCH
+	files := map[string]string{
+		// Verify loads the crates again
+		"cmd/jack/crate.toml": `name = "jack"
+destination = "bin"
+completions = ["bash", "zsh", "fish"]
+manpages = true
+manpage-args = ["help", "--man"]
+`,
+		"build/bin/jack": "#!/bin/sh\ncase \"$1\" in\ncompletion) echo \"# $2 completion\" ;;\nhelp) echo '.TH JACK 1' ;;\nesac\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(b.CWD, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(b.Out, "bin/jack"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	crate, err := b.LoadCrate("cmd/jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	items, err := b.generateItems(context.Background(), crate, filepath.Join(b.Out, "bin/jack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 4 {
+		t.Fatalf("items: %d", len(items))
+	}
+	for name, want := range map[string]string{
+		"share/bash-completion/completions/jack":    "# bash completion\n",
+		"share/zsh/site-functions/_jack":            "# zsh completion\n",
+		"share/fish/vendor_completions.d/jack.fish": "# fish completion\n",
+		"share/man/man1/jack.1":                     ".TH JACK 1\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(b.Out, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != want {
+			t.Errorf("%s: %q, want %q", name, data, want)
+		}
+	}
+	p.Include = append(p.Include, items...)
+	artifact, err := b.tar(context.Background(), p, []*Crate{crate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := b.Verify(context.Background(), artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Artifact.Lookup(b.archivePrefix(p)+"/share/man/man1/jack.1") == nil {
+		t.Errorf("man page not packed")
+	}
+	crate.Completions = []string{"powershell"}
+	if _, err := b.generatedItems(crate); err == nil || !strings.Contains(err.Error(), "powershell") {
+		t.Errorf("unsupported shell error: %v", err)
+	}
+}
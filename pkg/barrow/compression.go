@@ -0,0 +1,175 @@
+package barrow
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+// compressionSpec: --compression method[:level], xz:<level>e selects the extreme preset
+type compressionSpec struct {
+	Method  string
+	Level   int // -1: default of the method
+	Extreme bool
+	Threads int
+}
+
+const (
+	// pgzip block size, payloads smaller than one block are compressed by a single goroutine
+	parallelGzipBlockSize = 1 << 20
+)
+
+var (
+	compressionLevels = map[string][2]int{
+		"gzip":    {1, 9},
+		"deflate": {1, 9},
+		"zstd":    {1, 22},
+		"xz":      {0, 9},
+		"bzip2":   {1, 9},
+		"brotli":  {0, 11},
+	}
+	// dictionary sizes of the xz presets
+	xzDictCaps = [10]int{256 << 10, 1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+)
+
+// parseCompression parses spec, level and threads come from bali.toml when the spec has no level
+func parseCompression(spec string, level *int, threads int) (*compressionSpec, error) {
+	method, levelText, hasLevel := strings.Cut(strings.ToLower(strings.TrimSpace(spec)), ":")
+	c := &compressionSpec{Method: method, Level: -1, Threads: threads}
+	if c.Threads <= 0 {
+		c.Threads = runtime.GOMAXPROCS(0)
+	}
+	if hasLevel {
+		if l, ok := strings.CutSuffix(levelText, "e"); ok && method == "xz" {
+			levelText, c.Extreme = l, true
+		}
+		n, err := strconv.Atoi(levelText)
+		if err != nil {
+			return nil, fmt.Errorf("bad compression level '%s' in '%s'", levelText, spec)
+		}
+		c.Level = n
+	} else if _, ok := compressionLevels[method]; ok && level != nil {
+		c.Level = *level
+	}
+	if c.Level == -1 {
+		return c, nil
+	}
+	r, ok := compressionLevels[c.Method]
+	if !ok {
+		return nil, fmt.Errorf("compression '%s' has no levels", nonEmpty(c.Method, "default"))
+	}
+	if c.Level < r[0] || c.Level > r[1] {
+		return nil, fmt.Errorf("%s compression level %d out of range %d-%d", c.Method, c.Level, r[0], r[1])
+	}
+	return c, nil
+}
+
+// formatCompression resolves the compression of a format from the capabilities of its packager:
+// [pack.<format>] compression overrides --compression, an empty method selects the default of the format
+func (b *BarrowCtx) formatCompression(p *Package, format string) (*compressionSpec, error) {
+	spec := b.Compression
+	if pc, ok := p.Pack[format]; ok && pc != nil && len(pc.Compression) != 0 {
+		spec = pc.Compression
+	}
+	return p.packCompression(format, spec)
+}
+
+// packCompression checks spec against the capabilities of the packager of format,
+// compression-level and compression-threads of bali.toml complete it
+func (p *Package) packCompression(format, spec string) (*compressionSpec, error) {
+	pk, ok := LookupPackager(format)
+	if !ok || len(pk.Capabilities().Compressions) == 0 {
+		return nil, fmt.Errorf("%s does not support compression", format)
+	}
+	caps := pk.Capabilities()
+	if method, _, _ := strings.Cut(spec, ":"); len(strings.TrimSpace(method)) == 0 {
+		spec = caps.Compressions[0] + strings.TrimSpace(spec)
+	}
+	c, err := parseCompression(spec, p.CompressionLevel, p.CompressionThreads)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", format, err)
+	}
+	if !slices.Contains(caps.Compressions, c.Method) {
+		return nil, fmt.Errorf("%s does not support compression '%s', supported: %s", format, c.Method, strings.Join(caps.Compressions, ", "))
+	}
+	if c.Level != -1 && !slices.Contains(caps.Levels, c.Method) {
+		if strings.Contains(spec, ":") {
+			return nil, fmt.Errorf("%s %s compression does not support levels", format, c.Method)
+		}
+		// compression-level of bali.toml only applies where the packager honours it
+		c.Level = -1
+	}
+	return c, nil
+}
+
+func (c *compressionSpec) String() string {
+	if c.Level == -1 {
+		return c.Method
+	}
+	if c.Extreme {
+		return fmt.Sprintf("%s:%de", c.Method, c.Level)
+	}
+	return fmt.Sprintf("%s:%d", c.Method, c.Level)
+}
+
+func (c *compressionSpec) levelOr(defaultLevel int) int {
+	if c.Level == -1 {
+		return defaultLevel
+	}
+	return c.Level
+}
+
+// gzipWriter: pgzip compresses blocks in parallel when more than one thread is allowed
+func (c *compressionSpec) gzipWriter(w io.Writer) (io.WriteCloser, error) {
+	level := c.levelOr(gzip.DefaultCompression)
+	if c.Threads <= 1 {
+		return gzip.NewWriterLevel(w, level)
+	}
+	zw, err := pgzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.SetConcurrency(parallelGzipBlockSize, c.Threads); err != nil {
+		return nil, err
+	}
+	return zw, nil
+}
+
+func (c *compressionSpec) zstdWriter(w io.Writer) (io.WriteCloser, error) {
+	level := zstd.SpeedBestCompression
+	if c.Level != -1 {
+		level = zstd.EncoderLevelFromZstd(c.Level)
+	}
+	return zstd.NewWriter(w, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(c.Threads))
+}
+
+func (c *compressionSpec) xzWriter(w io.Writer) (io.WriteCloser, error) {
+	if c.Level == -1 {
+		return xz.NewWriter(w)
+	}
+	cfg := xz.WriterConfig{DictCap: xzDictCaps[c.Level]}
+	if c.Extreme {
+		// like xz -e: the slower binary tree match finder finds longer matches
+		cfg.Matcher = lzma.BinaryTree
+	}
+	return cfg.NewWriter(w)
+}
+
+func (c *compressionSpec) bzip2Writer(w io.Writer) (io.WriteCloser, error) {
+	return bzip2.NewWriter(w, &bzip2.WriterConfig{Level: c.levelOr(bzip2.DefaultCompression)})
+}
+
+func (c *compressionSpec) brotliWriter(w io.Writer) (io.WriteCloser, error) {
+	return brotli.NewWriterLevel(w, c.levelOr(brotli.DefaultCompression)), nil
+}
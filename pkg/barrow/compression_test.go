@@ -0,0 +1,209 @@
+package barrow
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/dsnet/compress/bzip2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestParseCompression(t *testing.T) {
+	level := 3
+	for _, tc := range []struct {
+		spec  string
+		level *int
+		want  string
+	}{
+		{"", nil, ""},
+		{"zstd", nil, "zstd"},
+		{"zstd:19", nil, "zstd:19"},
+		{"XZ:9", nil, "xz:9"},
+		{"xz:9e", &level, "xz:9e"},
+		{"gzip:1", &level, "gzip:1"},
+		{"gzip", &level, "gzip:3"},
+		{"brotli:11", nil, "brotli:11"},
+	} {
+		c, err := parseCompression(tc.spec, tc.level, 0)
+		if err != nil {
+			t.Fatalf("parse %q: %v", tc.spec, err)
+		}
+		if c.String() != tc.want || c.Threads < 1 {
+			t.Errorf("parse %q: %+v, want %s", tc.spec, c, tc.want)
+		}
+	}
+	for _, spec := range []string{"gzip:10", "zstd:0", "xz:x", "gzip:9e", "xz:e", "xz:10e", "none:1", "bzip2:0"} {
+		if _, err := parseCompression(spec, nil, 0); err == nil {
+			t.Errorf("parse %q succeeded", spec)
+		}
+	}
+}
+
+func TestFormatCompression(t *testing.T) {
+	level := 6
+	b := &BarrowCtx{}
+	p := &Package{CompressionLevel: &level, Pack: map[string]*PackConfig{"apk": {Compression: "gzip"}}}
+	for _, tc := range []struct {
+		compression string
+		format      string
+		want        string
+	}{
+		{"", "zip", "deflate:6"},
+		{"", "rpm", "gzip:6"},
+		{"", "arch", "zstd"},
+		{"", "appimage", "gzip"},
+		{"xz", "deb", "xz"},
+		{"zstd:19", "deb", "zstd:19"},
+		{"none", "tar", "none"},
+		{"zstd", "apk", "gzip"}, // [pack.apk]
+	} {
+		b.Compression = tc.compression
+		c, err := b.formatCompression(p, tc.format)
+		if err != nil {
+			t.Fatalf("%s %q: %v", tc.format, tc.compression, err)
+		}
+		if c.String() != tc.want {
+			t.Errorf("%s %q: got %s, want %s", tc.format, tc.compression, c, tc.want)
+		}
+	}
+	for _, tc := range [][2]string{{"zstd", "arch"}, {"xz", "rpm"}, {"xz", "deb"}} {
+		b.Compression = tc[0]
+		if _, err := b.formatCompression(&Package{}, tc[1]); err != nil {
+			t.Errorf("%s %q: %v", tc[1], tc[0], err)
+		}
+	}
+	for _, tc := range [][2]string{{"brotli", "rpm"}, {"xz", "apk"}, {"gzip", "arch"}, {"xz:9", "deb"}, {"lzma", "zip"}, {"zstd", "msi"}} {
+		b.Compression = tc[0]
+		if _, err := b.formatCompression(&Package{}, tc[1]); err == nil {
+			t.Errorf("%s %q succeeded", tc[1], tc[0])
+		}
+	}
+}
+
+func TestDebCompression(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	b.Compression = "zstd"
+	p.Pack = map[string]*PackConfig{"deb": {Compression: "xz"}}
+	artifact, err := b.deb(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte("data.tar.xz")) {
+		t.Fatalf("%s: expected a data.tar.xz member", artifact)
+	}
+	if _, err := OpenArtifact(artifact); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.apk(context.Background(), p, crates); err == nil {
+		t.Fatal("apk accepted zstd")
+	}
+}
+
+func TestCompressionWriters(t *testing.T) {
+	// larger than a pgzip block
+	payload := make([]byte, 3*parallelGzipBlockSize+12345)
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := range payload {
+		payload[i] = "abcdefgh"[r.IntN(8)]
+	}
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+		"xz":   func(r io.Reader) (io.Reader, error) { return xz.NewReader(r) },
+		"bzip2": func(r io.Reader) (io.Reader, error) {
+			return bzip2.NewReader(r, nil)
+		},
+		"brotli": func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	for _, tc := range []struct {
+		spec    string
+		threads int
+	}{
+		{"gzip:1", 1},
+		{"gzip:9", 4},
+		{"zstd:19", 4},
+		{"zstd:3", 1},
+		{"xz:6", 1},
+		{"xz:1", 1},
+		{"bzip2:9", 1},
+		{"brotli:5", 1},
+	} {
+		t.Run(fmt.Sprintf("%s-%d", tc.spec, tc.threads), func(t *testing.T) {
+			c, err := parseCompression(tc.spec, nil, tc.threads)
+			if err != nil {
+				t.Fatal(err)
+			}
+			newCompressor, _, err := tarCompressor(c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var buf bytes.Buffer
+			w, err := newCompressor(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := w.Write(payload); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			zr, err := readers[c.Method](&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(zr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, payload) {
+				t.Fatalf("round trip mismatch: %d bytes, want %d", len(got), len(payload))
+			}
+		})
+	}
+}
+
+func TestXzExtreme(t *testing.T) {
+	payload := bytes.Repeat([]byte("jack 1.2.3 linux/amd64\n"), 4096)
+	c, err := parseCompression("xz:9e", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Extreme || c.Level != 9 {
+		t.Fatalf("parse xz:9e: %+v", c)
+	}
+	var buf bytes.Buffer
+	w, err := c.xzWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := xz.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatalf("round trip mismatch: %d bytes, want %d", len(got), len(payload))
+	}
+}
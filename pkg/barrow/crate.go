@@ -1,19 +1,31 @@
 package barrow
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type Crate struct {
-	Name        string   `toml:"name"`
-	Description string   `toml:"description,omitempty"`
-	Destination string   `toml:"destination,omitempty"`
-	GoFlags     []string `toml:"goflags,omitempty"`
-	Version     string   `toml:"version,omitempty"`
-	Alias       []string `toml:"alias,omitempty"` // with out suffix
-	cwd         string   `toml:"-"`
+	Name        string         `toml:"name"`
+	Description string         `toml:"description,omitempty"`
+	Destination string         `toml:"destination,omitempty"`
+	GoFlags     []string       `toml:"goflags,omitempty"`
+	Version     string         `toml:"version,omitempty"`
+	Alias       []string       `toml:"alias,omitempty"` // with out suffix
+	Hooks       *Hooks         `toml:"hooks,omitempty"`
+	Service     *ServiceConfig `toml:"service,omitempty"`
+	Timeout     string         `toml:"timeout,omitempty"` // bounds the compilation of the crate, e.g. 5m
+	// completions and man pages printed by the built crate, installed into share
+	Completions    []string    `toml:"completions,omitempty"`     // bash, zsh, fish
+	CompletionArgs []string    `toml:"completion-args,omitempty"` // default: completion $BALI_SHELL
+	Manpages       bool        `toml:"manpages,omitempty"`
+	ManpageArgs    []string    `toml:"manpage-args,omitempty"` // default: man
+	cwd            string      `toml:"-"`
+	generated      []*FileItem `toml:"-"`
+	timeout        time.Duration
 }
 
 func (b *BarrowCtx) LoadCrate(location string) (*Crate, error) {
@@ -28,11 +40,18 @@ func (b *BarrowCtx) LoadCrate(location string) (*Crate, error) {
 		e.Name = filepath.Base(cwd)
 	}
 	if e.Name == "." {
-		return nil, fmt.Errorf("unable detect crate name. path '%s'", cwd)
+		return nil, keyError(file, "name", errors.New("unable to detect the crate name"))
 	}
 	if len(e.Version) == 0 {
 		e.Version = b.Getenv("BUILD_VERSION")
 	}
+	if len(e.Timeout) != 0 {
+		d, err := time.ParseDuration(e.Timeout)
+		if err != nil || d <= 0 {
+			return nil, keyError(file, "timeout", fmt.Errorf("invalid duration '%s', expected a duration such as 90s or 5m", e.Timeout))
+		}
+		e.timeout = d
+	}
 	return &e, nil
 }
 
@@ -58,7 +77,7 @@ func (b *BarrowCtx) cleanupResources(e *Crate) {
 		return
 	}
 	for _, item := range files {
-		fmt.Fprintf(os.Stderr, "rm: \x1b[33m%s\x1b[0m\n", item)
+		b.infof("rm: %s", item)
 		_ = os.Remove(item)
 	}
 }
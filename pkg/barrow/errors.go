@@ -0,0 +1,194 @@
+package barrow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+)
+
+var (
+	// ErrUnsupportedFormat: the pack format has no registered Packager
+	ErrUnsupportedFormat = errors.New("unsupported pack format")
+	// ErrUnsupportedTarget: the Go toolchain or the pack format does not support the target
+	ErrUnsupportedTarget = errors.New("unsupported target")
+)
+
+// ManifestError: bali.toml or crate.toml cannot be read or has an invalid value,
+// Line and Column are zero when the position is unknown
+type ManifestError struct {
+	File   string
+	Line   int
+	Column int
+	Key    string // dotted key, e.g. pack.deb.compression
+	Err    error
+}
+
+func (e *ManifestError) Error() string {
+	var sb strings.Builder
+	sb.WriteString(e.File)
+	if e.Line > 0 {
+		fmt.Fprintf(&sb, ":%d:%d", e.Line, e.Column)
+	}
+	if len(e.Key) != 0 {
+		fmt.Fprintf(&sb, ": key '%s'", e.Key)
+	}
+	sb.WriteString(": ")
+	sb.WriteString(strings.TrimPrefix(e.Err.Error(), "toml: "))
+	return sb.String()
+}
+
+func (e *ManifestError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ManifestError) Suggestion() string {
+	if errors.Is(e.Err, os.ErrNotExist) {
+		if filepath.Base(e.File) == "bali.toml" {
+			return "run bali in a module directory or select one with -M"
+		}
+		return "every directory listed in crates of bali.toml needs a crate.toml"
+	}
+	var de *toml.DecodeError
+	if errors.As(e.Err, &de) {
+		return fmt.Sprintf("fix %s near line %d:\n%s", filepath.Base(e.File), e.Line, strings.TrimRight(de.String(), "\n"))
+	}
+	return ""
+}
+
+// manifestError locates the decode errors of go-toml
+func manifestError(file string, err error) *ManifestError {
+	e := &ManifestError{File: file, Err: err}
+	var de *toml.DecodeError
+	if errors.As(err, &de) {
+		e.Line, e.Column = de.Position()
+		e.Key = strings.Join(de.Key(), ".")
+	}
+	return e
+}
+
+// keyError: a decoded value is invalid, the position of its key is looked up in the manifest
+func keyError(file, key string, err error) *ManifestError {
+	e := &ManifestError{File: file, Key: key, Err: err}
+	e.Line, e.Column = keyPosition(file, key)
+	return e
+}
+
+// keyPosition locates a dotted key or table of a TOML manifest, zero when it is not found
+func keyPosition(file, key string) (int, int) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return 0, 0
+	}
+	var p unstable.Parser
+	p.Reset(data)
+	var table []string
+	for p.NextExpression() {
+		e := p.Expression()
+		var parts []string
+		var first *unstable.Node
+		for it := e.Key(); it.Next(); {
+			if first == nil {
+				first = it.Node()
+			}
+			parts = append(parts, string(it.Node().Data))
+		}
+		if first == nil {
+			continue
+		}
+		if e.Kind != unstable.KeyValue {
+			table = parts
+		} else {
+			parts = slices.Concat(table, parts)
+		}
+		if strings.Join(parts, ".") == key {
+			pos := p.Shape(first.Raw).Start
+			return pos.Line, pos.Column
+		}
+	}
+	return 0, 0
+}
+
+// CompileError: a crate failed to compile, its resources, hooks or generators included.
+// ExitStatus is the status of the failed command, -1 when no command exited
+type CompileError struct {
+	Crate      string
+	ExitStatus int
+	Err        error
+}
+
+func newCompileError(crate string, err error) *CompileError {
+	e := &CompileError{Crate: crate, ExitStatus: -1, Err: err}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		e.ExitStatus = exitErr.ExitCode()
+	}
+	return e
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("crate %s: %v", e.Crate, e.Err)
+}
+
+func (e *CompileError) Unwrap() error {
+	return e.Err
+}
+
+func (e *CompileError) Suggestion() string {
+	switch {
+	case errors.Is(e.Err, context.DeadlineExceeded):
+		return "raise timeout in crate.toml if the crate needs more time"
+	case e.ExitStatus > 0:
+		return "the command output above shows the cause"
+	}
+	return ""
+}
+
+// PackError: a pack format failed, Artifact is the file being written, empty when none was started
+type PackError struct {
+	Format   string
+	Artifact string
+	Err      error
+}
+
+func (e *PackError) Error() string {
+	if len(e.Artifact) != 0 {
+		return fmt.Sprintf("pack %s %s: %v", e.Format, e.Artifact, e.Err)
+	}
+	return fmt.Sprintf("pack %s: %v", e.Format, e.Err)
+}
+
+func (e *PackError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PackError) Suggestion() string {
+	switch {
+	case errors.Is(e.Err, ErrUnsupportedFormat):
+		return "supported formats: " + strings.Join(PackagerNames(), ", ")
+	case errors.Is(e.Err, ErrUnsupportedTarget):
+		if pk, ok := LookupPackager(e.Format); ok {
+			return fmt.Sprintf("build %s with -T %s", e.Format, strings.Join(pk.Capabilities().Targets, " or -T "))
+		}
+	}
+	return ""
+}
+
+// Suggestion returns how to fix err when an error of its chain knows it, empty otherwise
+func Suggestion(err error) string {
+	var s interface{ Suggestion() string }
+	if errors.As(err, &s) {
+		return s.Suggestion()
+	}
+	if errors.Is(err, ErrUnsupportedTarget) {
+		return "'go tool dist list' prints the targets of the Go toolchain"
+	}
+	return ""
+}
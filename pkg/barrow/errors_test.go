@@ -0,0 +1,103 @@
+package barrow
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestManifestError(t *testing.T) {
+	b, _, _ := newTestModule(t)
+	baliFile := filepath.Join(b.CWD, "bali.toml")
+	if err := os.WriteFile(baliFile, []byte("name = \"jack\"\nversion = \"1.2.3\"\ncrates = \"cmd/jack\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := b.LoadPackage(b.CWD)
+	var me *ManifestError
+	if !errors.As(err, &me) || me.File != baliFile || me.Line != 3 || me.Key != "crates" {
+		t.Fatalf("type mismatch: %#v", err)
+	}
+	if !strings.HasPrefix(err.Error(), baliFile+":3:") || !strings.Contains(Suggestion(err), "crates") {
+		t.Fatalf("type mismatch message: %v, suggestion: %q", err, Suggestion(err))
+	}
+	if _, err := b.LoadPackage(t.TempDir()); !errors.As(err, &me) || !errors.Is(err, os.ErrNotExist) || !strings.Contains(Suggestion(err), "-M") {
+		t.Fatalf("missing bali.toml: %v", err)
+	}
+	crateFile := filepath.Join(b.CWD, "cmd/jack/crate.toml")
+	if err := os.WriteFile(crateFile, []byte("name = \"jack\"\ntimeout = \"soon\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.LoadCrate("cmd/jack"); !errors.As(err, &me) || me.File != crateFile || me.Line != 2 || me.Key != "timeout" {
+		t.Fatalf("invalid timeout: %v", err)
+	}
+}
+
+func TestManifestCompression(t *testing.T) {
+	b, _, _ := newTestModule(t)
+	baliFile := filepath.Join(b.CWD, "bali.toml")
+	tests := []struct {
+		manifest string
+		line     int
+		key      string
+	}{
+		{"compression-level = 23\n", 3, "compression-level"},
+		{"compression-threads = -1\n", 3, "compression-threads"},
+		{"[pack.deb]\ncompression = \"brotli\"\n", 4, "pack.deb.compression"},
+		{"[pack.tar]\ncompression = \"gzip:10\"\n", 4, "pack.tar.compression"},
+		{"[pack]\nrpm.compression = \"xz:6\"\n", 4, "pack.rpm.compression"},
+		{"[pack.dmg]\ncompression = \"zstd\"\n", 3, "pack.dmg"},
+	}
+	for _, tt := range tests {
+		if err := os.WriteFile(baliFile, []byte("name = \"jack\"\nversion = \"1.2.3\"\n"+tt.manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := b.LoadPackage(b.CWD)
+		var me *ManifestError
+		if !errors.As(err, &me) || me.File != baliFile || me.Line != tt.line || me.Key != tt.key {
+			t.Errorf("%q: %v", tt.manifest, err)
+		}
+	}
+	if err := os.WriteFile(baliFile, []byte("name = \"jack\"\ncompression-level = 19\n\n[pack.deb]\ncompression = \"zstd\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.LoadPackage(b.CWD); err != nil {
+		t.Fatalf("valid compression: %v", err)
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run sh")
+	}
+	b, _, _ := newTestModule(t)
+	crateFile := filepath.Join(b.CWD, "cmd/jack/crate.toml")
+	if err := os.WriteFile(crateFile, []byte("name = \"jack\"\n\n[hooks]\nbefore-build = [\"exit 3\"]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := b.compile(context.Background(), "cmd/jack")
+	var ce *CompileError
+	if !errors.As(err, &ce) || ce.Crate != "jack" || ce.ExitStatus != 3 {
+		t.Fatalf("failing hook: %v", err)
+	}
+	if err.Error() != "crate jack: hook before-build 'exit 3': exit status 3" {
+		t.Fatalf("failing hook message: %v", err)
+	}
+}
+
+func TestPackError(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	_, err := b.packArtifact(context.Background(), "dmg", p, crates)
+	var pe *PackError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrUnsupportedFormat) || !strings.Contains(Suggestion(err), "zip") {
+		t.Fatalf("unsupported format: %v", err)
+	}
+	b.Destination = filepath.Join(b.CWD, "LICENSE", "out") // not a directory
+	_, err = b.packArtifact(context.Background(), "tar", p, crates)
+	if !errors.As(err, &pe) || pe.Format != "tar" || pe.Artifact != filepath.Join(b.Destination, "jack-1.2.3-linux-amd64.tar.gz") {
+		t.Fatalf("destination is a file: %#v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package barrow
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/balibuild/bali/v3/modules/term"
+	"github.com/balibuild/bali/v3/modules/trace"
+)
+
+type EventKind int
+
+const (
+	EventStage    EventKind = iota // a build step: [compile] crate: bali version: 3.2.0 for linux/amd64
+	EventCommand                   // a command line about to run
+	EventArtifact                  // an artifact was written, Path and SHA256 are set
+	EventInfo                      // details of a step: summary rows, removed files
+	EventWarn                      // a problem that does not fail the build
+	EventError                     // an error, returned to the caller as well
+	EventDebug                     // verbose details
+	EventOutput                    // a line printed by go build, a hook or a generator
+	EventCrate                     // a crate changed Status, Path: its location in bali.toml
+	EventPack                      // a pack format changed Status, Stage: the format
+	EventProgress                  // the artifact of Stage grows, Written, Read and Total are set
+)
+
+// Status of a crate or a pack format in EventCrate and EventPack
+type Status int
+
+const (
+	StatusPending Status = iota
+	StatusRunning
+	StatusDone
+	StatusFailed
+)
+
+func (s Status) String() string {
+	switch s {
+	case StatusPending:
+		return "pending"
+	case StatusRunning:
+		return "running"
+	case StatusDone:
+		return "done"
+	case StatusFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// Event: everything a build reports goes through Logger, pkg/barrow never writes to the process stdio
+type Event struct {
+	Kind    EventKind
+	Stage   string // compile, install, hook, pack format ...
+	Message string
+	Path    string // EventArtifact: artifact path
+	SHA256  string // EventArtifact: hex digest
+	Stderr  bool   // EventOutput: the line was written to stderr
+	Status  Status // EventCrate, EventPack
+	Written int64  // EventProgress: bytes written to the artifact
+	Read    int64  // EventProgress: bytes of staged files read, formats packing through external libraries report none
+	Total   int64  // EventProgress: size of the staged files, zero when unknown
+}
+
+// Logger receives the events of a build, the embedding application decides how to show them.
+// EventProgress may come from the goroutine of a compressor
+type Logger interface {
+	Log(e *Event)
+}
+
+// LoggerFunc adapts a function to Logger
+type LoggerFunc func(e *Event)
+
+func (f LoggerFunc) Log(e *Event) {
+	f(e)
+}
+
+// colors of the console, downgraded by term.Level on 256 and 16 color terminals
+var (
+	colorStage    = term.RGB{R: 63, G: 247, B: 166}
+	colorMessage  = term.RGB{R: 39, G: 199, B: 173}
+	colorCommand  = term.RGB{R: 245, G: 202, B: 100}
+	colorArtifact = term.RGB{R: 0, G: 191, B: 255}
+	colorDebug    = term.RGB{R: 254, G: 225, B: 64}
+	colorTrace    = term.RGB{R: 128, G: 128, B: 128}
+)
+
+// ConsoleLogger prints events like the bali command line: artifacts to Stdout, everything else to Stderr.
+// The levels select the colors of each stream, the zero value prints plain text
+type ConsoleLogger struct {
+	Stdout      io.Writer
+	Stderr      io.Writer
+	StdoutLevel term.Level
+	StderrLevel term.Level
+	Level       slog.Level // lowest level printed: slog.LevelDebug adds EventDebug, trace.LevelTrace status changes and progress
+	mu          sync.Mutex
+}
+
+func (c *ConsoleLogger) Log(e *Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	level := c.StderrLevel
+	switch e.Kind {
+	case EventStage:
+		fmt.Fprintf(c.Stderr, "[%s] %s\n", level.Paint(colorStage, e.Stage), level.Paint(colorMessage, e.Message))
+	case EventCommand:
+		fmt.Fprintf(c.Stderr, "$> %s\n", level.Paint(colorCommand, e.Message))
+	case EventArtifact:
+		fmt.Fprintf(c.Stdout, "%s\n", c.StdoutLevel.Paint(colorArtifact, e.SHA256+"  "+e.Message))
+	case EventInfo:
+		fmt.Fprintf(c.Stderr, "%s\n", e.Message)
+	case EventWarn:
+		fmt.Fprintf(c.Stderr, "%s\n", level.Yellow(e.Message))
+	case EventError:
+		fmt.Fprintf(c.Stderr, "%s\n", level.Red(e.Message))
+	case EventDebug:
+		if c.Level <= slog.LevelDebug {
+			fmt.Fprintf(c.Stderr, "%s\n", level.Paint(colorDebug, "* "+e.Message))
+		}
+	case EventCrate, EventPack, EventProgress:
+		if c.Level <= trace.LevelTrace {
+			fmt.Fprintf(c.Stderr, "%s\n", level.Paint(colorTrace, "* "+traceMessage(e)))
+		}
+	case EventOutput:
+		// output of go build and hooks keeps its colors only when the stream has colors
+		if e.Stderr {
+			fmt.Fprintf(c.Stderr, "%s\n", term.SanitizeANSI(e.Message, level.SupportColor()))
+			return
+		}
+		fmt.Fprintf(c.Stdout, "%s\n", term.SanitizeANSI(e.Message, c.StdoutLevel.SupportColor()))
+	}
+}
+
+// traceMessage: crate cmd/bali (bali) running, pack deb done, pack deb 1.2 MiB written, 3.0 MiB of 8.0 MiB read
+func traceMessage(e *Event) string {
+	switch e.Kind {
+	case EventCrate:
+		return fmt.Sprintf("crate %s (%s) %s", e.Path, e.Message, e.Status)
+	case EventPack:
+		return fmt.Sprintf("pack %s %s", e.Stage, e.Status)
+	}
+	return fmt.Sprintf("pack %s %s written, %s of %s read", e.Stage, formatBytes(e.Written), formatBytes(e.Read), formatBytes(e.Total))
+}
+
+func (b *BarrowCtx) log(e *Event) {
+	if b.Logger == nil {
+		return
+	}
+	b.Logger.Log(e)
+}
+
+func (b *BarrowCtx) stage(s string, format string, a ...any) {
+	b.log(&Event{Kind: EventStage, Stage: s, Message: fmt.Sprintf(format, a...)})
+}
+
+func (b *BarrowCtx) status(format string, a ...any) {
+	b.log(&Event{Kind: EventCommand, Message: fmt.Sprintf(format, a...)})
+}
+
+// artifactWritten records a file written into Destination and reports its sha256
+func (b *BarrowCtx) artifactWritten(name, path string, h hash.Hash) {
+	sum := hex.EncodeToString(h.Sum(nil))
+	b.written = append(b.written, &ArtifactFile{Name: name, Path: path, SHA256: sum})
+	b.log(&Event{Kind: EventArtifact, Message: name, Path: path, SHA256: sum})
+}
+
+func (b *BarrowCtx) crateStatus(location, name string, s Status) {
+	b.log(&Event{Kind: EventCrate, Stage: "compile", Message: name, Path: location, Status: s})
+}
+
+func (b *BarrowCtx) packStatus(format string, s Status) {
+	b.log(&Event{Kind: EventPack, Stage: format, Status: s})
+}
+
+func (b *BarrowCtx) infof(format string, a ...any) {
+	b.log(&Event{Kind: EventInfo, Message: fmt.Sprintf(format, a...)})
+}
+
+func (b *BarrowCtx) warnf(format string, a ...any) {
+	b.log(&Event{Kind: EventWarn, Message: fmt.Sprintf(format, a...)})
+}
+
+func (b *BarrowCtx) errorf(format string, a ...any) {
+	b.log(&Event{Kind: EventError, Message: fmt.Sprintf(format, a...)})
+}
+
+func (b *BarrowCtx) debugf(format string, a ...any) {
+	b.log(&Event{Kind: EventDebug, Message: strings.TrimRight(fmt.Sprintf(format, a...), "\n")})
+}
+
+// outputWriter turns the output of a command into EventOutput lines,
+// stdout and stderr share mu so the logger is never called concurrently
+type outputWriter struct {
+	b      *BarrowCtx
+	stage  string
+	stderr bool
+	mu     *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadBytes('\n')
+		if err != nil {
+			// keep the incomplete line for the next write
+			w.buf.Write(line)
+			return len(p), nil
+		}
+		w.b.log(&Event{Kind: EventOutput, Stage: w.stage, Message: strings.TrimRight(string(line), "\r\n"), Stderr: w.stderr})
+	}
+}
+
+// Flush reports the last line without a newline
+func (w *outputWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.buf.Len() != 0 {
+		w.b.log(&Event{Kind: EventOutput, Stage: w.stage, Message: w.buf.String(), Stderr: w.stderr})
+		w.buf.Reset()
+	}
+}
+
+// captureOutput reports the stdout and stderr of cmd as EventOutput, call the returned function after the command exited
+func (b *BarrowCtx) captureOutput(cmd *exec.Cmd, stage string) func() {
+	var mu sync.Mutex
+	stdout := &outputWriter{b: b, stage: stage, mu: &mu}
+	stderr := &outputWriter{b: b, stage: stage, stderr: true, mu: &mu}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return func() {
+		stdout.Flush()
+		stderr.Flush()
+	}
+}
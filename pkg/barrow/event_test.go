@@ -0,0 +1,154 @@
+package barrow
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/balibuild/bali/v3/modules/term"
+	"github.com/balibuild/bali/v3/modules/trace"
+)
+
+func TestEvents(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	var events []*Event
+	b.Logger = LoggerFunc(func(e *Event) {
+		if e.Kind != EventPack && e.Kind != EventProgress {
+			events = append(events, e)
+		}
+	})
+	pr, err := b.packArtifact(context.Background(), "zip", p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].Kind != EventArtifact || events[0].Path != pr.Path || events[0].SHA256 != pr.Files[0].SHA256 {
+		t.Fatalf("zip events: %+v", events)
+	}
+	if runtime.GOOS == "windows" {
+		return
+	}
+	events = nil
+	cmd := exec.Command("sh", "-c", "echo one; echo two >&2; printf three")
+	flush := b.captureOutput(cmd, "hook")
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	flush()
+	lines := make(map[string]bool)
+	for _, e := range events {
+		if e.Kind != EventOutput || e.Stage != "hook" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+		lines[e.Message] = e.Stderr
+	}
+	if len(lines) != 3 || lines["one"] || !lines["two"] || lines["three"] {
+		t.Fatalf("command output events: %v", lines)
+	}
+}
+
+func TestNew(t *testing.T) {
+	b := New("/src/jack", WithTarget("linux", "arm64"), WithPack("tar", "deb"), WithDestination("dist"))
+	if b.Out != "/src/jack/build" || b.Target != "linux" || b.Arch != "arm64" || len(b.Pack) != 2 || b.Destination != "dist" || b.Logger != nil {
+		t.Fatalf("New: %+v", b)
+	}
+}
+
+func TestPackProgress(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	var events []*Event
+	b.Logger = LoggerFunc(func(e *Event) {
+		events = append(events, e)
+	})
+	pr, err := b.packArtifact(context.Background(), "tar", p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	si, err := os.Stat(pr.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var statuses []Status
+	var last *Event
+	for _, e := range events {
+		switch e.Kind {
+		case EventPack:
+			statuses = append(statuses, e.Status)
+		case EventProgress:
+			last = e
+		}
+	}
+	if len(statuses) != 2 || statuses[0] != StatusRunning || statuses[1] != StatusDone {
+		t.Fatalf("pack statuses: %v", statuses)
+	}
+	if last == nil || last.Stage != "tar" || last.Written != si.Size() || last.Total == 0 || last.Read != last.Total {
+		t.Fatalf("last progress: %+v, artifact size %d", last, si.Size())
+	}
+}
+
+func TestProgressLogger(t *testing.T) {
+	out, err := os.Create(filepath.Join(t.TempDir(), "view"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	var console bytes.Buffer
+	v := NewProgressLogger(&ConsoleLogger{Stdout: &console, Stderr: &console}, out, term.LevelNone)
+	v.Log(&Event{Kind: EventCrate, Path: "cmd/jack", Message: "jack", Status: StatusPending})
+	v.Log(&Event{Kind: EventPack, Stage: "tar", Status: StatusPending})
+	v.Log(&Event{Kind: EventCrate, Path: "cmd/jack", Message: "jack", Status: StatusDone})
+	v.Log(&Event{Kind: EventInfo, Message: "rm: build/jack"})
+	v.Close()
+	view, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"· compile jack", "· pack    tar          pending", "✓ compile jack", "\x1b[2A\x1b[J"} {
+		if !bytes.Contains(view, []byte(want)) {
+			t.Errorf("view does not contain %q:\n%s", want, view)
+		}
+	}
+	if console.String() != "rm: build/jack\n" {
+		t.Errorf("console lines: %q", console.String())
+	}
+}
+
+func TestConsoleLogger(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	c := &ConsoleLogger{Stdout: &stdout, Stderr: &stderr}
+	c.Log(&Event{Kind: EventStage, Stage: "compile", Message: "crate: jack"})
+	c.Log(&Event{Kind: EventOutput, Message: "\x1b[31mred\x1b[0m\a"})
+	c.Log(&Event{Kind: EventDebug, Message: "hidden"})
+	if stderr.String() != "[compile] crate: jack\n" || stdout.String() != "red^G\n" {
+		t.Fatalf("plain console: %q %q", stderr.String(), stdout.String())
+	}
+	stderr.Reset()
+	c.StderrLevel = term.Level256
+	c.Log(&Event{Kind: EventStage, Stage: "compile", Message: "crate: jack"})
+	if stderr.String() != "[\x1b[38;5;85mcompile\x1b[0m] \x1b[38;5;43mcrate: jack\x1b[0m\n" {
+		t.Fatalf("256 color console: %q", stderr.String())
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	var console bytes.Buffer
+	l := MultiLogger{
+		&ConsoleLogger{Stdout: &console, Stderr: &console},
+		&SlogLogger{Logger: slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: trace.LevelTrace}))},
+	}
+	l.Log(&Event{Kind: EventArtifact, Message: "jack.tar.gz", Path: "out/jack.tar.gz", SHA256: "e3b0"})
+	l.Log(&Event{Kind: EventPack, Stage: "tar", Status: StatusDone})
+	if console.String() != "e3b0  jack.tar.gz\n" {
+		t.Fatalf("console: %q", console.String())
+	}
+	for _, want := range []string{`"msg":"artifact","name":"jack.tar.gz","path":"out/jack.tar.gz","sha256":"e3b0"`, `"level":"DEBUG-4","msg":"pack","format":"tar","status":"done"`} {
+		if !bytes.Contains(buf.Bytes(), []byte(want)) {
+			t.Errorf("log does not contain %s:\n%s", want, buf.String())
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package barrow
+
+import (
+	"archive/zip"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+type ExeConfig struct {
+	Prefix    string      `toml:"prefix,omitempty"`    // default install location, %VAR% expanded by the installer
+	Scope     string      `toml:"scope,omitempty"`     // user (default) or machine
+	Resources string      `toml:"resources,omitempty"` // directory of the installer winres.toml, default: the first crate
+	Shortcuts []*Shortcut `toml:"shortcuts,omitempty"`
+}
+
+// exeSetup: installer configuration stored in the zip comment, see resources/exestub/setup.go
+type exeSetup struct {
+	Name      string      `json:"name"`
+	Version   string      `json:"version"`
+	Publisher string      `json:"publisher,omitempty"`
+	Homepage  string      `json:"homepage,omitempty"`
+	Scope     string      `json:"scope,omitempty"`
+	Prefix    string      `json:"prefix,omitempty"`
+	StubSize  int64       `json:"stub_size"`
+	Shortcuts []*exeEntry `json:"shortcuts,omitempty"`
+}
+
+type exeEntry struct {
+	Name        string `json:"name"`
+	Target      string `json:"target"`
+	Arguments   string `json:"arguments,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+//go:embed resources/exestub/*.go
+var exeStub embed.FS
+
+const (
+	exeStubDir   = "resources/exestub"
+	exeStubGoMod = "module balisetup\n\ngo 1.22\n"
+)
+
+// buildExeStub compiles the installer stub for the target arch, with version information and icon
+func (b *BarrowCtx) buildExeStub(ctx context.Context, p *Package, crates []*Crate, cfg *ExeConfig, dir string) (string, error) {
+	entries, err := fs.ReadDir(exeStub, exeStubDir)
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		if strings.HasSuffix(e.Name(), "_test.go") {
+			continue
+		}
+		data, err := exeStub.ReadFile(path.Join(exeStubDir, e.Name()))
+		if err != nil {
+			return "", err
+		}
+		if err := os.WriteFile(filepath.Join(dir, e.Name()), data, 0644); err != nil {
+			return "", err
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(exeStubGoMod), 0644); err != nil {
+		return "", err
+	}
+	resources := &Crate{
+		Name:        p.Name + "-setup",
+		Description: nonEmpty(p.Summary, p.Name) + " Setup",
+		Version:     p.Version,
+	}
+	switch {
+	case len(cfg.Resources) != 0:
+		resources.cwd = filepath.Join(b.CWD, cfg.Resources)
+	case len(crates) != 0:
+		resources.cwd = crates[0].cwd
+	default:
+		resources.cwd = b.CWD
+	}
+	if err := b.makeResources(resources, filepath.Join(dir, "windows_"+b.Arch+".syso")); err != nil {
+		return "", fmt.Errorf("build installer resources error: %w", err)
+	}
+	output := "setup.exe"
+	cmd := commandContext(ctx, "go", "build", "-trimpath", "-ldflags", "-s -w", "-o", output)
+	cmd.Dir = dir
+	flush := b.captureOutput(cmd, "exe")
+	defer flush()
+	cmd.Env = append(environWithArch(b.environ, b.Arch), "GOOS=windows", "CGO_ENABLED=0", "GOWORK=off", "GOFLAGS=")
+	b.stage("exe", "build installer stub for windows/%s", b.Arch)
+	b.status("%s", cmdStringsArgs(cmd))
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("build installer stub error: %w", err)
+	}
+	return filepath.Join(dir, output), nil
+}
+
+func (b *BarrowCtx) exeSetup(p *Package, cfg *ExeConfig, crates []*Crate) (*exeSetup, error) {
+	scope := nonEmpty(strings.ToLower(cfg.Scope), "user")
+	if scope != "user" && scope != "machine" {
+		return nil, fmt.Errorf("exe: unsupported scope '%s', supported: user, machine", cfg.Scope)
+	}
+	setup := &exeSetup{
+		Name:      p.Name,
+		Version:   p.Version,
+		Publisher: nonEmpty(p.Vendor, p.Maintainer),
+		Homepage:  p.Homepage,
+		Scope:     scope,
+		Prefix:    cfg.Prefix,
+	}
+	installed := make(map[string]bool)
+	for _, item := range p.Include {
+		installed[strings.ToLower(AsRelativePath(filepath.Join(item.Destination, nonEmpty(item.Rename, filepath.Base(item.Path)))))] = true
+	}
+	for _, crate := range crates {
+		installed[strings.ToLower(AsRelativePath(filepath.Join(crate.Destination, b.basename(crate.Name))))] = true
+	}
+	for _, s := range cfg.Shortcuts {
+		target := AsRelativePath(s.Target)
+		if !installed[strings.ToLower(target)] {
+			return nil, fmt.Errorf("exe: shortcut '%s' target '%s' is not installed by this package", s.Name, s.Target)
+		}
+		setup.Shortcuts = append(setup.Shortcuts, &exeEntry{Name: s.Name, Target: target, Arguments: s.Arguments, Description: s.Description})
+	}
+	return setup, nil
+}
+
+// exeInternal writes stub + zip payload, zip offsets include the stub so the installer opens itself as a zip
+func (b *BarrowCtx) exeInternal(ctx context.Context, p *Package, crates []*Crate, stub string, setup *exeSetup, w io.Writer) error {
+	sfd, err := os.Open(stub)
+	if err != nil {
+		return err
+	}
+	defer sfd.Close()
+	stubSize, err := io.Copy(w, sfd)
+	if err != nil {
+		return err
+	}
+	setup.StubSize = stubSize
+	comment, err := json.Marshal(setup)
+	if err != nil {
+		return err
+	}
+	z := zip.NewWriter(w)
+	z.SetOffset(stubSize)
+	if err := z.SetComment(string(comment)); err != nil {
+		return err
+	}
+	staged, err := b.Stage(p, crates, "")
+	if err != nil {
+		return err
+	}
+	// the stub only decodes deflate
+	for _, f := range staged {
+		if err := addStaged2Zip(ctx, z, f, zip.Deflate); err != nil {
+			_ = z.Close()
+			return err
+		}
+	}
+	return z.Close()
+}
+
+func (b *BarrowCtx) exe(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	if b.Target != "windows" {
+		return "", fmt.Errorf("exe requires target windows, current target: %s", b.Target)
+	}
+	cfg := p.Exe
+	if cfg == nil {
+		cfg = &ExeConfig{}
+	}
+	setup, err := b.exeSetup(p, cfg, crates)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "bali-exe-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	stub, err := b.buildExeStub(ctx, p, crates, cfg, dir)
+	if err != nil {
+		return "", err
+	}
+	name, err := b.ArtifactName("exe", p, nil)
+	if err != nil {
+		return "", err
+	}
+	return b.WriteArtifact(ctx, name, 0755, func(w io.Writer) error {
+		return b.exeInternal(ctx, p, crates, stub, setup, w)
+	})
+}
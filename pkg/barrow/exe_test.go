@@ -0,0 +1,65 @@
+package barrow
+
+import (
+	"archive/zip"
+	"context"
+	"debug/pe"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExe(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles the installer stub")
+	}
+	b, p, crates := newTestModule(t)
+	b.Target = "windows"
+	b.makeEnv()
+	if err := os.WriteFile(filepath.Join(b.Out, "bin", "jack.exe"), []byte("MZ jack"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p.Exe = &ExeConfig{Shortcuts: []*Shortcut{{Name: "Jack", Target: "bin/jack.exe"}}}
+	artifact, err := b.exe(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pf, err := pe.Open(artifact)
+	if err != nil {
+		t.Fatalf("installer is not a PE file: %v", err)
+	}
+	_ = pf.Close()
+	zr, err := zip.OpenReader(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	var setup exeSetup
+	if err := json.Unmarshal([]byte(zr.Comment), &setup); err != nil {
+		t.Fatal(err)
+	}
+	if setup.Name != "jack" || setup.Version != "1.2.3" || setup.Scope != "user" || setup.StubSize <= 0 || len(setup.Shortcuts) != 1 {
+		t.Fatalf("unexpected setup %+v", setup)
+	}
+	names := make(map[string]bool)
+	for _, f := range zr.File {
+		names[f.Name] = true
+	}
+	for _, name := range []string{"share/JACK-LICENSE.txt", "bin/jack.exe"} {
+		if !names[name] {
+			t.Fatalf("payload missing %s", name)
+		}
+	}
+	a, err := OpenArtifact(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Format != "exe" || len(a.Signatures) != 0 || a.Lookup("bin/jack.exe") == nil {
+		t.Fatalf("inspect installer: format %s signatures %v", a.Format, a.Signatures)
+	}
+	p.Exe.Shortcuts[0].Target = "bin/missing.exe"
+	if _, err := b.exeSetup(p, p.Exe, crates); err == nil {
+		t.Fatal("expected shortcut target error")
+	}
+}
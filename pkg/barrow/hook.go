@@ -0,0 +1,80 @@
+package barrow
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// Hooks: commands executed at fixed points of the build
+//
+//	[hooks]
+//	before-build = ["go generate ./..."]
+//	after-pack = ["./script/upload.sh $BALI_ARTIFACT_PATH"]
+type Hooks struct {
+	BeforeBuild []string `toml:"before-build,omitempty"` // before any include is installed or crate is compiled
+	AfterCrate  []string `toml:"after-crate,omitempty"`  // after each crate is compiled
+	BeforePack  []string `toml:"before-pack,omitempty"`  // before each pack format
+	AfterPack   []string `toml:"after-pack,omitempty"`   // after each artifact is created
+}
+
+const (
+	HookBeforeBuild = "before-build"
+	HookAfterCrate  = "after-crate"
+	HookBeforePack  = "before-pack"
+	HookAfterPack   = "after-pack"
+)
+
+func (h *Hooks) commands(name string) []string {
+	if h == nil {
+		return nil
+	}
+	switch name {
+	case HookBeforeBuild:
+		return h.BeforeBuild
+	case HookAfterCrate:
+		return h.AfterCrate
+	case HookBeforePack:
+		return h.BeforePack
+	case HookAfterPack:
+		return h.AfterPack
+	}
+	return nil
+}
+
+func hookShell(command string) (string, []string) {
+	if runtime.GOOS == "windows" {
+		return "cmd", []string{"/C", command}
+	}
+	return "sh", []string{"-c", command}
+}
+
+// runHooks: run hook commands in dir with b.environ and extra artifact-specific variables.
+// any failure aborts the build
+func (b *BarrowCtx) runHooks(ctx context.Context, h *Hooks, name string, dir string, extra map[string]string) error {
+	commands := h.commands(name)
+	if len(commands) == 0 {
+		return nil
+	}
+	environ := make([]string, 0, len(b.environ)+len(extra)+1)
+	environ = append(environ, b.environ...)
+	environ = append(environ, "BALI_HOOK="+name)
+	for k, v := range extra {
+		environ = append(environ, k+"="+v)
+	}
+	for _, command := range commands {
+		shell, args := hookShell(command)
+		cmd := commandContext(ctx, shell, args...)
+		cmd.Dir = dir
+		cmd.Env = environ
+		flush := b.captureOutput(cmd, "hook")
+		b.stage("hook", "%s", name)
+		b.status("%s", command)
+		err := cmd.Run()
+		flush()
+		if err != nil {
+			return fmt.Errorf("hook %s '%s': %w", name, command, err)
+		}
+	}
+	return nil
+}
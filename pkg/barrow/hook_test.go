@@ -0,0 +1,125 @@
+package barrow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// recordHook: a hook command writing its working directory and BALI_* environment to name.txt
+func recordHook(name string) string {
+	return fmt.Sprintf(`"pwd -P > %[1]s.txt && env | grep ^BALI_ | sort >> %[1]s.txt"`, name)
+}
+
+// newHookModule: a module with a main package, module hooks and an after-crate crate hook, packed as tar
+func newHookModule(t *testing.T, moduleHooks string) *BarrowCtx {
+	t.Helper()
+	cwd := t.TempDir()
+	files := map[string]string{
+		"go.mod":           "module jack\n\ngo 1.22\n",
+		"cmd/jack/main.go": "package main\n\nfunc main() {}\n",
+		"bali.toml": `name = "jack"
+version = "1.2.3"
+crates = ["cmd/jack"]
+
+[hooks]
+` + moduleHooks,
+		"cmd/jack/crate.toml": `name = "jack"
+version = "0.1.0"
+destination = "bin"
+
+[hooks]
+after-crate = [` + recordHook("crate-after-crate") + `]
+`,
+	}
+	for name, content := range files {
+		p := filepath.Join(cwd, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := &BarrowCtx{
+		CWD:         cwd,
+		Out:         filepath.Join(cwd, "build"),
+		Target:      runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		Destination: filepath.Join(cwd, "out"),
+		Pack:        []string{"tar"},
+		extraEnv:    map[string]string{"GOOS": runtime.GOOS, "GOARCH": runtime.GOARCH},
+	}
+	b.makeEnv()
+	return b
+}
+
+func readHookRecord(t *testing.T, name string) (string, []string) {
+	t.Helper()
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return lines[0], lines[1:]
+}
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run sh")
+	}
+	b := newHookModule(t, "before-build = ["+recordHook("module-before-build")+"]\nafter-pack = ["+recordHook("module-after-pack")+"]\n")
+	if _, err := b.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	cwd, err := filepath.EvalSymlinks(b.CWD)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, environ := readHookRecord(t, filepath.Join(b.CWD, "module-before-build.txt"))
+	if dir != cwd || strings.Join(environ, " ") != "BALI_HOOK=before-build" {
+		t.Errorf("module before-build hook: dir %s env %v", dir, environ)
+	}
+	dir, environ = readHookRecord(t, filepath.Join(b.CWD, "cmd/jack/crate-after-crate.txt"))
+	want := []string{
+		"BALI_ARTIFACT_NAME=jack",
+		"BALI_ARTIFACT_PATH=" + filepath.Join(b.Out, "bin/jack"),
+		"BALI_CRATE_NAME=jack",
+		"BALI_CRATE_VERSION=0.1.0",
+		"BALI_HOOK=after-crate",
+	}
+	if dir != filepath.Join(cwd, "cmd/jack") || strings.Join(environ, " ") != strings.Join(want, " ") {
+		t.Errorf("crate after-crate hook: dir %s env %v", dir, environ)
+	}
+	artifact := fmt.Sprintf("jack-1.2.3-%s-%s.tar.gz", b.Target, b.Arch)
+	dir, environ = readHookRecord(t, filepath.Join(b.CWD, "module-after-pack.txt"))
+	want = []string{
+		"BALI_ARTIFACT_NAME=" + artifact,
+		"BALI_ARTIFACT_PATH=" + filepath.Join(b.Destination, artifact),
+		"BALI_HOOK=after-pack",
+		"BALI_PACK_FORMAT=tar",
+	}
+	if dir != cwd || strings.Join(environ, " ") != strings.Join(want, " ") {
+		t.Errorf("module after-pack hook: dir %s env %v", dir, environ)
+	}
+}
+
+func TestFailingHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks run sh")
+	}
+	b := newHookModule(t, `before-build = ["exit 2"]`)
+	_, err := b.Run(context.Background())
+	var exitErr interface{ ExitCode() int }
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 2 {
+		t.Fatalf("failing before-build hook: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(b.CWD, "cmd/jack/crate-after-crate.txt")); !os.IsNotExist(err) {
+		t.Fatalf("crate compiled after a failing hook: %v", err)
+	}
+}
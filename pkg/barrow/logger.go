@@ -0,0 +1,55 @@
+package barrow
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/balibuild/bali/v3/modules/trace"
+)
+
+// SlogLogger records events with a slog.Logger, nil: slog.Default(). Errors and warnings keep their level,
+// steps, commands, artifacts and command output are info, EventDebug debug, status changes and progress trace
+type SlogLogger struct {
+	Logger *slog.Logger
+}
+
+func (s *SlogLogger) Log(e *Event) {
+	l := s.Logger
+	if l == nil {
+		l = slog.Default()
+	}
+	ctx := context.Background()
+	switch e.Kind {
+	case EventStage:
+		l.Info(e.Message, "stage", e.Stage)
+	case EventCommand:
+		l.Info("run", "command", e.Message)
+	case EventArtifact:
+		l.Info("artifact", "name", e.Message, "path", e.Path, "sha256", e.SHA256)
+	case EventInfo:
+		l.Info(e.Message)
+	case EventWarn:
+		l.Warn(e.Message)
+	case EventError:
+		l.Error(e.Message)
+	case EventDebug:
+		l.Debug(e.Message)
+	case EventOutput:
+		l.Info(e.Message, "stage", e.Stage, "stderr", e.Stderr)
+	case EventCrate:
+		l.Log(ctx, trace.LevelTrace, "crate", "location", e.Path, "name", e.Message, "status", e.Status.String())
+	case EventPack:
+		l.Log(ctx, trace.LevelTrace, "pack", "format", e.Stage, "status", e.Status.String())
+	case EventProgress:
+		l.Log(ctx, trace.LevelTrace, "progress", "format", e.Stage, "name", e.Message, "written", e.Written, "read", e.Read, "total", e.Total)
+	}
+}
+
+// MultiLogger sends each event to all its loggers in order, e.g. a ConsoleLogger and a SlogLogger writing a log file
+type MultiLogger []Logger
+
+func (m MultiLogger) Log(e *Event) {
+	for _, l := range m {
+		l.Log(e)
+	}
+}
@@ -1,14 +1,13 @@
 package barrow
 
 import (
-	"encoding/hex"
-	"fmt"
-	"hash"
+	"context"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 func nonEmpty(a string, dv string) string {
@@ -70,16 +69,54 @@ func NormalizeAbsoluteDirPath(path string) string {
 	return NormalizeAbsoluteFilePath(strings.TrimRight(path, "/")) + "/"
 }
 
-func hashPrint(h hash.Hash, name string) {
-	fmt.Fprintf(os.Stdout, "\x1b[38;2;0;191;255m%s  %s\x1b[0m\n", hex.EncodeToString(h.Sum(nil)), name)
+const (
+	// commands interrupted by a cancelled build are killed when they have not exited after this delay
+	commandWaitDelay = 10 * time.Second
+)
+
+// commandContext: like exec.CommandContext, but a cancelled build interrupts the command first
+// so go build and hooks can remove their temporary files
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	interruptOnCancel(cmd)
+	cmd.WaitDelay = commandWaitDelay
+	return cmd
+}
+
+// contextReader fails reads once ctx is cancelled, copy loops stop at the next buffer.
+// reads are counted by the pack progress of ctx
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
 }
 
-func stage(s string, format string, a ...any) {
-	fmt.Fprintf(os.Stderr, "[\x1b[38;2;63;247;166m%s\x1b[0m] \x1b[38;02;39;199;173m%s\x1b[0m\n", s, fmt.Sprintf(format, a...))
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := r.r.Read(p)
+	if pp := progressFrom(r.ctx); pp != nil {
+		pp.read.Add(int64(n))
+	}
+	return n, err
+}
+
+// contextWriter fails once ctx is done, it interrupts writers of external libraries between two writes
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
 }
 
-func status(format string, a ...any) {
-	fmt.Fprintf(os.Stderr, "$> \x1b[38;02;245;202;100m%s\x1b[0m\n", fmt.Sprintf(format, a...))
+// copyContext: io.Copy interrupted by ctx
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	return io.Copy(dst, &contextReader{ctx: ctx, r: src})
 }
 
 // func status(format string, a ...any) {
@@ -0,0 +1,568 @@
+package barrow
+
+import (
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/balibuild/bali/v3/modules/cab"
+	"github.com/balibuild/bali/v3/modules/msi"
+)
+
+// MsiRegistry: a registry value written at install time and removed on uninstall
+type MsiRegistry struct {
+	Root  string `toml:"root,omitempty"` // HKLM (default) HKCU HKCR HKU
+	Key   string `toml:"key"`
+	Name  string `toml:"name,omitempty"`
+	Value string `toml:"value"`
+}
+
+type MsiConfig struct {
+	ProductCode string         `toml:"product-code,omitempty"` // default: derived from upgrade-code, version and arch
+	UpgradeCode string         `toml:"upgrade-code,omitempty"` // keep it stable across versions
+	InstallDir  string         `toml:"install-dir,omitempty"`  // relative to Program Files, default: package name
+	Shortcuts   []*Shortcut    `toml:"shortcuts,omitempty"`
+	Registry    []*MsiRegistry `toml:"registry,omitempty"`
+}
+
+const (
+	msiCabinet         = "product.cab"
+	msiFeature         = "Complete"
+	msiInstallDir      = "INSTALLDIR"
+	msiUpgradeProp     = "BALI_UPGRADE_DETECTED"
+	msiComponent64Bit  = 256
+	msiRegistryKeyPath = 4
+)
+
+var (
+	// namespace of bali derived GUIDs
+	msiNamespace = [16]byte{0xB5, 0xE8, 0xF1, 0xC2, 0x8A, 0x7D, 0x4F, 0x3E, 0x9C, 0x61, 0x2D, 0x4A, 0x7B, 0x0E, 0x93, 0xF5}
+)
+
+var (
+	msiRegistryRoots = map[string]int{
+		"HKCR": 0, "HKEY_CLASSES_ROOT": 0,
+		"HKCU": 1, "HKEY_CURRENT_USER": 1,
+		"HKLM": 2, "HKEY_LOCAL_MACHINE": 2,
+		"HKU": 3, "HKEY_USERS": 3,
+	}
+	msiExecuteSequence = []msiAction{
+		{"FindRelatedProducts", 25},
+		{"ValidateProductID", 700},
+		{"CostInitialize", 800},
+		{"FileCost", 900},
+		{"CostFinalize", 1000},
+		{"MigrateFeatureStates", 1200},
+		{"InstallValidate", 1400},
+		{"RemoveExistingProducts", 1401},
+		{"InstallInitialize", 1500},
+		{"ProcessComponents", 1600},
+		{"UnpublishFeatures", 1800},
+		{"RemoveRegistryValues", 2600},
+		{"RemoveShortcuts", 3200},
+		{"RemoveFiles", 3500},
+		{"InstallFiles", 4000},
+		{"CreateShortcuts", 4500},
+		{"WriteRegistryValues", 5000},
+		{"RegisterUser", 6000},
+		{"RegisterProduct", 6100},
+		{"PublishFeatures", 6300},
+		{"PublishProduct", 6400},
+		{"InstallFinalize", 6600},
+	}
+	msiUISequence = []msiAction{
+		{"FindRelatedProducts", 25},
+		{"ValidateProductID", 700},
+		{"CostInitialize", 800},
+		{"FileCost", 900},
+		{"CostFinalize", 1000},
+		{"MigrateFeatureStates", 1200},
+		{"ExecuteAction", 1300},
+	}
+)
+
+type msiAction struct {
+	action   string
+	sequence int
+}
+
+// msiPlatform: summary template platform, program files folder and component attributes
+func msiPlatform(arch string) (string, string, int, error) {
+	switch arch {
+	case "amd64":
+		return "x64", "ProgramFiles64Folder", msiComponent64Bit, nil
+	case "arm64":
+		return "Arm64", "ProgramFiles64Folder", msiComponent64Bit, nil
+	case "386":
+		return "Intel", "ProgramFilesFolder", 0, nil
+	}
+	return "", "", 0, fmt.Errorf("msi does not support arch '%s'", arch)
+}
+
+// msiProductVersion: major.minor.build, major and minor <= 255, build <= 65535
+func msiProductVersion(version string) (string, error) {
+	v := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(v, "-+"); i != -1 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	limits := []int{255, 255, 65535}
+	numbers := make([]string, 0, 3)
+	for i, s := range parts {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > limits[i] {
+			return "", fmt.Errorf("version '%s' is not a valid msi product version (major.minor.build)", version)
+		}
+		numbers = append(numbers, strconv.Itoa(n))
+	}
+	for len(numbers) < 3 {
+		numbers = append(numbers, "0")
+	}
+	return strings.Join(numbers, "."), nil
+}
+
+// msiID: a stable identifier for table keys
+func msiID(prefix string, key string) string {
+	h := sha256.Sum256([]byte(strings.ToLower(key)))
+	return prefix + strings.ToUpper(hex.EncodeToString(h[:12]))
+}
+
+func msiTruncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+func isShortNameChar(c rune) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// msiShortNames generates unique 8.3 names for every directory
+type msiShortNames map[string]map[string]bool
+
+func (s msiShortNames) filename(dir, name string) string {
+	used, ok := s[dir]
+	if !ok {
+		used = make(map[string]bool)
+		s[dir] = used
+	}
+	base, ext := name, ""
+	if i := strings.LastIndexByte(name, '.'); i > 0 {
+		base, ext = name[:i], name[i+1:]
+	}
+	valid := len(base) <= 8 && len(ext) <= 3 && strings.IndexFunc(base+ext, func(c rune) bool { return !isShortNameChar(c) }) == -1
+	if valid && !used[strings.ToUpper(name)] {
+		used[strings.ToUpper(name)] = true
+		return name
+	}
+	clean := func(s string, n int) string {
+		var sb strings.Builder
+		for _, c := range strings.ToUpper(s) {
+			if sb.Len() == n {
+				break
+			}
+			if isShortNameChar(c) {
+				sb.WriteRune(c)
+			}
+		}
+		return sb.String()
+	}
+	base, ext = clean(base, 6), clean(ext, 3)
+	for i := 1; ; i++ {
+		suffix := "~" + strconv.Itoa(i)
+		short := base[:min(len(base), 8-len(suffix))] + suffix
+		if len(ext) != 0 {
+			short += "." + ext
+		}
+		if !used[short] {
+			used[short] = true
+			return short + "|" + name
+		}
+	}
+}
+
+type msiFile struct {
+	key       string
+	component string
+	directory string
+	rel       string // install path relative to INSTALLDIR
+	source    string
+}
+
+type msiBuilder struct {
+	db        *msi.Database
+	directory *msi.Table
+	shorts    msiShortNames
+	dirs      map[string]string // relative path --> directory id
+	files     []*msiFile
+}
+
+// dir returns the directory id of a path relative to INSTALLDIR
+func (m *msiBuilder) dir(rel string) (string, error) {
+	if rel == "." || rel == "" {
+		return msiInstallDir, nil
+	}
+	if id, ok := m.dirs[rel]; ok {
+		return id, nil
+	}
+	parent, err := m.dir(path.Dir(rel))
+	if err != nil {
+		return "", err
+	}
+	id := msiID("dir", rel)
+	if err := m.directory.Insert(id, parent, m.shorts.filename(parent, path.Base(rel))); err != nil {
+		return "", err
+	}
+	m.dirs[rel] = id
+	return id, nil
+}
+
+func (m *msiBuilder) addFile(rel, source string) error {
+	rel = AsRelativePath(rel)
+	si, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if !si.Mode().IsRegular() {
+		return nil // directories, symlinks: nothing to install
+	}
+	for _, f := range m.files {
+		if strings.EqualFold(f.rel, rel) {
+			return fmt.Errorf("msi: duplicate file '%s'", rel)
+		}
+	}
+	dir, err := m.dir(path.Dir(rel))
+	if err != nil {
+		return err
+	}
+	m.files = append(m.files, &msiFile{
+		key:       msiID("fil", rel),
+		component: msiID("cmp", rel),
+		directory: dir,
+		rel:       rel,
+		source:    source,
+	})
+	return nil
+}
+
+func (m *msiBuilder) lookup(rel string) *msiFile {
+	rel = AsRelativePath(rel)
+	for _, f := range m.files {
+		if strings.EqualFold(f.rel, rel) {
+			return f
+		}
+	}
+	return nil
+}
+
+func (b *BarrowCtx) msiCodes(p *Package, manufacturer string) (upgradeCode [16]byte, productCode [16]byte, err error) {
+	cfg := p.Msi
+	if cfg != nil && len(cfg.UpgradeCode) != 0 {
+		if upgradeCode, err = msi.ParseGUID(cfg.UpgradeCode); err != nil {
+			return
+		}
+	} else {
+		upgradeCode = msi.NameGUID(msiNamespace, manufacturer+"/"+p.Name)
+		b.stage("msi", "upgrade-code not set, using derived %s", msi.GUID(upgradeCode))
+	}
+	if cfg != nil && len(cfg.ProductCode) != 0 {
+		productCode, err = msi.ParseGUID(cfg.ProductCode)
+		return
+	}
+	productCode = msi.NameGUID(upgradeCode, p.Version+"/"+b.Arch)
+	return
+}
+
+func (b *BarrowCtx) makeMsiDatabase(p *Package, crates []*Crate) (*msiBuilder, error) {
+	platform, programFiles, componentAttrs, err := msiPlatform(b.Arch)
+	if err != nil {
+		return nil, err
+	}
+	version, err := msiProductVersion(p.Version)
+	if err != nil {
+		return nil, err
+	}
+	cfg := p.Msi
+	if cfg == nil {
+		cfg = &MsiConfig{}
+	}
+	manufacturer := nonEmpty(p.Vendor, nonEmpty(p.Maintainer, p.Name))
+	upgradeCode, productCode, err := b.msiCodes(p, manufacturer)
+	if err != nil {
+		return nil, err
+	}
+	db := msi.NewDatabase()
+	db.Summary = &msi.SummaryInfo{
+		Title:       "Installation Database",
+		Subject:     p.Name,
+		Author:      manufacturer,
+		Keywords:    "Installer",
+		Comments:    nonEmpty(p.Summary, p.Description),
+		Template:    platform + ";1033",
+		PackageCode: msi.GUID(msi.RandomGUID()),
+		PageCount:   500,
+		WordCount:   msi.WordCountCompressed,
+		AppName:     "bali",
+		Security:    2,
+	}
+	m := &msiBuilder{db: db, shorts: make(msiShortNames), dirs: make(map[string]string)}
+	// Directory
+	m.directory = db.CreateTable("Directory", msi.S("Directory", 72).PrimaryKey(), msi.S("Directory_Parent", 72).AllowNull(), msi.L("DefaultDir", 255))
+	rows := [][]any{
+		{"TARGETDIR", nil, "SourceDir"},
+		{programFiles, "TARGETDIR", "."},
+		{"ProgramMenuFolder", "TARGETDIR", "."},
+	}
+	installDir := strings.Trim(filepath.ToSlash(nonEmpty(cfg.InstallDir, p.Name)), "/")
+	parent := programFiles
+	elems := strings.Split(installDir, "/")
+	for i, e := range elems {
+		id := msiID("dir", "<programfiles>/"+strings.Join(elems[:i+1], "/"))
+		if i == len(elems)-1 {
+			id = msiInstallDir
+		}
+		rows = append(rows, []any{id, parent, m.shorts.filename(parent, e)})
+		parent = id
+	}
+	for _, row := range rows {
+		if err := m.directory.Insert(row...); err != nil {
+			return nil, err
+		}
+	}
+	// File layout: same as zip/tar archives, aliases are skipped (no symlinks)
+	for _, item := range p.Include {
+		rel := filepath.Join(item.Destination, nonEmpty(item.Rename, filepath.Base(item.Path)))
+		if err := m.addFile(rel, filepath.Join(b.CWD, item.Path)); err != nil {
+			return nil, err
+		}
+	}
+	for _, crate := range crates {
+		baseName := b.basename(crate.Name)
+		if err := m.addFile(filepath.Join(crate.Destination, baseName), filepath.Join(b.Out, crate.Destination, baseName)); err != nil {
+			return nil, err
+		}
+	}
+	if len(m.files) == 0 {
+		return nil, errors.New("msi: nothing to install")
+	}
+	component := db.CreateTable("Component", msi.S("Component", 72).PrimaryKey(), msi.S("ComponentId", 38).AllowNull(),
+		msi.S("Directory_", 72), msi.I2("Attributes"), msi.S("Condition", 255).AllowNull(), msi.S("KeyPath", 72).AllowNull())
+	file := db.CreateTable("File", msi.S("File", 72).PrimaryKey(), msi.S("Component_", 72), msi.L("FileName", 255),
+		msi.I4("FileSize"), msi.S("Version", 72).AllowNull(), msi.S("Language", 20).AllowNull(), msi.I2("Attributes").AllowNull(), msi.I4("Sequence"))
+	featureComponents := db.CreateTable("FeatureComponents", msi.S("Feature_", 38).PrimaryKey(), msi.S("Component_", 72).PrimaryKey())
+	for i, f := range m.files {
+		si, err := os.Stat(f.source)
+		if err != nil {
+			return nil, err
+		}
+		if si.Size() > 0x7FFFFFFF {
+			return nil, fmt.Errorf("msi: file '%s' too large", f.rel)
+		}
+		componentID := msi.GUID(msi.NameGUID(upgradeCode, "component/"+b.Arch+"/"+strings.ToLower(f.rel)))
+		if err := component.Insert(f.component, componentID, f.directory, componentAttrs, nil, f.key); err != nil {
+			return nil, err
+		}
+		if err := file.Insert(f.key, f.component, m.shorts.filename(f.directory, path.Base(f.rel)), int(si.Size()), nil, nil, nil, i+1); err != nil {
+			return nil, err
+		}
+		if err := featureComponents.Insert(msiFeature, f.component); err != nil {
+			return nil, err
+		}
+	}
+	// Registry: install location and user defined values, kept by one component
+	registry := db.CreateTable("Registry", msi.S("Registry", 72).PrimaryKey(), msi.I2("Root"), msi.L("Key", 255),
+		msi.L("Name", 255).AllowNull(), msi.L("Value", 0).AllowNull(), msi.S("Component_", 72))
+	const registryComponent = "cmpRegistry"
+	registryKey := `Software\` + manufacturer + `\` + p.Name
+	if err := registry.Insert("regInstallDir", msiRegistryRoots["HKLM"], registryKey, "InstallDir", "[INSTALLDIR]", registryComponent); err != nil {
+		return nil, err
+	}
+	for _, r := range cfg.Registry {
+		root, ok := msiRegistryRoots[strings.ToUpper(nonEmpty(r.Root, "HKLM"))]
+		if !ok {
+			return nil, fmt.Errorf("msi: unsupported registry root '%s'", r.Root)
+		}
+		var name any
+		if len(r.Name) != 0 {
+			name = r.Name
+		}
+		id := msiID("reg", strconv.Itoa(root)+`\`+r.Key+`\`+r.Name)
+		if err := registry.Insert(id, root, r.Key, name, b.ExpandEnv(r.Value), registryComponent); err != nil {
+			return nil, err
+		}
+	}
+	if err := component.Insert(registryComponent, msi.GUID(msi.NameGUID(upgradeCode, "component/"+b.Arch+"/registry")), msiInstallDir, componentAttrs|msiRegistryKeyPath, nil, "regInstallDir"); err != nil {
+		return nil, err
+	}
+	if err := featureComponents.Insert(msiFeature, registryComponent); err != nil {
+		return nil, err
+	}
+	// Shortcut: non-advertised, owned by the component of the target
+	shortcut := db.CreateTable("Shortcut", msi.S("Shortcut", 72).PrimaryKey(), msi.S("Directory_", 72), msi.L("Name", 128),
+		msi.S("Component_", 72), msi.S("Target", 72), msi.S("Arguments", 255).AllowNull(), msi.L("Description", 255).AllowNull(),
+		msi.I2("Hotkey").AllowNull(), msi.S("Icon_", 72).AllowNull(), msi.I2("IconIndex").AllowNull(), msi.I2("ShowCmd").AllowNull(), msi.S("WkDir", 72).AllowNull())
+	for _, s := range cfg.Shortcuts {
+		target := m.lookup(s.Target)
+		if target == nil {
+			return nil, fmt.Errorf("msi: shortcut '%s' target '%s' is not installed by this package", s.Name, s.Target)
+		}
+		var arguments, description any
+		if len(s.Arguments) != 0 {
+			arguments = s.Arguments
+		}
+		if len(s.Description) != 0 {
+			description = msiTruncate(s.Description, 255)
+		}
+		if err := shortcut.Insert(msiID("sct", s.Name), "ProgramMenuFolder", m.shorts.filename("ProgramMenuFolder", s.Name+".lnk"),
+			target.component, "[#"+target.key+"]", arguments, description, nil, nil, nil, nil, target.directory); err != nil {
+			return nil, err
+		}
+	}
+	feature := db.CreateTable("Feature", msi.S("Feature", 38).PrimaryKey(), msi.S("Feature_Parent", 38).AllowNull(), msi.L("Title", 64).AllowNull(),
+		msi.L("Description", 255).AllowNull(), msi.I2("Display").AllowNull(), msi.I2("Level"), msi.S("Directory_", 72).AllowNull(), msi.I2("Attributes"))
+	if err := feature.Insert(msiFeature, nil, msiTruncate(p.Name, 64), msiTruncate(nonEmpty(p.Summary, p.Name), 255), 1, 1, msiInstallDir, 0); err != nil {
+		return nil, err
+	}
+	media := db.CreateTable("Media", msi.I2("DiskId").PrimaryKey(), msi.I4("LastSequence"), msi.L("DiskPrompt", 64).AllowNull(),
+		msi.S("Cabinet", 255).AllowNull(), msi.S("VolumeLabel", 32).AllowNull(), msi.S("Source", 72).AllowNull())
+	if err := media.Insert(1, len(m.files), nil, "#"+msiCabinet, nil, nil); err != nil {
+		return nil, err
+	}
+	property := db.CreateTable("Property", msi.S("Property", 72).PrimaryKey(), msi.L("Value", 0))
+	properties := [][2]string{
+		{"ProductCode", msi.GUID(productCode)},
+		{"UpgradeCode", msi.GUID(upgradeCode)},
+		{"ProductName", p.Name},
+		{"ProductVersion", version},
+		{"ProductLanguage", "1033"},
+		{"Manufacturer", manufacturer},
+		{"ALLUSERS", "1"},
+		{"SecureCustomProperties", msiUpgradeProp},
+		{"ARPCOMMENTS", p.Summary},
+		{"ARPURLINFOABOUT", p.Homepage},
+	}
+	for _, kv := range properties {
+		if len(kv[1]) == 0 {
+			continue
+		}
+		if err := property.Insert(kv[0], kv[1]); err != nil {
+			return nil, err
+		}
+	}
+	// Upgrade: major upgrade removes older versions
+	upgrade := db.CreateTable("Upgrade", msi.S("UpgradeCode", 38).PrimaryKey(), msi.S("VersionMin", 20).PrimaryKey().AllowNull(),
+		msi.S("VersionMax", 20).PrimaryKey().AllowNull(), msi.S("Language", 255).PrimaryKey().AllowNull(), msi.I4("Attributes").PrimaryKey(),
+		msi.S("Remove", 255).AllowNull(), msi.S("ActionProperty", 72))
+	if err := upgrade.Insert(msi.GUID(upgradeCode), nil, version, nil, 1, nil, msiUpgradeProp); err != nil {
+		return nil, err
+	}
+	for _, seq := range []struct {
+		name    string
+		actions []msiAction
+	}{{"InstallExecuteSequence", msiExecuteSequence}, {"InstallUISequence", msiUISequence}} {
+		actions := seq.actions
+		t := db.CreateTable(seq.name, msi.S("Action", 72).PrimaryKey(), msi.S("Condition", 255).AllowNull(), msi.I2("Sequence").AllowNull())
+		for _, a := range actions {
+			if err := t.Insert(a.action, nil, a.sequence); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// writeCabinet compresses installed files into the cabinet file, cabinet names are File keys
+func (m *msiBuilder) writeCabinet(ctx context.Context, spool *os.File, out io.Writer) error {
+	cw := cab.NewWriter(spool, flate.BestCompression)
+	for _, f := range m.files {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if err := m.addCabinetFile(cw, f); err != nil {
+			return err
+		}
+	}
+	_, err := cw.WriteTo(out)
+	return err
+}
+
+func (m *msiBuilder) addCabinetFile(cw *cab.Writer, f *msiFile) error {
+	fd, err := os.Open(f.source)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	si, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+	return cw.AddFile(f.key, si.ModTime(), fd)
+}
+
+func (b *BarrowCtx) msi(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	if b.Target != "windows" {
+		return "", fmt.Errorf("msi requires target windows, current target: %s", b.Target)
+	}
+	m, err := b.makeMsiDatabase(p, crates)
+	if err != nil {
+		return "", err
+	}
+	msiName, err := b.ArtifactName("msi", p, nil)
+	if err != nil {
+		return "", err
+	}
+	msiPath := b.destinationPath(msiName)
+	_ = os.MkdirAll(filepath.Dir(msiPath), 0755)
+	spool, err := os.CreateTemp(filepath.Dir(msiPath), ".bali-msi-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+	cabFd, err := os.CreateTemp(filepath.Dir(msiPath), ".bali-cab-*")
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = cabFd.Close()
+		_ = os.Remove(cabFd.Name())
+	}()
+	if err := m.writeCabinet(ctx, spool, cabFd); err != nil {
+		return "", err
+	}
+	cabSize, err := cabFd.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	if _, err := cabFd.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	m.db.AddStream(msiCabinet, cabFd, cabSize)
+	return b.WriteArtifact(ctx, msiName, 0644, func(w io.Writer) error {
+		_, err := m.db.WriteTo(w)
+		return err
+	})
+}
@@ -0,0 +1,82 @@
+package barrow
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/balibuild/bali/v3/modules/cfb"
+	"github.com/balibuild/bali/v3/modules/msi"
+)
+
+func TestMsi(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	b.Target = "windows"
+	if err := os.WriteFile(filepath.Join(b.Out, "bin", "jack.exe"), []byte("MZ jack"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p.Msi = &MsiConfig{
+		UpgradeCode: "{3F2504E0-4F89-11D3-9A0C-0305E82C3301}",
+		InstallDir:  "Bali Build/Jack",
+		Shortcuts:   []*Shortcut{{Name: "Jack Command Line", Target: "bin/jack.exe"}},
+		Registry:    []*MsiRegistry{{Root: "HKCU", Key: `Software\Jack`, Name: "Version", Value: "${BUILD_VERSION}"}},
+	}
+	artifact, err := b.msi(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := cfb.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, table := range []string{"Directory", "Component", "File", "Feature", "FeatureComponents", "Registry", "Shortcut", "Media", "Property", "Upgrade", "InstallExecuteSequence"} {
+		if _, err := r.ReadStream(msi.StreamName(table, true)); err != nil {
+			t.Fatalf("table %s: %v", table, err)
+		}
+	}
+	// File: File, Component_, FileName, FileSize (i4), Version, Language, Attributes, Sequence (i4)
+	files, err := r.ReadStream(msi.StreamName("File", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2*20 {
+		t.Fatalf("expected 2 files, File table size %d", len(files))
+	}
+	cabinet, err := r.ReadStream(msi.StreamName(msiCabinet, false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(cabinet, []byte("MSCF")) {
+		t.Fatal("bad cabinet stream")
+	}
+	a, err := OpenArtifact(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Format != "msi" || len(a.Signatures) != 0 || a.Lookup(msiCabinet) == nil || !strings.Contains(a.Metadata["tables"], "InstallExecuteSequence") {
+		t.Fatalf("inspect msi: format %s signatures %v tables %s", a.Format, a.Signatures, a.Metadata["tables"])
+	}
+	b.Target = "linux"
+	if _, err := b.msi(context.Background(), p, crates); err == nil {
+		t.Fatal("expected msi error for linux target")
+	}
+}
+
+func TestMsiProductVersion(t *testing.T) {
+	for v, expected := range map[string]string{"1.2.3": "1.2.3", "v2.0": "2.0.0", "3.1.4-beta.1": "3.1.4", "1.2.3.4": "1.2.3"} {
+		got, err := msiProductVersion(v)
+		if err != nil || got != expected {
+			t.Fatalf("msiProductVersion(%s) = %s, %v", v, got, err)
+		}
+	}
+	if _, err := msiProductVersion("256.0.0"); err == nil {
+		t.Fatal("expected error")
+	}
+}
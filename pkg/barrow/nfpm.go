@@ -2,12 +2,9 @@ package barrow
 
 import (
 	"context"
-	"crypto/sha256"
 	"io"
 	"io/fs"
-	"os"
-	"path/filepath"
-	"strconv"
+	"strings"
 
 	"github.com/goreleaser/nfpm/v2"
 	"github.com/goreleaser/nfpm/v2/apk"
@@ -16,132 +13,114 @@ import (
 	"github.com/goreleaser/nfpm/v2/files"
 )
 
-func (b *BarrowCtx) addItem2Nfpm(info *nfpm.Info, item *FileItem, prefix string) error {
-	itemPath := filepath.Join(b.CWD, item.Path)
-	var nameInArchive string
-	switch {
-	case len(item.Rename) != 0:
-		nameInArchive = filepath.Join(prefix, item.Destination, item.Rename)
-	default:
-		nameInArchive = filepath.Join(prefix, item.Destination, filepath.Base(item.Path))
-	}
-	si, err := os.Stat(itemPath)
-	if err != nil {
-		return err
+// nfpmFormat: deb, apk and arch packages only differ in the nfpm packager
+type nfpmFormat struct {
+	name        string
+	packager    nfpm.Packager
+	archs       map[string]string // GOARCH to the architecture of the distribution
+	compression bool              // apply --compression, the compression of apk and arch packages is fixed
+	services    bool              // install systemd units, apk targets OpenRC
+	version     func(info *nfpm.Info) string
+}
+
+var (
+	nfpmDeb = &nfpmFormat{
+		name:     "deb",
+		packager: deb.Default,
+		// https://wiki.debian.org/ArchitectureSpecificsMemo
+		archs: map[string]string{
+			"386":      "i386",
+			"arm5":     "armel",
+			"arm6":     "armhf",
+			"arm7":     "armhf",
+			"mips64le": "mips64el",
+			"mipsle":   "mipsel",
+			"ppc64le":  "ppc64el",
+			"s390":     "s390x",
+		},
+		compression: true,
+		services:    true,
+		version: func(info *nfpm.Info) string {
+			return info.Version + affix("~", info.Prerelease) + affix("+", info.VersionMetadata)
+		},
 	}
-	mode := si.Mode().Perm()
-	if len(item.Permissions) != 0 {
-		if m, err := strconv.ParseInt(item.Permissions, 8, 64); err == nil {
-			mode = fs.FileMode(m)
-		}
+	nfpmApk = &nfpmFormat{
+		name:     "apk",
+		packager: apk.Default,
+		archs: map[string]string{
+			"all":     "noarch",
+			"386":     "x86",
+			"amd64":   "x86_64",
+			"arm64":   "aarch64",
+			"arm6":    "armhf",
+			"arm7":    "armv7",
+			"s390":    "s390x",
+			"loong64": "loongarch64",
+		},
+		version: func(info *nfpm.Info) string {
+			return info.Version + affix("_", info.Prerelease)
+		},
 	}
-	info.Contents = append(info.Contents, &files.Content{
-		Source:      itemPath,
-		Destination: nameInArchive,
-		FileInfo: &files.ContentFileInfo{
-			Owner: "root",
-			Group: "root",
-			Mode:  mode,
-			MTime: si.ModTime(),
-			Size:  si.Size(),
+	nfpmArch = &nfpmFormat{
+		name:     "arch",
+		packager: arch.Default,
+		archs: map[string]string{
+			"all":   "any",
+			"amd64": "x86_64",
+			"386":   "i686",
+			"arm64": "aarch64",
+			"arm7":  "armv7h",
+			"arm6":  "armv6h",
+			"arm5":  "arm",
 		},
-	})
-	return nil
-}
+		services: true,
+		version: func(info *nfpm.Info) string {
+			return info.Version + strings.ReplaceAll(info.Prerelease, "-", "_")
+		},
+	}
+)
 
-func (b *BarrowCtx) addCrate2Nfpm(info *nfpm.Info, crate *Crate, prefix string) error {
-	baseName := b.basename(crate.Name)
-	out := filepath.Join(b.Out, crate.Destination, baseName)
-	si, err := os.Lstat(out)
-	if err != nil {
-		return err
+// affix: sep+s, empty when s is empty
+func affix(sep, s string) string {
+	if len(s) == 0 {
+		return ""
 	}
-	nameInArchive := filepath.Join(prefix, crate.Destination, baseName)
-	info.Contents = append(info.Contents, &files.Content{
-		Source:      out,
-		Destination: AsExplicitRelativePath(nameInArchive),
-		FileInfo: &files.ContentFileInfo{
-			Owner: "root",
-			Group: "root",
-			Mode:  0o755,
-			MTime: si.ModTime(),
-			Size:  si.Size(),
-		},
-	})
-	for _, a := range crate.Alias {
-		aliasExpend := filepath.Join(prefix, b.ExpandEnv(b.basename(a)))
-		aliasPath, err := filepath.Rel(filepath.Dir(aliasExpend), filepath.Dir(nameInArchive))
-		if err != nil {
-			return err
+	return sep + s
+}
+
+func addStaged2Nfpm(info *nfpm.Info, staged []*StagedFile) {
+	for _, f := range staged {
+		if f.Mode&fs.ModeSymlink != 0 {
+			info.Contents = append(info.Contents, &files.Content{
+				Source:      AsExplicitRelativePath(f.Link),
+				Destination: AsExplicitRelativePath(f.Name),
+				Type:        files.TypeSymlink,
+			})
+			continue
 		}
-		aliasLink := filepath.Join(aliasPath, filepath.Base(nameInArchive))
 		info.Contents = append(info.Contents, &files.Content{
-			Source:      AsExplicitRelativePath(aliasLink),
-			Destination: AsExplicitRelativePath(aliasExpend),
-			Type:        files.TypeSymlink,
+			Source:      f.Source,
+			Destination: AsExplicitRelativePath(f.Name),
+			FileInfo: &files.ContentFileInfo{
+				Owner: "root",
+				Group: "root",
+				Mode:  f.Mode.Perm(),
+				MTime: f.ModTime,
+				Size:  f.Size,
+			},
 		})
 	}
-	return nil
 }
 
-func (b *BarrowCtx) deb(ctx context.Context, p *Package, crates []*Crate) error {
+func (b *BarrowCtx) nfpmPackage(ctx context.Context, p *Package, crates []*Crate, format *nfpmFormat) (string, error) {
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return "", ctx.Err()
 	default:
 	}
-	if len(p.Maintainer) == 0 {
-		p.Maintainer = "Unset Maintainer <unset@localhost>"
-	}
-	info := nfpm.WithDefaults(&nfpm.Info{
-		Name:        p.Name,
-		Platform:    b.Target,
-		Arch:        b.Arch,
-		Description: p.Description,
-		Version:     p.Version,
-		Release:     b.Release,
-		Maintainer:  p.Maintainer,
-		Vendor:      p.Vendor,
-		Homepage:    p.Homepage,
-		License:     p.License,
-	})
-	for _, item := range p.Include {
-		if err := b.addItem2Nfpm(info, item, p.Prefix); err != nil {
-			return err
-		}
-	}
-	for _, crate := range crates {
-		if err := b.addCrate2Nfpm(info, crate, p.Prefix); err != nil {
-			return err
-		}
-	}
-	debPackageName := deb.Default.ConventionalFileName(info)
-	var debPath string
-	if filepath.IsAbs(b.Destination) {
-		debPath = filepath.Join(b.Destination, debPackageName)
-	} else {
-		debPath = filepath.Join(b.CWD, b.Destination, debPackageName)
-	}
-	_ = os.MkdirAll(filepath.Dir(debPath), 0755)
-	fd, err := os.Create(debPath)
+	c, err := b.formatCompression(p, format.name)
 	if err != nil {
-		return err
-	}
-	defer fd.Close()
-	h := sha256.New()
-	w := io.MultiWriter(fd, h)
-	if err := deb.Default.Package(info, w); err != nil {
-		return err
-	}
-	hashPrint(h, debPackageName)
-	return nil
-}
-
-func (b *BarrowCtx) apk(ctx context.Context, p *Package, crates []*Crate) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
+		return "", err
 	}
 	if len(p.Maintainer) == 0 {
 		p.Maintainer = "Unset Maintainer <unset@localhost>"
@@ -152,93 +131,51 @@ func (b *BarrowCtx) apk(ctx context.Context, p *Package, crates []*Crate) error
 		Arch:        b.Arch,
 		Description: p.Description,
 		Version:     p.Version,
-		Release:     b.Release,
+		Release:     nonEmpty(b.Release, "1"),
 		Maintainer:  p.Maintainer,
 		Vendor:      p.Vendor,
 		Homepage:    p.Homepage,
 		License:     p.License,
 	})
-	for _, item := range p.Include {
-		if err := b.addItem2Nfpm(info, item, p.Prefix); err != nil {
-			return err
-		}
-	}
-	for _, crate := range crates {
-		if err := b.addCrate2Nfpm(info, crate, p.Prefix); err != nil {
-			return err
-		}
+	if format.compression {
+		info.Deb.Compression = c.String()
 	}
-	apkPackageName := apk.Default.ConventionalFileName(info)
-	var apkPath string
-	if filepath.IsAbs(b.Destination) {
-		apkPath = filepath.Join(b.Destination, apkPackageName)
-	} else {
-		apkPath = filepath.Join(b.CWD, b.Destination, apkPackageName)
-	}
-	_ = os.MkdirAll(filepath.Dir(apkPath), 0755)
-	fd, err := os.Create(apkPath)
+	staged, err := b.Stage(p, crates, p.Prefix)
 	if err != nil {
-		return err
-	}
-	defer fd.Close()
-	h := sha256.New()
-	w := io.MultiWriter(fd, h)
-	if err := apk.Default.Package(info, w); err != nil {
-		return err
+		return "", err
 	}
-	hashPrint(h, apkPackageName)
-	return nil
-}
-
-func (b *BarrowCtx) archLinux(ctx context.Context, p *Package, crates []*Crate) error {
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	default:
-	}
-	if len(p.Maintainer) == 0 {
-		p.Maintainer = "Unset Maintainer <unset@localhost>"
-	}
-	info := nfpm.WithDefaults(&nfpm.Info{
-		Name:        p.Name,
-		Platform:    b.Target,
-		Arch:        b.Arch,
-		Description: p.Description,
-		Version:     p.Version,
-		Release:     b.Release,
-		Maintainer:  p.Maintainer,
-		Vendor:      p.Vendor,
-		Homepage:    p.Homepage,
-		License:     p.License,
-	})
-	for _, item := range p.Include {
-		if err := b.addItem2Nfpm(info, item, p.Prefix); err != nil {
-			return err
+	addStaged2Nfpm(info, staged)
+	if format.services {
+		cleanup, err := b.addServices2Nfpm(info, p, crates, format.name)
+		if err != nil {
+			return "", err
 		}
+		defer cleanup()
 	}
-	for _, crate := range crates {
-		if err := b.addCrate2Nfpm(info, crate, p.Prefix); err != nil {
-			return err
-		}
+	if a, ok := format.archs[info.Arch]; ok {
+		info.Arch = a
 	}
-	archLinuxPackageName := arch.Default.ConventionalFileName(info)
-	var archLinuxPath string
-	if filepath.IsAbs(b.Destination) {
-		archLinuxPath = filepath.Join(b.Destination, archLinuxPackageName)
-	} else {
-		archLinuxPath = filepath.Join(b.CWD, b.Destination, archLinuxPackageName)
+	release := info.Release
+	if format == nfpmApk {
+		release = strings.TrimPrefix(release, "r") // the naming adds the r of pkgver
 	}
-	_ = os.MkdirAll(filepath.Dir(archLinuxPath), 0755)
-	fd, err := os.Create(archLinuxPath)
+	name, err := b.ArtifactName(format.name, p, map[string]string{"version": format.version(info), "release": release, "arch": info.Arch})
 	if err != nil {
-		return err
-	}
-	defer fd.Close()
-	h := sha256.New()
-	w := io.MultiWriter(fd, h)
-	if err := arch.Default.Package(info, w); err != nil {
-		return err
+		return "", err
 	}
-	hashPrint(h, archLinuxPackageName)
-	return nil
+	return b.WriteArtifact(ctx, name, 0644, func(w io.Writer) error {
+		return format.packager.Package(info, w)
+	})
+}
+
+func (b *BarrowCtx) deb(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	return b.nfpmPackage(ctx, p, crates, nfpmDeb)
+}
+
+func (b *BarrowCtx) apk(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	return b.nfpmPackage(ctx, p, crates, nfpmApk)
+}
+
+func (b *BarrowCtx) archLinux(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	return b.nfpmPackage(ctx, p, crates, nfpmArch)
 }
@@ -0,0 +1,117 @@
+package barrow
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// nixSystems: Nix system doubles of an archive, universal darwin archives serve both CPUs
+func nixSystems(target, arch string) []string {
+	cpus := map[string][]string{
+		"amd64":       {"x86_64"},
+		"arm64":       {"aarch64"},
+		"386":         {"i686"},
+		"arm":         {"armv7l"},
+		"riscv64":     {"riscv64"},
+		ArchUniversal: {"x86_64", "aarch64"},
+	}[arch]
+	switch target {
+	case "linux", "darwin":
+	default:
+		return nil
+	}
+	systems := make([]string, 0, len(cpus))
+	for _, cpu := range cpus {
+		systems = append(systems, cpu+"-"+target)
+	}
+	return systems
+}
+
+// nixString: double quoted, without antiquotation
+func nixString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// nixHash: SRI hash of a hex sha256
+func nixHash(sum string) (string, error) {
+	raw, err := hex.DecodeString(sum)
+	if err != nil {
+		return "", err
+	}
+	return "sha256-" + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+func (b *BarrowCtx) nixDerivation(p *Package, crates []*Crate, archives []*releaseArchive) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("{ lib, stdenvNoCC, fetchurl, zstd }:\n\nlet\n  sources = {\n")
+	seen := make(map[string]bool)
+	needZstd := false
+	for _, a := range archives {
+		hash, err := nixHash(a.SHA256)
+		if err != nil {
+			return "", err
+		}
+		for _, system := range nixSystems(a.Target, a.Arch) {
+			if seen[system] {
+				continue // per-CPU archives come before universal ones
+			}
+			seen[system] = true
+			fmt.Fprintf(&sb, "    %s = fetchurl {\n      url = %s;\n      hash = %s;\n    };\n", system, nixString(a.URL), nixString(hash))
+		}
+		needZstd = needZstd || strings.HasSuffix(a.Name, ".tar.zst")
+	}
+	sb.WriteString("  };\nin\nstdenvNoCC.mkDerivation {\n")
+	fmt.Fprintf(&sb, "  pname = %s;\n  version = %s;\n\n", nixString(p.Name), nixString(p.Version))
+	fmt.Fprintf(&sb, "  src = sources.${stdenvNoCC.hostPlatform.system} or (throw \"%s: unsupported system ${stdenvNoCC.hostPlatform.system}\");\n",
+		strings.Trim(nixString(p.Name), `"`))
+	if needZstd {
+		sb.WriteString("  nativeBuildInputs = [ zstd ];\n")
+	}
+	// archives keep the package layout below name-version-target-arch, the unpacked source root
+	sb.WriteString("\n  dontConfigure = true;\n  dontBuild = true;\n  dontStrip = true;\n\n")
+	sb.WriteString("  installPhase = ''\n    runHook preInstall\n    mkdir -p $out\n    cp -r . $out/\n    runHook postInstall\n  '';\n\n")
+	sb.WriteString("  meta = {\n")
+	if len(p.Summary) != 0 {
+		fmt.Fprintf(&sb, "    description = %s;\n", nixString(p.Summary))
+	}
+	if len(p.Homepage) != 0 {
+		fmt.Fprintf(&sb, "    homepage = %s;\n", nixString(p.Homepage))
+	}
+	if len(p.License) != 0 {
+		fmt.Fprintf(&sb, "    license = lib.getLicenseFromSpdxId %s;\n", nixString(p.License))
+	}
+	if len(crates) != 0 {
+		fmt.Fprintf(&sb, "    mainProgram = %s;\n", nixString(crates[0].Name))
+	}
+	sb.WriteString("    platforms = builtins.attrNames sources;\n    sourceProvenance = [ lib.sourceTypes.binaryNativeCode ];\n  };\n}\n")
+	return sb.String(), nil
+}
+
+// nix writes the default.nix derivation for the darwin and linux tarballs in Destination
+func (b *BarrowCtx) nix(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	archives, err := b.releaseArchives(p, []string{"darwin", "linux"}, releaseTarballSuffixes)
+	if err != nil {
+		return "", err
+	}
+	for _, a := range archives {
+		b.stage("nix", "%s/%s --> %s", a.Target, a.Arch, a.URL)
+	}
+	derivation, err := b.nixDerivation(p, crates, archives)
+	if err != nil {
+		return "", err
+	}
+	name, err := b.ArtifactName("nix", p, nil)
+	if err != nil {
+		return "", err
+	}
+	return b.writeManifest(ctx, name, []byte(derivation))
+}
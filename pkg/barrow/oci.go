@@ -0,0 +1,581 @@
+package barrow
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+type OciConfig struct {
+	Tag          string            `toml:"tag,omitempty"`        // image reference name, default: version
+	Base         string            `toml:"base,omitempty"`       // base layer tarball (.tar, .tar.gz, .tar.zst), default: scratch
+	Entrypoint   []string          `toml:"entrypoint,omitempty"` // default: the first crate
+	Cmd          []string          `toml:"cmd,omitempty"`
+	Env          []string          `toml:"env,omitempty"` // KEY=VALUE
+	Labels       map[string]string `toml:"labels,omitempty"`
+	ExposedPorts []string          `toml:"exposed-ports,omitempty"` // 8080, 8080/tcp, 53/udp
+	WorkingDir   string            `toml:"working-dir,omitempty"`
+	User         string            `toml:"user,omitempty"`
+	Archive      bool              `toml:"archive,omitempty"` // also write the layout as a tarball
+}
+
+const (
+	ociMediaTypeIndex     = "application/vnd.oci.image.index.v1+json"
+	ociMediaTypeManifest  = "application/vnd.oci.image.manifest.v1+json"
+	ociMediaTypeConfig    = "application/vnd.oci.image.config.v1+json"
+	ociMediaTypeLayer     = "application/vnd.oci.image.layer.v1.tar"
+	ociAnnotationRefName  = "org.opencontainers.image.ref.name"
+	ociImageLayoutVersion = `{"imageLayoutVersion":"1.0.0"}`
+	ociDefaultPath        = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+)
+
+type ociPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Manifests     []*ociDescriptor  `json:"manifests"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociManifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	Config        *ociDescriptor    `json:"config"`
+	Layers        []*ociDescriptor  `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+type ociImageConfig struct {
+	User         string              `json:"User,omitempty"`
+	ExposedPorts map[string]struct{} `json:"ExposedPorts,omitempty"`
+	Env          []string            `json:"Env,omitempty"`
+	Entrypoint   []string            `json:"Entrypoint,omitempty"`
+	Cmd          []string            `json:"Cmd,omitempty"`
+	WorkingDir   string              `json:"WorkingDir,omitempty"`
+	Labels       map[string]string   `json:"Labels,omitempty"`
+}
+
+type ociHistory struct {
+	Created   string `json:"created"`
+	CreatedBy string `json:"created_by"`
+}
+
+type ociImage struct {
+	Created      string         `json:"created"`
+	Architecture string         `json:"architecture"`
+	OS           string         `json:"os"`
+	Variant      string         `json:"variant,omitempty"`
+	Config       ociImageConfig `json:"config"`
+	RootFS       struct {
+		Type    string   `json:"type"`
+		DiffIDs []string `json:"diff_ids"`
+	} `json:"rootfs"`
+	History []ociHistory `json:"history"`
+}
+
+// ociLayout: an OCI image layout directory, blobs are content addressed
+type ociLayout struct {
+	root string
+}
+
+func digestString(h hash.Hash) string {
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+func (l *ociLayout) blobPath(digest string) string {
+	algorithm, encoded, _ := strings.Cut(digest, ":")
+	return filepath.Join(l.root, "blobs", algorithm, encoded)
+}
+
+// writeBlob stores data produced by fn, returns the digest and size
+func (l *ociLayout) writeBlob(fn func(w io.Writer) error) (string, int64, error) {
+	dir := filepath.Join(l.root, "blobs", "sha256")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, err
+	}
+	fd, err := os.CreateTemp(dir, ".blob-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(fd.Name())
+	h := sha256.New()
+	cw := &countingWriter{w: io.MultiWriter(fd, h)}
+	if err := fn(cw); err != nil {
+		_ = fd.Close()
+		return "", 0, err
+	}
+	if err := fd.Close(); err != nil {
+		return "", 0, err
+	}
+	digest := digestString(h)
+	if err := os.Rename(fd.Name(), l.blobPath(digest)); err != nil {
+		return "", 0, err
+	}
+	return digest, cw.n, nil
+}
+
+func (l *ociLayout) writeJSON(mediaType string, v any) (*ociDescriptor, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	digest, size, err := l.writeBlob(func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ociDescriptor{MediaType: mediaType, Digest: digest, Size: size}, nil
+}
+
+func (l *ociLayout) readJSON(digest string, v any) error {
+	data, err := os.ReadFile(l.blobPath(digest))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (l *ociLayout) readIndex() (*ociIndex, error) {
+	index := &ociIndex{SchemaVersion: 2, MediaType: ociMediaTypeIndex}
+	data, err := os.ReadFile(filepath.Join(l.root, "index.json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return index, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("oci: bad index.json: %w", err)
+	}
+	return index, nil
+}
+
+func (l *ociLayout) writeIndex(ctx context.Context, index *ociIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(ctx, filepath.Join(l.root, "oci-layout"), []byte(ociImageLayoutVersion), 0644); err != nil {
+		return err
+	}
+	// index.json references the new blobs, replacing it publishes the image
+	return writeFileAtomic(ctx, filepath.Join(l.root, "index.json"), data, 0644)
+}
+
+// gc removes blobs no longer referenced from index.json
+func (l *ociLayout) gc(index *ociIndex) error {
+	referenced := make(map[string]bool)
+	var walk func(d *ociDescriptor) error
+	walk = func(d *ociDescriptor) error {
+		if referenced[d.Digest] {
+			return nil
+		}
+		referenced[d.Digest] = true
+		switch d.MediaType {
+		case ociMediaTypeIndex:
+			var child ociIndex
+			if err := l.readJSON(d.Digest, &child); err != nil {
+				return err
+			}
+			for _, m := range child.Manifests {
+				if err := walk(m); err != nil {
+					return err
+				}
+			}
+		case ociMediaTypeManifest:
+			var m ociManifest
+			if err := l.readJSON(d.Digest, &m); err != nil {
+				return err
+			}
+			referenced[m.Config.Digest] = true
+			for _, layer := range m.Layers {
+				referenced[layer.Digest] = true
+			}
+		}
+		return nil
+	}
+	for _, m := range index.Manifests {
+		if err := walk(m); err != nil {
+			return err
+		}
+	}
+	dir := filepath.Join(l.root, "blobs", "sha256")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !referenced["sha256:"+e.Name()] {
+			_ = os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+	return nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// ociPlatform: GOARCH to OCI architecture and variant
+func (b *BarrowCtx) ociPlatform() *ociPlatform {
+	p := &ociPlatform{Architecture: b.Arch, OS: b.Target}
+	switch b.Arch {
+	case "arm":
+		p.Variant = "v" + nonEmpty(b.Getenv("GOARM"), "7")
+		if i := strings.IndexByte(p.Variant, ','); i != -1 {
+			p.Variant = p.Variant[:i] // GOARM=7,softfloat
+		}
+	case "arm64":
+		p.Variant = "v8"
+	}
+	return p
+}
+
+func (p *ociPlatform) String() string {
+	if len(p.Variant) != 0 {
+		return p.OS + "/" + p.Architecture + "/" + p.Variant
+	}
+	return p.OS + "/" + p.Architecture
+}
+
+func samePlatform(a, b *ociPlatform) bool {
+	return a != nil && b != nil && a.OS == b.OS && a.Architecture == b.Architecture && a.Variant == b.Variant
+}
+
+// ociLayerCompression: media type suffix and compressor of the layer, from --compression
+func ociLayerCompression(c *compressionSpec) (string, FnCompressor, error) {
+	switch c.Method {
+	case "", "gzip":
+		return "+gzip", c.gzipWriter, nil
+	case "zstd":
+		return "+zstd", c.zstdWriter, nil
+	case "none":
+		return "", func(w io.Writer) (io.WriteCloser, error) {
+			return &nopCloser{Writer: w}, nil
+		}, nil
+	}
+	return "", nil, fmt.Errorf("oci layers do not support compression '%s', supported: gzip, zstd, none", c.Method)
+}
+
+// addBaseLayer copies the base layer tarball as is, diff_id is the digest of the uncompressed tar
+func (l *ociLayout) addBaseLayer(file string) (*ociDescriptor, string, error) {
+	fd, err := os.Open(file)
+	if err != nil {
+		return nil, "", err
+	}
+	defer fd.Close()
+	br := bufio.NewReader(fd)
+	magic, _ := br.Peek(262)
+	var suffix string
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		suffix = "+gzip"
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		suffix = "+zstd"
+	case len(magic) >= 262 && string(magic[257:262]) == "ustar":
+	default:
+		return nil, "", fmt.Errorf("oci: base layer '%s' must be a tar, tar.gz or tar.zst", file)
+	}
+	r, err := newDecompressor(br, file, false)
+	if err != nil {
+		return nil, "", err
+	}
+	diff := sha256.New()
+	if _, err := io.Copy(diff, r); err != nil {
+		_ = r.Close()
+		return nil, "", fmt.Errorf("oci: read base layer '%s' error: %w", file, err)
+	}
+	_ = r.Close()
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+	digest, size, err := l.writeBlob(func(w io.Writer) error {
+		_, err := io.Copy(w, fd)
+		return err
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &ociDescriptor{MediaType: ociMediaTypeLayer + suffix, Digest: digest, Size: size}, digestString(diff), nil
+}
+
+// addOciLayer writes staged files and crates as one layer below the install prefix
+func (b *BarrowCtx) addOciLayer(ctx context.Context, l *ociLayout, p *Package, crates []*Crate) (*ociDescriptor, string, error) {
+	c, err := b.formatCompression(p, "oci")
+	if err != nil {
+		return nil, "", err
+	}
+	suffix, newCompressor, err := ociLayerCompression(c)
+	if err != nil {
+		return nil, "", err
+	}
+	diff := sha256.New()
+	digest, size, err := l.writeBlob(func(w io.Writer) error {
+		cw, err := newCompressor(w)
+		if err != nil {
+			return err
+		}
+		if err := b.tarInternal(ctx, p, crates, AsRelativePath(p.Prefix), io.MultiWriter(cw, diff)); err != nil {
+			_ = cw.Close()
+			return err
+		}
+		return cw.Close()
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return &ociDescriptor{MediaType: ociMediaTypeLayer + suffix, Digest: digest, Size: size}, digestString(diff), nil
+}
+
+func (b *BarrowCtx) ociImageConfig(p *Package, crates []*Crate, cfg *OciConfig) (ociImageConfig, error) {
+	c := ociImageConfig{
+		User:       cfg.User,
+		WorkingDir: cfg.WorkingDir,
+		Entrypoint: slices.Clone(cfg.Entrypoint), // expanded below, cfg belongs to the loaded Package
+		Cmd:        slices.Clone(cfg.Cmd),
+		Labels: map[string]string{
+			"org.opencontainers.image.title":       p.Name,
+			"org.opencontainers.image.version":     p.Version,
+			"org.opencontainers.image.description": p.Summary,
+			"org.opencontainers.image.licenses":    p.License,
+			"org.opencontainers.image.url":         p.Homepage,
+			"org.opencontainers.image.vendor":      p.Vendor,
+			"org.opencontainers.image.revision":    b.Getenv("BUILD_COMMIT"),
+		},
+	}
+	if len(c.Entrypoint) == 0 && len(crates) != 0 {
+		c.Entrypoint = []string{path.Join("/", ToNixPath(p.Prefix), ToNixPath(crates[0].Destination), b.basename(crates[0].Name))}
+	}
+	for i, a := range c.Entrypoint {
+		c.Entrypoint[i] = b.ExpandEnv(a)
+	}
+	hasPath := false
+	for _, e := range cfg.Env {
+		k, v, ok := strings.Cut(e, "=")
+		if !ok || len(k) == 0 {
+			return c, fmt.Errorf("oci: bad env '%s', expected KEY=VALUE", e)
+		}
+		hasPath = hasPath || k == "PATH"
+		c.Env = append(c.Env, k+"="+b.ExpandEnv(v))
+	}
+	if !hasPath {
+		c.Env = append([]string{ociDefaultPath}, c.Env...)
+	}
+	for k, v := range cfg.Labels {
+		c.Labels[k] = b.ExpandEnv(v)
+	}
+	for k, v := range c.Labels {
+		if len(v) == 0 {
+			delete(c.Labels, k)
+		}
+	}
+	for _, port := range cfg.ExposedPorts {
+		if !strings.Contains(port, "/") {
+			port += "/tcp"
+		}
+		if c.ExposedPorts == nil {
+			c.ExposedPorts = make(map[string]struct{})
+		}
+		c.ExposedPorts[port] = struct{}{}
+	}
+	return c, nil
+}
+
+// updateIndex merges this platform's manifest into the image index of tag
+func (l *ociLayout) updateIndex(ctx context.Context, tag string, manifest *ociDescriptor) error {
+	index, err := l.readIndex()
+	if err != nil {
+		return err
+	}
+	image := &ociIndex{SchemaVersion: 2, MediaType: ociMediaTypeIndex}
+	pos := -1
+	for i, d := range index.Manifests {
+		if d.Annotations[ociAnnotationRefName] == tag && d.MediaType == ociMediaTypeIndex {
+			if err := l.readJSON(d.Digest, image); err != nil {
+				return err
+			}
+			pos = i
+			break
+		}
+	}
+	image.Manifests = slices.DeleteFunc(image.Manifests, func(d *ociDescriptor) bool {
+		return samePlatform(d.Platform, manifest.Platform)
+	})
+	image.Manifests = append(image.Manifests, manifest)
+	slices.SortFunc(image.Manifests, func(a, b *ociDescriptor) int {
+		return strings.Compare(a.Platform.String(), b.Platform.String())
+	})
+	d, err := l.writeJSON(ociMediaTypeIndex, image)
+	if err != nil {
+		return err
+	}
+	d.Annotations = map[string]string{ociAnnotationRefName: tag}
+	if pos == -1 {
+		index.Manifests = append(index.Manifests, d)
+	} else {
+		index.Manifests[pos] = d
+	}
+	if err := l.writeIndex(ctx, index); err != nil {
+		return err
+	}
+	return l.gc(index)
+}
+
+// archiveLayout writes the layout directory as a tarball
+func archiveLayout(ctx context.Context, root, dest string, h hash.Hash) error {
+	fd, err := createAtomic(dest, 0644)
+	if err != nil {
+		return err
+	}
+	defer fd.Abort()
+	z := tar.NewWriter(io.MultiWriter(fd, h))
+	err = filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, name)
+		if err != nil || rel == "." {
+			return err
+		}
+		si, err := d.Info()
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(si, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if d.IsDir() {
+			hdr.Name += "/"
+		}
+		if err := z.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !si.Mode().IsRegular() {
+			return nil
+		}
+		in, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		_, err = copyContext(ctx, z, in)
+		return err
+	})
+	if err != nil {
+		_ = z.Close()
+		return err
+	}
+	if err := z.Close(); err != nil {
+		return err
+	}
+	return fd.Commit(ctx)
+}
+
+// oci writes an OCI image layout <name>-<version>.oci, every arch built into the same layout is added to the image index of the tag
+func (b *BarrowCtx) oci(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	if b.Target == "windows" || b.isUniversal() {
+		return "", fmt.Errorf("oci images are not supported for %s/%s", b.Target, b.Arch)
+	}
+	cfg := p.Oci
+	if cfg == nil {
+		cfg = &OciConfig{}
+	}
+	layoutName, err := b.ArtifactName("oci", p, nil)
+	if err != nil {
+		return "", err
+	}
+	layoutPath := b.destinationPath(layoutName)
+	l := &ociLayout{root: layoutPath}
+	platform := b.ociPlatform()
+	imageConfig, err := b.ociImageConfig(p, crates, cfg)
+	if err != nil {
+		return "", err
+	}
+	created := time.Now().UTC().Format(time.RFC3339)
+	image := &ociImage{Created: created, Architecture: platform.Architecture, OS: platform.OS, Variant: platform.Variant, Config: imageConfig}
+	image.RootFS.Type = "layers"
+	manifest := &ociManifest{SchemaVersion: 2, MediaType: ociMediaTypeManifest}
+	if len(cfg.Base) != 0 {
+		layer, diffID, err := l.addBaseLayer(filepath.Join(b.CWD, cfg.Base))
+		if err != nil {
+			return "", err
+		}
+		manifest.Layers = append(manifest.Layers, layer)
+		image.RootFS.DiffIDs = append(image.RootFS.DiffIDs, diffID)
+		image.History = append(image.History, ociHistory{Created: created, CreatedBy: "bali: base " + filepath.Base(cfg.Base)})
+	}
+	layer, diffID, err := b.addOciLayer(ctx, l, p, crates)
+	if err != nil {
+		return "", err
+	}
+	manifest.Layers = append(manifest.Layers, layer)
+	image.RootFS.DiffIDs = append(image.RootFS.DiffIDs, diffID)
+	image.History = append(image.History, ociHistory{Created: created, CreatedBy: "bali: " + p.Name + " " + p.Version})
+	if manifest.Config, err = l.writeJSON(ociMediaTypeConfig, image); err != nil {
+		return "", err
+	}
+	md, err := l.writeJSON(ociMediaTypeManifest, manifest)
+	if err != nil {
+		return "", err
+	}
+	md.Platform = platform
+	tag := b.ExpandEnv(nonEmpty(cfg.Tag, p.Version))
+	if err := l.updateIndex(ctx, tag, md); err != nil {
+		return "", err
+	}
+	b.stage("oci", "%s:%s %s --> %s", p.Name, tag, platform, md.Digest)
+	if !cfg.Archive {
+		return layoutPath, nil
+	}
+	archivePath := layoutPath + ".tar"
+	h := sha256.New()
+	if err := archiveLayout(ctx, layoutPath, archivePath, h); err != nil {
+		return "", err
+	}
+	b.artifactWritten(filepath.Base(archivePath), archivePath, h)
+	return archivePath, nil
+}
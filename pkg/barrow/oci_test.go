@@ -0,0 +1,124 @@
+package barrow
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestOci(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	p.Oci = &OciConfig{Env: []string{"JACK_VERSION=$BUILD_VERSION"}, ExposedPorts: []string{"8080"}}
+	var layout string
+	for _, arch := range []string{"amd64", "arm64", "amd64"} {
+		b.Arch = arch
+		artifact, err := b.oci(context.Background(), p, crates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layout = artifact
+	}
+	l := &ociLayout{root: layout}
+	index, err := l.readIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Manifests) != 1 || index.Manifests[0].Annotations[ociAnnotationRefName] != "1.2.3" {
+		t.Fatalf("index.json: %+v", index.Manifests)
+	}
+	var image ociIndex
+	if err := l.readJSON(index.Manifests[0].Digest, &image); err != nil {
+		t.Fatal(err)
+	}
+	var platforms []string
+	for _, d := range image.Manifests {
+		platforms = append(platforms, d.Platform.OS+"/"+d.Platform.Architecture)
+	}
+	if !slices.Equal(platforms, []string{"linux/amd64", "linux/arm64"}) {
+		t.Fatalf("image index platforms: %v", platforms)
+	}
+	var manifest ociManifest
+	if err := l.readJSON(image.Manifests[0].Digest, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	var config ociImage
+	if err := l.readJSON(manifest.Config.Digest, &config); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(config.Config.Entrypoint, []string{"/usr/local/bin/jack"}) {
+		t.Errorf("entrypoint: %v", config.Config.Entrypoint)
+	}
+	if !slices.Contains(config.Config.Env, "JACK_VERSION=1.2.3") || len(config.Config.Env) != 2 {
+		t.Errorf("env: %v", config.Config.Env)
+	}
+	if _, ok := config.Config.ExposedPorts["8080/tcp"]; !ok {
+		t.Errorf("exposed ports: %v", config.Config.ExposedPorts)
+	}
+	// every blob in the layout is referenced and matches its digest
+	entries, err := os.ReadDir(filepath.Join(layout, "blobs", "sha256"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// index + 2 * (manifest, config) + the layer shared by both arches
+	if len(entries) != 6 {
+		t.Errorf("unreferenced blobs were not removed: %d blobs", len(entries))
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join(layout, "blobs", "sha256", e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != e.Name() {
+			t.Errorf("blob %s digest mismatch", e.Name())
+		}
+	}
+	fd, err := os.Open(l.blobPath(manifest.Layers[0].Digest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fd.Close()
+	zr, err := gzip.NewReader(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diff := sha256.New()
+	tr := tar.NewReader(io.TeeReader(zr, diff))
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	_, _ = io.Copy(io.Discard, tr)
+	_, _ = io.Copy(diff, zr)
+	if digestString(diff) != config.RootFS.DiffIDs[0] {
+		t.Errorf("diff_id mismatch")
+	}
+	if !slices.Contains(names, "./usr/local/bin/jack") {
+		t.Errorf("layer entries: %v", names)
+	}
+}
+
+func TestOciImageConfigKeepsPackage(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	cfg := &OciConfig{Entrypoint: []string{"/usr/local/bin/jack", "--version=$BUILD_VERSION"}}
+	c, err := b.ociImageConfig(p, crates, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Entrypoint[1] != "--version=1.2.3" || cfg.Entrypoint[1] != "--version=$BUILD_VERSION" {
+		t.Fatalf("entrypoint %v, configured %v", c.Entrypoint, cfg.Entrypoint)
+	}
+}
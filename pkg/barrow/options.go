@@ -0,0 +1,90 @@
+package barrow
+
+import (
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// Option configures a BarrowCtx created by New
+type Option func(b *BarrowCtx)
+
+// New returns a BarrowCtx for the module in cwd: output in cwd/build, artifacts in cwd/out,
+// built for the host platform without events. Call Initialize before Run or Verify
+func New(cwd string, opts ...Option) *BarrowCtx {
+	b := &BarrowCtx{
+		CWD:         cwd,
+		Out:         filepath.Join(cwd, "build"),
+		Target:      runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		Destination: filepath.Join(cwd, "out"),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// WithOut sets the build directory of compiled crates
+func WithOut(dir string) Option {
+	return func(b *BarrowCtx) {
+		b.Out = dir
+	}
+}
+
+// WithTarget sets the target OS and arch, darwin supports universal
+func WithTarget(target, arch string) Option {
+	return func(b *BarrowCtx) {
+		b.Target = target
+		b.Arch = arch
+	}
+}
+
+// WithRelease sets the package release, default: $BUILD_RELEASE, the GitHub run number or 1
+func WithRelease(release string) Option {
+	return func(b *BarrowCtx) {
+		b.Release = release
+	}
+}
+
+// WithDestination sets the directory of artifacts, relative to the module directory
+func WithDestination(dir string) Option {
+	return func(b *BarrowCtx) {
+		b.Destination = dir
+	}
+}
+
+// WithPack selects the pack formats, see PackagerNames
+func WithPack(formats ...string) Option {
+	return func(b *BarrowCtx) {
+		b.Pack = formats
+	}
+}
+
+// WithCompression sets the compression method[:level] of the pack formats
+func WithCompression(spec string) Option {
+	return func(b *BarrowCtx) {
+		b.Compression = spec
+	}
+}
+
+// WithTimeout bounds Run, zero: no limit
+func WithTimeout(d time.Duration) Option {
+	return func(b *BarrowCtx) {
+		b.Timeout = d
+	}
+}
+
+// WithVerbose reports the build environment as debug events
+func WithVerbose(verbose bool) Option {
+	return func(b *BarrowCtx) {
+		b.Verbose = verbose
+	}
+}
+
+// WithLogger sets the receiver of build events, default: none
+func WithLogger(l Logger) Option {
+	return func(b *BarrowCtx) {
+		b.Logger = l
+	}
+}
@@ -1,11 +1,15 @@
 package barrow
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"maps"
+	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 
 	"github.com/pelletier/go-toml/v2"
@@ -18,33 +22,65 @@ type FileItem struct {
 	Permissions string `toml:"permissions,omitempty"` // 0755 0644
 }
 
+// Shortcut: a Start menu shortcut to an installed file (msi, exe)
+type Shortcut struct {
+	Name        string `toml:"name"`
+	Target      string `toml:"target"` // installed path relative to the install directory, e.g. bin/bali.exe
+	Arguments   string `toml:"arguments,omitempty"`
+	Description string `toml:"description,omitempty"`
+}
+
+// PackConfig: [pack.<format>] settings overriding the command line for one format
+type PackConfig struct {
+	Compression string `toml:"compression,omitempty"` // method[:level]
+}
+
 type Package struct {
-	Name        string      `toml:"name"`
-	PackageName string      `toml:"package-name,omitempty"`
-	Summary     string      `toml:"summary,omitempty"`     // Is a short description of the software
-	Description string      `toml:"description,omitempty"` // description is a longer piece of software information than Summary, consisting of one or more paragraphs
-	Version     string      `toml:"version,omitempty"`
-	Authors     []string    `toml:"authors,omitempty"`
-	Vendor      string      `toml:"vendor,omitempty"`
-	Maintainer  string      `toml:"maintainer,omitempty"`
-	Homepage    string      `toml:"homepage,omitempty"`
-	Packager    string      `toml:"packager,omitempty"` // BALI_RPM_PACKAGER
-	Group       string      `toml:"group,omitempty"`
-	License     string      `toml:"license,omitempty"`
-	LicenseFile string      `toml:"license-file,omitempty"`
-	Prefix      string      `toml:"prefix,omitempty"` // install prefix: rpm required
-	Crates      []string    `toml:"crates,omitempty"`
-	Include     []*FileItem `toml:"include,omitempty"`
+	Name               string                 `toml:"name"`
+	PackageName        string                 `toml:"package-name,omitempty"`
+	Summary            string                 `toml:"summary,omitempty"`     // Is a short description of the software
+	Description        string                 `toml:"description,omitempty"` // description is a longer piece of software information than Summary, consisting of one or more paragraphs
+	Version            string                 `toml:"version,omitempty"`
+	Authors            []string               `toml:"authors,omitempty"`
+	Vendor             string                 `toml:"vendor,omitempty"`
+	Maintainer         string                 `toml:"maintainer,omitempty"`
+	Homepage           string                 `toml:"homepage,omitempty"`
+	Packager           string                 `toml:"packager,omitempty"` // BALI_RPM_PACKAGER
+	Group              string                 `toml:"group,omitempty"`
+	License            string                 `toml:"license,omitempty"`
+	LicenseFile        string                 `toml:"license-file,omitempty"`
+	Prefix             string                 `toml:"prefix,omitempty"`              // install prefix: rpm required
+	CompressionLevel   *int                   `toml:"compression-level,omitempty"`   // --compression without a level
+	CompressionThreads int                    `toml:"compression-threads,omitempty"` // parallel gzip/zstd, default: GOMAXPROCS
+	Pack               map[string]*PackConfig `toml:"pack,omitempty"`
+	Crates             []string               `toml:"crates,omitempty"`
+	Include            []*FileItem            `toml:"include,omitempty"`
+	Hooks              *Hooks                 `toml:"hooks,omitempty"`
+	Msi                *MsiConfig             `toml:"msi,omitempty"`
+	Exe                *ExeConfig             `toml:"exe,omitempty"`
+	Oci                *OciConfig             `toml:"oci,omitempty"`
+	AppImage           *AppImageConfig        `toml:"appimage,omitempty"`
+	Release            *ReleaseConfig         `toml:"release,omitempty"`
+	Brew               *BrewConfig            `toml:"brew,omitempty"`
+	Scoop              *ScoopConfig           `toml:"scoop,omitempty"`
+	Winget             *WingetConfig          `toml:"winget,omitempty"`
+	Chocolatey         *ChocolateyConfig      `toml:"chocolatey,omitempty"`
+	Pkgbuild           *PkgbuildConfig        `toml:"pkgbuild,omitempty"`
 }
 
+// LoadMetadata decodes a TOML manifest, errors are *ManifestError
 func LoadMetadata(file string, v any) error {
 	fd, err := os.Open(file)
 	if err != nil {
-		return err
+		var pe *fs.PathError
+		if errors.As(err, &pe) {
+			err = pe.Err // the file name is already part of ManifestError
+		}
+		return &ManifestError{File: file, Err: err}
 	}
 	defer fd.Close()
 	if err := toml.NewDecoder(fd).Decode(v); err != nil {
-		return err
+		return manifestError(file, err)
 	}
 	return nil
 }
@@ -55,6 +91,9 @@ func (b *BarrowCtx) LoadPackage(cwd string) (*Package, error) {
 	if err := LoadMetadata(file, &p); err != nil {
 		return nil, err
 	}
+	if err := p.validate(file); err != nil {
+		return nil, err
+	}
 	if packageName, ok := os.LookupEnv("PACKAGE_NAME"); ok {
 		p.PackageName = packageName // overwrite
 	}
@@ -65,6 +104,34 @@ func (b *BarrowCtx) LoadPackage(cwd string) (*Package, error) {
 	return &p, nil
 }
 
+// validate checks the compression settings of bali.toml, errors are *ManifestError
+func (p *Package) validate(file string) error {
+	if p.CompressionThreads < 0 {
+		return keyError(file, "compression-threads", fmt.Errorf("invalid thread count %d, expected 0 (one per CPU) or more", p.CompressionThreads))
+	}
+	if p.CompressionLevel != nil {
+		lo, hi := math.MaxInt, math.MinInt
+		for _, r := range compressionLevels {
+			lo, hi = min(lo, r[0]), max(hi, r[1])
+		}
+		if level := *p.CompressionLevel; level < lo || level > hi {
+			return keyError(file, "compression-level", fmt.Errorf("compression level %d out of range %d-%d", level, lo, hi))
+		}
+	}
+	for _, format := range slices.Sorted(maps.Keys(p.Pack)) {
+		if pc := p.Pack[format]; pc == nil || len(pc.Compression) == 0 {
+			continue
+		}
+		if _, ok := LookupPackager(format); !ok {
+			return keyError(file, "pack."+format, fmt.Errorf("%w '%s'", ErrUnsupportedFormat, format))
+		}
+		if _, err := p.packCompression(format, p.Pack[format].Compression); err != nil {
+			return keyError(file, "pack."+format+".compression", err)
+		}
+	}
+	return nil
+}
+
 func copyTo(src, dest string, newPerm string) error {
 	st, err := os.Stat(src)
 	if err != nil {
@@ -131,13 +198,12 @@ func (b *BarrowCtx) apply(item *FileItem) error {
 		}
 	}
 	if err := copyTo(source, saveTo, item.Permissions); err != nil {
-		fmt.Fprintf(os.Stderr, "install %s error: %v\n", item.Path, err)
-		return err
+		return fmt.Errorf("install %s: %w", item.Path, err)
 	}
 	if len(item.Rename) != 0 {
-		stage("install", "\x1b[38;02;39;199;173m%s\x1b[0m --> \x1b[38;02;39;199;173m%s\x1b[0m done", item.Path, filepath.Join(item.Destination, item.Rename))
+		b.stage("install", "%s --> %s done", item.Path, filepath.Join(item.Destination, item.Rename))
 		return nil
 	}
-	stage("install", "\x1b[38;02;39;199;173m%s\x1b[0m --> \x1b[38;02;39;199;173m%s\x1b[0m done", item.Path, filepath.Base(item.Path))
+	b.stage("install", "%s --> %s done", item.Path, filepath.Base(item.Path))
 	return nil
 }
@@ -0,0 +1,297 @@
+package barrow
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Capabilities of a pack format
+type Capabilities struct {
+	Artifact     string   // what the format creates, used in messages: deb package, homebrew formula
+	Naming       string   // name of the artifact in Destination, expanded by BarrowCtx.ArtifactName
+	Compressions []string // methods accepted by --compression, the first one is the default, empty: not compressed
+	Levels       []string // compression methods honouring a level
+	Targets      []string // supported target OS, empty: any
+	Signing      bool     // the format embeds signatures, bali inspect lists them
+}
+
+// Packager creates the artifact of one pack format, formats are registered by name with RegisterPackager.
+// Pack returns the path of the artifact, packagers writing a single file use BarrowCtx.ArtifactName,
+// BarrowCtx.WriteArtifact and BarrowCtx.Stage to share naming, hashing and the file list with the builtin formats
+type Packager interface {
+	Capabilities() *Capabilities
+	Pack(ctx context.Context, b *BarrowCtx, p *Package, crates []*Crate) (string, error)
+}
+
+// packFunc: builtin packagers are methods of BarrowCtx
+type packFunc struct {
+	caps *Capabilities
+	fn   func(b *BarrowCtx, ctx context.Context, p *Package, crates []*Crate) (string, error)
+}
+
+func (f *packFunc) Capabilities() *Capabilities {
+	return f.caps
+}
+
+func (f *packFunc) Pack(ctx context.Context, b *BarrowCtx, p *Package, crates []*Crate) (string, error) {
+	return f.fn(b, ctx, p, crates)
+}
+
+var (
+	packagersMu sync.RWMutex
+	packagers   = map[string]Packager{}
+)
+
+// RegisterPackager registers a pack format, the name is what --pack selects
+func RegisterPackager(name string, pk Packager) error {
+	name = strings.ToLower(name)
+	if len(name) == 0 || strings.ContainsAny(name, ", \t") {
+		return fmt.Errorf("invalid pack format name '%s'", name)
+	}
+	if pk == nil || pk.Capabilities() == nil {
+		return fmt.Errorf("pack format '%s': packager has no capabilities", name)
+	}
+	packagersMu.Lock()
+	defer packagersMu.Unlock()
+	if _, ok := packagers[name]; ok {
+		return fmt.Errorf("pack format '%s' is already registered", name)
+	}
+	packagers[name] = pk
+	return nil
+}
+
+// LookupPackager returns the packager registered for a pack format
+func LookupPackager(name string) (Packager, bool) {
+	packagersMu.RLock()
+	defer packagersMu.RUnlock()
+	pk, ok := packagers[strings.ToLower(name)]
+	return pk, ok
+}
+
+// PackagerNames returns the registered pack formats, sorted
+func PackagerNames() []string {
+	packagersMu.RLock()
+	defer packagersMu.RUnlock()
+	names := make([]string, 0, len(packagers))
+	for name := range packagers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func registerBuiltin(name string, caps *Capabilities, fn func(b *BarrowCtx, ctx context.Context, p *Package, crates []*Crate) (string, error)) {
+	if err := RegisterPackager(name, &packFunc{caps: caps, fn: fn}); err != nil {
+		panic(err)
+	}
+}
+
+func init() {
+	tarCompressions := []string{"gzip", "zstd", "xz", "bzip2", "brotli", "none"}
+	registerBuiltin("zip", &Capabilities{
+		Artifact:     "zip package",
+		Naming:       "{name}-{version}-{target}-{arch}.zip",
+		Compressions: []string{"deflate", "zstd", "bzip2", "xz"},
+		Levels:       []string{"deflate", "zstd", "bzip2", "xz"},
+	}, (*BarrowCtx).zip)
+	registerBuiltin("tar", &Capabilities{
+		Artifact:     "tar package",
+		Naming:       "{name}-{version}-{target}-{arch}{ext}", // ext: .tar.gz, .tar.zst ...
+		Compressions: tarCompressions,
+		Levels:       tarCompressions[:5],
+	}, (*BarrowCtx).tar)
+	registerBuiltin("sh", &Capabilities{
+		Artifact:     "sh package",
+		Naming:       "{name}-{version}-{target}-{arch}.sh",
+		Compressions: tarCompressions,
+		Levels:       tarCompressions[:5],
+	}, (*BarrowCtx).sh)
+	registerBuiltin("rpm", &Capabilities{
+		Artifact:     "rpm package",
+		Naming:       "{name}-{version}-{release}.{arch}.rpm",
+		Compressions: []string{"gzip", "zstd", "xz", "lzma"},
+		Levels:       []string{"gzip", "zstd"},
+		Signing:      true,
+	}, (*BarrowCtx).rpm)
+	registerBuiltin("deb", &Capabilities{
+		Artifact:     "deb package",
+		Naming:       "{name}_{version}-{release}_{arch}.deb",
+		Compressions: []string{"gzip", "zstd", "xz", "none"},
+		Levels:       []string{"gzip", "zstd"},
+		Signing:      true,
+	}, (*BarrowCtx).deb)
+	registerBuiltin("apk", &Capabilities{
+		Artifact:     "apk package",
+		Naming:       "{name}_{version}-r{release}_{arch}.apk",
+		Compressions: []string{"gzip"},
+		Signing:      true,
+	}, (*BarrowCtx).apk)
+	registerBuiltin("arch", &Capabilities{
+		Artifact:     "arch package",
+		Naming:       "{name}-{version}-{release}-{arch}.pkg.tar.zst",
+		Compressions: []string{"zstd"},
+	}, (*BarrowCtx).archLinux)
+	registerBuiltin("msi", &Capabilities{
+		Artifact: "msi package",
+		Naming:   "{name}-{version}-{target}-{arch}.msi",
+		Targets:  []string{"windows"},
+		Signing:  true,
+	}, (*BarrowCtx).msi)
+	registerBuiltin("exe", &Capabilities{
+		Artifact: "exe package",
+		Naming:   "{name}-{version}-{target}-{arch}-setup.exe",
+		Targets:  []string{"windows"},
+		Signing:  true,
+	}, (*BarrowCtx).exe)
+	registerBuiltin("oci", &Capabilities{
+		Artifact:     "oci image",
+		Naming:       "{name}-{version}.oci",
+		Compressions: []string{"gzip", "zstd", "none"},
+		Levels:       []string{"gzip", "zstd"},
+	}, (*BarrowCtx).oci)
+	registerBuiltin("appimage", &Capabilities{
+		Artifact:     "appimage",
+		Naming:       "{name}-{version}-{arch}.AppImage",
+		Compressions: []string{"gzip", "zstd"},
+		Targets:      []string{"linux"},
+	}, (*BarrowCtx).appimage)
+	registerBuiltin("brew", &Capabilities{
+		Artifact: "homebrew formula",
+		Naming:   "{name}.rb",
+	}, (*BarrowCtx).brew)
+	registerBuiltin("scoop", &Capabilities{
+		Artifact: "scoop manifest",
+		Naming:   "{name}.json",
+	}, (*BarrowCtx).scoop)
+	registerBuiltin("winget", &Capabilities{
+		Artifact: "winget manifests",
+		Naming:   "winget/manifests/{initial}/{identifier}/{version}", // identifier: Publisher/Package
+	}, (*BarrowCtx).winget)
+	registerBuiltin("chocolatey", &Capabilities{
+		Artifact: "chocolatey package",
+		Naming:   "{name}.{version}.nupkg",
+	}, (*BarrowCtx).chocolatey)
+	registerBuiltin("pkgbuild", &Capabilities{
+		Artifact: "PKGBUILD",
+		Naming:   "aur/{name}/PKGBUILD",
+	}, (*BarrowCtx).archPkgbuild)
+	registerBuiltin("nix", &Capabilities{
+		Artifact: "nix derivation",
+		Naming:   "default.nix",
+	}, (*BarrowCtx).nix)
+}
+
+var namingField = regexp.MustCompile(`\{[a-z-]+\}`)
+
+// ArtifactName expands the Naming of a format: {name}, {version}, {release}, {target} and {arch} come from
+// the package and the build, fields adds or overrides values only the packager knows, e.g. the rpm arch
+func (b *BarrowCtx) ArtifactName(format string, p *Package, fields map[string]string) (string, error) {
+	pk, ok := LookupPackager(format)
+	if !ok {
+		return "", fmt.Errorf("%w '%s'", ErrUnsupportedFormat, format)
+	}
+	naming := pk.Capabilities().Naming
+	if len(naming) == 0 {
+		return "", fmt.Errorf("pack format '%s' has no naming convention", format)
+	}
+	values := map[string]string{
+		"name":    p.Name,
+		"version": p.Version,
+		"release": nonEmpty(b.Release, "1"),
+		"target":  b.Target,
+		"arch":    b.Arch,
+	}
+	maps.Copy(values, fields)
+	var unknown []string
+	name := namingField.ReplaceAllStringFunc(naming, func(field string) string {
+		v, ok := values[field[1:len(field)-1]]
+		if !ok {
+			unknown = append(unknown, field)
+		}
+		return v
+	})
+	if len(unknown) != 0 {
+		return "", fmt.Errorf("pack format '%s' naming '%s': unknown %s", format, naming, strings.Join(unknown, ", "))
+	}
+	return name, nil
+}
+
+// packArtifact runs the packager of a format after checking its target
+func (b *BarrowCtx) packArtifact(ctx context.Context, format string, p *Package, crates []*Crate) (*PackResult, error) {
+	pk, ok := LookupPackager(format)
+	if !ok {
+		b.packStatus(format, StatusFailed)
+		return nil, &PackError{Format: format, Err: ErrUnsupportedFormat}
+	}
+	caps := pk.Capabilities()
+	if len(caps.Targets) != 0 && !slices.Contains(caps.Targets, b.Target) {
+		b.packStatus(format, StatusFailed)
+		return nil, &PackError{Format: format, Err: fmt.Errorf("%w %s, %s supports %s", ErrUnsupportedTarget, b.Target, nonEmpty(caps.Artifact, format), strings.Join(caps.Targets, ", "))}
+	}
+	b.packStatus(format, StatusRunning)
+	b.written = nil
+	pp := b.newPackProgress(format, p, crates)
+	artifact, err := pk.Pack(withProgress(ctx, pp), b, p, crates)
+	if err != nil {
+		b.packStatus(format, StatusFailed)
+		return nil, &PackError{Format: format, Artifact: pp.artifact, Err: err}
+	}
+	pr := &PackResult{Format: format, Path: artifact, Files: b.written}
+	b.written = nil
+	b.packStatus(format, StatusDone)
+	return pr, nil
+}
+
+// PackCompression returns the compression of a format as method[:level], checked against the capabilities of its packager
+func (b *BarrowCtx) PackCompression(p *Package, format string) (string, error) {
+	c, err := b.formatCompression(p, format)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// WriteArtifact creates name in Destination through a temporary file renamed on success and prints its sha256,
+// write receives the file content, its writes fail once ctx is done
+func (b *BarrowCtx) WriteArtifact(ctx context.Context, name string, perm os.FileMode, write func(w io.Writer) error) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	artifactPath := b.destinationPath(name)
+	pp := progressFrom(ctx)
+	if pp != nil {
+		pp.artifact = artifactPath
+	}
+	fd, err := createAtomic(artifactPath, perm)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Abort()
+	h := sha256.New()
+	w := io.MultiWriter(fd, h)
+	if pp != nil {
+		w = io.MultiWriter(fd, h, &progressWriter{pp: pp, name: name})
+	}
+	// deb, apk, arch, msi and exe are written by libraries that do not know ctx
+	if err := write(&contextWriter{ctx: ctx, w: w}); err != nil {
+		return "", err
+	}
+	if pp != nil {
+		pp.report(name, true)
+	}
+	if err := fd.Commit(ctx); err != nil {
+		return "", err
+	}
+	b.artifactWritten(name, artifactPath, h)
+	return artifactPath, nil
+}
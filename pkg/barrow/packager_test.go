@@ -0,0 +1,117 @@
+package barrow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// listPackager: a third-party format writing the staged file list
+type listPackager struct{}
+
+func (listPackager) Capabilities() *Capabilities {
+	return &Capabilities{
+		Artifact:     "file list",
+		Naming:       "{name}-{version}.txt",
+		Compressions: []string{"none", "gzip"},
+	}
+}
+
+func (listPackager) Pack(ctx context.Context, b *BarrowCtx, p *Package, crates []*Crate) (string, error) {
+	if _, err := b.PackCompression(p, "list"); err != nil {
+		return "", err
+	}
+	staged, err := b.Stage(p, crates, p.Prefix)
+	if err != nil {
+		return "", err
+	}
+	name, err := b.ArtifactName("list", p, nil)
+	if err != nil {
+		return "", err
+	}
+	return b.WriteArtifact(ctx, name, 0644, func(w io.Writer) error {
+		for _, f := range staged {
+			if _, err := fmt.Fprintf(w, "%s %s %s\n", f.Mode, ToNixPath(f.Name), f.Link); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestArtifactName(t *testing.T) {
+	b, p, _ := newTestModule(t)
+	for _, c := range []struct {
+		format string
+		fields map[string]string
+		want   string
+	}{
+		{"zip", nil, "jack-1.2.3-linux-amd64.zip"},
+		{"tar", map[string]string{"ext": ".tar.zst"}, "jack-1.2.3-linux-amd64.tar.zst"},
+		{"rpm", map[string]string{"arch": "x86_64"}, "jack-1.2.3-1.x86_64.rpm"},
+		{"deb", nil, "jack_1.2.3-1_amd64.deb"},
+		{"pkgbuild", map[string]string{"name": "jack-bin"}, "aur/jack-bin/PKGBUILD"},
+	} {
+		name, err := b.ArtifactName(c.format, p, c.fields)
+		if err != nil || name != c.want {
+			t.Errorf("%s artifact name %s, expected %s: %v", c.format, name, c.want, err)
+		}
+	}
+	if _, err := b.ArtifactName("tar", p, nil); err == nil {
+		t.Fatal("unknown naming field {ext} accepted")
+	}
+	if _, err := b.ArtifactName("bogus", p, nil); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("unknown format: %v", err)
+	}
+}
+
+func TestRegisterPackager(t *testing.T) {
+	if _, ok := LookupPackager("list"); !ok {
+		if err := RegisterPackager("list", listPackager{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RegisterPackager("ZIP", listPackager{}); err == nil {
+		t.Fatal("duplicate pack format registered")
+	}
+	if err := RegisterPackager("a,b", listPackager{}); err == nil {
+		t.Fatal("invalid pack format name registered")
+	}
+	if !slices.Contains(PackagerNames(), "list") {
+		t.Fatalf("list missing from %v", PackagerNames())
+	}
+	b, p, crates := newTestModule(t)
+	pr, err := b.packArtifact(context.Background(), "list", p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pr.Path != filepath.Join(b.Destination, "jack-1.2.3.txt") || len(pr.Files) != 1 || pr.Files[0].Path != pr.Path || len(pr.Files[0].SHA256) != 64 {
+		t.Fatalf("pack result %+v", pr)
+	}
+	data, err := os.ReadFile(pr.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"-rw-r--r-- /usr/local/share/JACK-LICENSE.txt", "-rwxr-xr-x /usr/local/bin/jack", "Lrwxrwxrwx /usr/local/bin/jack-alias jack"} {
+		if !strings.Contains(string(data), line) {
+			t.Errorf("file list misses '%s':\n%s", line, data)
+		}
+	}
+	b.Compression = "zstd"
+	if _, err := b.packArtifact(context.Background(), "list", p, crates); err == nil {
+		t.Fatal("compression outside the capabilities accepted")
+	}
+	var pe *PackError
+	if _, err := b.packArtifact(context.Background(), "msi", p, crates); !errors.As(err, &pe) || pe.Format != "msi" || !errors.Is(err, ErrUnsupportedTarget) {
+		t.Fatalf("msi for linux: %v", err)
+	}
+	if hint := Suggestion(pe); hint != "build msi with -T windows" {
+		t.Fatalf("msi for linux suggestion: %q", hint)
+	}
+}
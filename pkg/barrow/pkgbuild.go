@@ -0,0 +1,160 @@
+package barrow
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+type PkgbuildConfig struct {
+	Name       string   `toml:"name,omitempty"` // pkgname, default: <name>-bin
+	Depends    []string `toml:"depends,omitempty"`
+	OptDepends []string `toml:"optdepends,omitempty"`
+}
+
+var (
+	pkgbuildArchs = map[string]string{
+		"amd64":   "x86_64",
+		"arm64":   "aarch64",
+		"386":     "i686",
+		"arm":     "armv7h",
+		"riscv64": "riscv64",
+		"loong64": "loong64",
+	}
+)
+
+// shellQuote: single quoted bash word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func shellArray(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		quoted = append(quoted, shellQuote(v))
+	}
+	return "(" + strings.Join(quoted, " ") + ")"
+}
+
+// pkgbuildVersion: pkgver may not contain hyphens
+func pkgbuildVersion(version string) string {
+	return strings.ReplaceAll(version, "-", "_")
+}
+
+func (b *BarrowCtx) pkgbuildName(p *Package) string {
+	if p.Pkgbuild != nil && len(p.Pkgbuild.Name) != 0 {
+		return p.Pkgbuild.Name
+	}
+	return p.Name + "-bin"
+}
+
+func (b *BarrowCtx) pkgbuild(p *Package, archives []*releaseArchive) (string, string) {
+	cfg := p.Pkgbuild
+	if cfg == nil {
+		cfg = &PkgbuildConfig{}
+	}
+	pkgname := b.pkgbuildName(p)
+	pkgver := pkgbuildVersion(p.Version)
+	pkgrel := nonEmpty(b.Release, "1")
+	archs := make([]string, 0, len(archives))
+	for _, a := range archives {
+		archs = append(archs, pkgbuildArchs[a.Arch])
+	}
+	var sb, info strings.Builder
+	if len(p.Maintainer) != 0 {
+		fmt.Fprintf(&sb, "# Maintainer: %s\n\n", p.Maintainer)
+	}
+	fmt.Fprintf(&sb, "pkgname=%s\npkgver=%s\npkgrel=%s\n", pkgname, pkgver, pkgrel)
+	fmt.Fprintf(&info, "pkgbase = %s\n", pkgname)
+	if len(p.Summary) != 0 {
+		fmt.Fprintf(&info, "\tpkgdesc = %s\n", p.Summary)
+	}
+	fmt.Fprintf(&info, "\tpkgver = %s\n\tpkgrel = %s\n", pkgver, pkgrel)
+	fmt.Fprintf(&sb, "pkgdesc=%s\narch=%s\n", shellQuote(p.Summary), shellArray(archs))
+	if len(p.Homepage) != 0 {
+		fmt.Fprintf(&sb, "url=%s\n", shellQuote(p.Homepage))
+		fmt.Fprintf(&info, "\turl = %s\n", p.Homepage)
+	}
+	for _, arch := range archs {
+		fmt.Fprintf(&info, "\tarch = %s\n", arch)
+	}
+	if len(p.License) != 0 {
+		fmt.Fprintf(&sb, "license=%s\n", shellArray([]string{p.License}))
+		fmt.Fprintf(&info, "\tlicense = %s\n", p.License)
+	}
+	if pkgname != p.Name {
+		fmt.Fprintf(&sb, "provides=%s\nconflicts=%s\n", shellArray([]string{p.Name}), shellArray([]string{p.Name}))
+		fmt.Fprintf(&info, "\tprovides = %s\n\tconflicts = %s\n", p.Name, p.Name)
+	}
+	if len(cfg.Depends) != 0 {
+		fmt.Fprintf(&sb, "depends=%s\n", shellArray(cfg.Depends))
+	}
+	for _, d := range cfg.Depends {
+		fmt.Fprintf(&info, "\tdepends = %s\n", d)
+	}
+	if len(cfg.OptDepends) != 0 {
+		fmt.Fprintf(&sb, "optdepends=%s\n", shellArray(cfg.OptDepends))
+	}
+	for _, d := range cfg.OptDepends {
+		fmt.Fprintf(&info, "\toptdepends = %s\n", d)
+	}
+	sb.WriteString("options=('!strip' '!debug')\n")
+	for _, a := range archives {
+		arch := pkgbuildArchs[a.Arch]
+		fmt.Fprintf(&sb, "source_%s=(%s)\nsha256sums_%s=(%s)\n", arch, shellQuote(a.Name+"::"+a.URL), arch, shellQuote(a.SHA256))
+		fmt.Fprintf(&info, "\tsource_%s = %s::%s\n\tsha256sums_%s = %s\n", arch, a.Name, a.URL, arch, a.SHA256)
+	}
+	fmt.Fprintf(&info, "\npkgname = %s\n", pkgname)
+	// archives keep the package layout below name-version-target-arch
+	prefix := nonEmpty(ToNixPath(p.Prefix), "/usr")
+	sb.WriteString("\npackage() {\n  local _dir\n  case \"$CARCH\" in\n")
+	for _, a := range archives {
+		fmt.Fprintf(&sb, "    %s) _dir=%s ;;\n", pkgbuildArchs[a.Arch], shellQuote(strings.TrimSuffix(a.Name, releaseArchiveSuffix(a.Name))))
+	}
+	sb.WriteString("  esac\n")
+	fmt.Fprintf(&sb, "  install -dm755 \"$pkgdir%s\"\n  cp -a --no-preserve=ownership \"$srcdir/$_dir/.\" \"$pkgdir%s/\"\n}\n", prefix, prefix)
+	return sb.String(), info.String()
+}
+
+// releaseArchiveSuffix: the archive suffix of name
+func releaseArchiveSuffix(name string) string {
+	for _, suffix := range releaseArchiveSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return suffix
+		}
+	}
+	return filepath.Ext(name)
+}
+
+// archPkgbuild writes a binary PKGBUILD and its .SRCINFO for the linux tarballs in Destination into aur/<pkgname>
+func (b *BarrowCtx) archPkgbuild(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	archives, err := b.releaseArchives(p, []string{"linux"}, releaseTarballSuffixes)
+	if err != nil {
+		return "", err
+	}
+	supported := archives[:0]
+	for _, a := range archives {
+		if _, ok := pkgbuildArchs[a.Arch]; ok {
+			b.stage("pkgbuild", "%s/%s --> %s", a.Target, a.Arch, a.URL)
+			supported = append(supported, a)
+		}
+	}
+	if len(supported) == 0 {
+		return "", fmt.Errorf("no linux tarballs for an arch supported by Arch Linux")
+	}
+	pkgbuild, srcinfo := b.pkgbuild(p, supported)
+	name, err := b.ArtifactName("pkgbuild", p, map[string]string{"name": b.pkgbuildName(p)})
+	if err != nil {
+		return "", err
+	}
+	if _, err := b.writeManifest(ctx, filepath.Join(filepath.Dir(name), ".SRCINFO"), []byte(srcinfo)); err != nil {
+		return "", err
+	}
+	return b.writeManifest(ctx, name, []byte(pkgbuild))
+}
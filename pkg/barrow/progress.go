@@ -0,0 +1,86 @@
+package barrow
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const progressInterval = 100 * time.Millisecond
+
+// packProgress counts the bytes of the artifact being packed, it travels in the context so
+// contextReader and WriteArtifact find it without changing the packer signatures
+type packProgress struct {
+	b        *BarrowCtx
+	format   string
+	artifact string // path of the last artifact started by WriteArtifact
+	total    int64
+	read     atomic.Int64
+	written  atomic.Int64
+	mu       sync.Mutex
+	last     time.Time
+}
+
+type progressKey struct{}
+
+func withProgress(ctx context.Context, pp *packProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, pp)
+}
+
+func progressFrom(ctx context.Context) *packProgress {
+	pp, _ := ctx.Value(progressKey{}).(*packProgress)
+	return pp
+}
+
+// newPackProgress: Total is the size of the staged files, zero when they cannot be listed
+func (b *BarrowCtx) newPackProgress(format string, p *Package, crates []*Crate) *packProgress {
+	pp := &packProgress{b: b, format: format}
+	if staged, err := b.Stage(p, crates, ""); err == nil {
+		for _, f := range staged {
+			if f.Mode.IsRegular() {
+				pp.total += f.Size
+			}
+		}
+	}
+	return pp
+}
+
+// report emits EventProgress at most every progressInterval unless force
+func (pp *packProgress) report(name string, force bool) {
+	pp.mu.Lock()
+	defer pp.mu.Unlock()
+	now := time.Now()
+	if !force && now.Sub(pp.last) < progressInterval {
+		return
+	}
+	pp.last = now
+	pp.b.log(&Event{Kind: EventProgress, Stage: pp.format, Message: name, Written: pp.written.Load(), Read: pp.read.Load(), Total: pp.total})
+}
+
+// progressWriter counts the bytes of an artifact written by WriteArtifact
+type progressWriter struct {
+	pp   *packProgress
+	name string
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	w.pp.written.Add(int64(len(p)))
+	w.pp.report(w.name, false)
+	return len(p), nil
+}
+
+// formatBytes: 512 B, 3.2 KiB, 12.0 MiB
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,184 @@
+package barrow
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/balibuild/bali/v3/modules/term"
+)
+
+var spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+
+// progressRow: a crate or a pack format of the live view
+type progressRow struct {
+	key     string // crate location or pack format
+	name    string
+	pack    bool
+	status  Status
+	start   time.Time
+	elapsed time.Duration
+	last    *Event // EventProgress of a running pack format
+}
+
+// ProgressLogger draws a live view below the console lines on a terminal: the status of each crate,
+// the pack format being created with the bytes written and an ETA. Other events are printed by Console
+// above the view. Call Close when the build returns
+type ProgressLogger struct {
+	Console *ConsoleLogger
+	out     io.Writer
+	fd      int
+	level   term.Level
+	mu      sync.Mutex
+	rows    []*progressRow
+	lines   int // lines of the view on screen
+	frame   int
+	done    chan struct{}
+	closed  sync.WaitGroup
+}
+
+// NewProgressLogger draws on out, usually os.Stderr, with the colors of level
+func NewProgressLogger(console *ConsoleLogger, out *os.File, level term.Level) *ProgressLogger {
+	v := &ProgressLogger{Console: console, out: out, fd: int(out.Fd()), level: level, done: make(chan struct{})}
+	v.closed.Add(1)
+	go v.tick()
+	return v
+}
+
+// tick redraws the view so spinners, elapsed times and ETA move between events
+func (v *ProgressLogger) tick() {
+	defer v.closed.Done()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-v.done:
+			return
+		case <-ticker.C:
+			v.mu.Lock()
+			v.frame++
+			v.redraw()
+			v.mu.Unlock()
+		}
+	}
+}
+
+// Close stops the view and erases it, the console lines stay
+func (v *ProgressLogger) Close() {
+	close(v.done)
+	v.closed.Wait()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.clear()
+}
+
+func (v *ProgressLogger) Log(e *Event) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	switch e.Kind {
+	case EventCrate:
+		v.update(e.Path, e.Message, false, e.Status)
+	case EventPack:
+		v.update(e.Stage, e.Stage, true, e.Status)
+	case EventProgress:
+		if r := v.row(e.Stage, true); r != nil {
+			r.last = e
+		}
+		return // drawn by the next tick
+	default:
+		v.clear()
+		v.Console.Log(e)
+	}
+	v.redraw()
+}
+
+func (v *ProgressLogger) row(key string, pack bool) *progressRow {
+	for _, r := range v.rows {
+		if r.key == key && r.pack == pack {
+			return r
+		}
+	}
+	return nil
+}
+
+func (v *ProgressLogger) update(key, name string, pack bool, s Status) {
+	r := v.row(key, pack)
+	if r == nil {
+		r = &progressRow{key: key, pack: pack}
+		v.rows = append(v.rows, r)
+	}
+	r.name = name
+	r.status = s
+	switch s {
+	case StatusRunning:
+		r.start = time.Now()
+	case StatusDone, StatusFailed:
+		if !r.start.IsZero() {
+			r.elapsed = time.Since(r.start)
+		}
+	}
+}
+
+func (v *ProgressLogger) clear() {
+	if v.lines == 0 {
+		return
+	}
+	fmt.Fprintf(v.out, "\r\x1b[%dA\x1b[J", v.lines)
+	v.lines = 0
+}
+
+// redraw replaces the view in a single write so it does not flicker
+func (v *ProgressLogger) redraw() {
+	if len(v.rows) == 0 {
+		return
+	}
+	width, _, err := term.GetSize(v.fd)
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	var sb strings.Builder
+	if v.lines != 0 {
+		fmt.Fprintf(&sb, "\r\x1b[%dA\x1b[J", v.lines)
+	}
+	for _, r := range v.rows {
+		icon, text := v.render(r)
+		if limit := width - 3; len([]rune(text)) > limit && limit > 0 {
+			text = string([]rune(text)[:limit])
+		}
+		fmt.Fprintf(&sb, "%s %s\n", icon, text)
+	}
+	_, _ = io.WriteString(v.out, sb.String())
+	v.lines = len(v.rows)
+}
+
+// render: the colored status icon and the text of a row
+func (v *ProgressLogger) render(r *progressRow) (string, string) {
+	kind := "compile"
+	if r.pack {
+		kind = "pack"
+	}
+	text := fmt.Sprintf("%-7s %-12s", kind, r.name)
+	switch r.status {
+	case StatusDone:
+		return v.level.Green("✓"), fmt.Sprintf("%s %s", text, roundElapsed(r.elapsed))
+	case StatusFailed:
+		return v.level.Red("✗"), fmt.Sprintf("%s failed", text)
+	case StatusRunning:
+	default:
+		return "·", fmt.Sprintf("%s pending", text)
+	}
+	elapsed := time.Since(r.start)
+	text = fmt.Sprintf("%s %s", text, elapsed.Round(progressInterval))
+	if e := r.last; e != nil {
+		text = fmt.Sprintf("%s  %s written", text, formatBytes(e.Written))
+		if e.Total > 0 && e.Read > 0 {
+			read := min(e.Read, e.Total)
+			eta := time.Duration(float64(elapsed) * float64(e.Total-read) / float64(read))
+			text = fmt.Sprintf("%s  %3d%%  ETA %s", text, read*100/e.Total, eta.Round(time.Second))
+		}
+	}
+	return v.level.Yellow(string(spinnerFrames[v.frame%len(spinnerFrames)])), text
+}
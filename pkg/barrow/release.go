@@ -0,0 +1,166 @@
+package barrow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type ReleaseConfig struct {
+	// URL: download URL template of released archives, $BALI_ARTIFACT_NAME, $BALI_ARTIFACT_TARGET and $BALI_ARTIFACT_ARCH are expanded per archive,
+	// default on GitHub Actions: $GITHUB_SERVER_URL/$GITHUB_REPOSITORY/releases/download/v$BUILD_VERSION/$BALI_ARTIFACT_NAME
+	URL string `toml:"url,omitempty"`
+}
+
+// releaseArchive: a zip/tar archive of this package version found in Destination
+type releaseArchive struct {
+	Name   string
+	Path   string
+	Target string
+	Arch   string
+	SHA256 string
+	URL    string
+}
+
+var (
+	// preferred first
+	releaseArchiveSuffixes = []string{".tar.gz", ".tar.xz", ".tar.zst", ".tar.bz2", ".tar", ".zip"}
+	// source recipes (PKGBUILD, default.nix) unpack tarballs only
+	releaseTarballSuffixes = releaseArchiveSuffixes[:5]
+)
+
+func (b *BarrowCtx) destinationPath(name string) string {
+	if filepath.IsAbs(b.Destination) {
+		return filepath.Join(b.Destination, name)
+	}
+	return filepath.Join(b.CWD, b.Destination, name)
+}
+
+func (b *BarrowCtx) releaseURL(p *Package, a *releaseArchive) (string, error) {
+	template := ""
+	if p.Release != nil {
+		template = p.Release.URL
+	}
+	if len(template) == 0 {
+		if len(b.Getenv("GITHUB_REPOSITORY")) == 0 {
+			return "", fmt.Errorf("download url is not configured, set [release] url")
+		}
+		template = "${GITHUB_SERVER_URL}/${GITHUB_REPOSITORY}/releases/download/v${BUILD_VERSION}/${BALI_ARTIFACT_NAME}"
+	}
+	return os.Expand(template, func(key string) string {
+		switch key {
+		case "BALI_ARTIFACT_NAME":
+			return a.Name
+		case "BALI_ARTIFACT_TARGET":
+			return a.Target
+		case "BALI_ARTIFACT_ARCH":
+			return a.Arch
+		case "GITHUB_SERVER_URL":
+			return nonEmpty(b.Getenv(key), "https://github.com")
+		}
+		return b.Getenv(key)
+	}), nil
+}
+
+func fileSHA256(name string) (string, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// releaseArchives finds the archives name-version-target-arch.{tar.*,zip} of targets in Destination,
+// one per target/arch, preferring suffixes in the order given
+func (b *BarrowCtx) releaseArchives(p *Package, targets []string, suffixes []string) ([]*releaseArchive, error) {
+	dir := b.destinationPath("")
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	prefix := p.Name + "-" + p.Version + "-"
+	found := make(map[string]*releaseArchive)
+	rank := make(map[string]int)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		i := slices.IndexFunc(suffixes, func(s string) bool { return strings.HasSuffix(name, s) })
+		if i == -1 {
+			continue
+		}
+		target, arch, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(name, prefix), suffixes[i]), "-")
+		if !ok || strings.Contains(arch, "-") || !slices.Contains(targets, target) {
+			continue
+		}
+		key := target + "/" + arch
+		if r, ok := rank[key]; ok && r <= i {
+			continue
+		}
+		rank[key] = i
+		found[key] = &releaseArchive{Name: name, Path: filepath.Join(dir, name), Target: target, Arch: arch}
+	}
+	archives := make([]*releaseArchive, 0, len(found))
+	for _, a := range found {
+		if a.SHA256, err = fileSHA256(a.Path); err != nil {
+			return nil, err
+		}
+		if a.URL, err = b.releaseURL(p, a); err != nil {
+			return nil, err
+		}
+		archives = append(archives, a)
+	}
+	if len(archives) == 0 {
+		return nil, fmt.Errorf("no %s archives of %s %s in %s, create them first with --pack=tar or --pack=zip", strings.Join(targets, "/"), p.Name, p.Version, dir)
+	}
+	slices.SortFunc(archives, func(a, b *releaseArchive) int {
+		return strings.Compare(a.Target+"/"+a.Arch, b.Target+"/"+b.Arch)
+	})
+	return archives, nil
+}
+
+// writeManifest writes a generated manifest into Destination and prints its hash
+func (b *BarrowCtx) writeManifest(ctx context.Context, name string, data []byte) (string, error) {
+	return b.WriteArtifact(ctx, name, 0644, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// packFormats: windows builds with a download url also get winget manifests and a Chocolatey package
+func (b *BarrowCtx) packFormats(p *Package) []string {
+	if b.Target != "windows" {
+		return b.Pack
+	}
+	packed := make(map[string]bool)
+	for _, pack := range b.Pack {
+		packed[strings.ToLower(pack)] = true
+	}
+	if !packed["zip"] && !packed["exe"] && !packed["msi"] {
+		return b.Pack
+	}
+	if (p.Release == nil || len(p.Release.URL) == 0) && len(b.Getenv("GITHUB_REPOSITORY")) == 0 {
+		b.status("skip winget and chocolatey manifests: download url is not configured, set [release] url")
+		return b.Pack
+	}
+	formats := append([]string(nil), b.Pack...)
+	if !packed["winget"] {
+		formats = append(formats, "winget")
+	}
+	if packed["zip"] && !packed["chocolatey"] {
+		formats = append(formats, "chocolatey")
+	}
+	return formats
+}
@@ -0,0 +1,218 @@
+package barrow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestArchives(t *testing.T, b *BarrowCtx, names ...string) map[string]string {
+	t.Helper()
+	hashes := make(map[string]string)
+	if err := os.MkdirAll(b.Destination, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		sum := sha256.Sum256([]byte(name))
+		hashes[name] = hex.EncodeToString(sum[:])
+		if err := os.WriteFile(filepath.Join(b.Destination, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return hashes
+}
+
+func TestBrewClassName(t *testing.T) {
+	for name, want := range map[string]string{
+		"bali":       "Bali",
+		"bali-dev":   "BaliDev",
+		"go_tool.x":  "GoToolX",
+		"node@20":    "NodeAT20",
+		"libc++":     "Libcxx",
+		"Mixed-Case": "MixedCase",
+	} {
+		if got := brewClassName(name); got != want {
+			t.Errorf("brewClassName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestBrew(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	p.Homepage = "https://example.com/jack"
+	p.Release = &ReleaseConfig{URL: "https://example.com/v$BUILD_VERSION/$BALI_ARTIFACT_NAME"}
+	hashes := writeTestArchives(t, b,
+		"jack-1.2.3-darwin-arm64.tar.gz",
+		"jack-1.2.3-darwin-arm64.zip", // tar preferred
+		"jack-1.2.3-linux-amd64.tar.xz",
+		"jack-1.2.3-linux-arm64.tar.gz",
+		"jack-1.2.3-windows-amd64.zip", // not for Homebrew
+		"jack-1.2.2-linux-amd64.tar.gz",
+	)
+	artifact, err := b.brew(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	formula := string(data)
+	for _, want := range []string{
+		"class Jack < Formula\n",
+		`  desc "Jack test package"`,
+		`  license "MIT"`,
+		"  on_macos do\n    if Hardware::CPU.arm? && Hardware::CPU.is_64_bit?\n      url \"https://example.com/v1.2.3/jack-1.2.3-darwin-arm64.tar.gz\"\n      sha256 \"" + hashes["jack-1.2.3-darwin-arm64.tar.gz"] + "\"\n    end\n  end\n",
+		`      url "https://example.com/v1.2.3/jack-1.2.3-linux-amd64.tar.xz"`,
+		`      sha256 "` + hashes["jack-1.2.3-linux-arm64.tar.gz"] + `"`,
+		`    prefix.install Dir["*"]`,
+		`    assert_predicate prefix/"bin/jack", :exist?`,
+	} {
+		if !strings.Contains(formula, want) {
+			t.Errorf("formula missing %q:\n%s", want, formula)
+		}
+	}
+	for _, unwanted := range []string{"windows", "1.2.2", "darwin-arm64.zip"} {
+		if strings.Contains(formula, unwanted) {
+			t.Errorf("formula contains %q:\n%s", unwanted, formula)
+		}
+	}
+	p.Release = nil
+	if _, err := b.brew(context.Background(), p, crates); err == nil && len(os.Getenv("GITHUB_REPOSITORY")) == 0 {
+		t.Errorf("brew without download url succeeded")
+	}
+}
+
+func TestScoop(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	b.Target = "windows"
+	p.Release = &ReleaseConfig{URL: "https://example.com/$BALI_ARTIFACT_TARGET/$BALI_ARTIFACT_ARCH/$BALI_ARTIFACT_NAME"}
+	if _, err := b.scoop(context.Background(), p, crates); err == nil {
+		t.Fatal("scoop without windows archives succeeded")
+	}
+	hashes := writeTestArchives(t, b, "jack-1.2.3-windows-amd64.zip", "jack-1.2.3-windows-arm64.zip", "jack-1.2.3-linux-amd64.tar.gz")
+	artifact, err := b.scoop(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m scoopManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != "1.2.3" || m.License != "MIT" || len(m.Architecture) != 2 {
+		t.Fatalf("manifest: %s", data)
+	}
+	x64 := m.Architecture["64bit"]
+	if x64 == nil || x64.Hash != hashes["jack-1.2.3-windows-amd64.zip"] || x64.ExtractDir != "jack-1.2.3-windows-amd64" ||
+		x64.URL != "https://example.com/windows/amd64/jack-1.2.3-windows-amd64.zip" {
+		t.Errorf("64bit: %+v", x64)
+	}
+	if len(m.Bin) != 1 || m.Bin[0] != "bin/jack.exe" {
+		t.Errorf("bin: %v", m.Bin)
+	}
+}
+
+func TestPkgbuild(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	p.Maintainer = "Jack <jack@example.com>"
+	p.Version = "1.2.3-rc1"
+	p.Pkgbuild = &PkgbuildConfig{Depends: []string{"glibc"}}
+	p.Release = &ReleaseConfig{URL: "https://example.com/$BALI_ARTIFACT_NAME"}
+	hashes := writeTestArchives(t, b,
+		"jack-1.2.3-rc1-linux-amd64.tar.gz",
+		"jack-1.2.3-rc1-linux-amd64.zip",
+		"jack-1.2.3-rc1-linux-arm64.tar.zst",
+		"jack-1.2.3-rc1-darwin-arm64.tar.gz",
+	)
+	artifact, err := b.archPkgbuild(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(b.Destination, "aur", "jack-bin", "PKGBUILD"); artifact != want {
+		t.Fatalf("PKGBUILD %s, want %s", artifact, want)
+	}
+	data, err := os.ReadFile(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkgbuild := string(data)
+	for _, want := range []string{
+		"# Maintainer: Jack <jack@example.com>\n",
+		"pkgname=jack-bin\npkgver=1.2.3_rc1\npkgrel=1\n",
+		"arch=('x86_64' 'aarch64')\n",
+		"license=('MIT')\n",
+		"provides=('jack')\nconflicts=('jack')\n",
+		"depends=('glibc')\n",
+		"source_x86_64=('jack-1.2.3-rc1-linux-amd64.tar.gz::https://example.com/jack-1.2.3-rc1-linux-amd64.tar.gz')\n",
+		"sha256sums_aarch64=('" + hashes["jack-1.2.3-rc1-linux-arm64.tar.zst"] + "')\n",
+		"    aarch64) _dir='jack-1.2.3-rc1-linux-arm64' ;;\n",
+		`cp -a --no-preserve=ownership "$srcdir/$_dir/." "$pkgdir/usr/local/"`,
+	} {
+		if !strings.Contains(pkgbuild, want) {
+			t.Errorf("PKGBUILD missing %q:\n%s", want, pkgbuild)
+		}
+	}
+	if strings.Contains(pkgbuild, "darwin") || strings.Contains(pkgbuild, ".zip") {
+		t.Errorf("PKGBUILD references foreign archives:\n%s", pkgbuild)
+	}
+	if data, err = os.ReadFile(filepath.Join(filepath.Dir(artifact), ".SRCINFO")); err != nil {
+		t.Fatal(err)
+	}
+	if srcinfo := string(data); !strings.HasPrefix(srcinfo, "pkgbase = jack-bin\n\tpkgdesc = Jack test package\n\tpkgver = 1.2.3_rc1\n") ||
+		!strings.HasSuffix(srcinfo, "\npkgname = jack-bin\n") {
+		t.Errorf(".SRCINFO:\n%s", srcinfo)
+	}
+}
+
+func TestNix(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	p.Homepage = "https://example.com/jack"
+	p.Release = &ReleaseConfig{URL: "https://example.com/${BUILD_VERSION}/$BALI_ARTIFACT_NAME"}
+	hashes := writeTestArchives(t, b,
+		"jack-1.2.3-darwin-arm64.tar.gz",
+		"jack-1.2.3-darwin-universal.tar.gz",
+		"jack-1.2.3-linux-amd64.tar.zst",
+		"jack-1.2.3-windows-amd64.zip",
+	)
+	artifact, err := b.nix(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	derivation := string(data)
+	hash, err := nixHash(hashes["jack-1.2.3-darwin-arm64.tar.gz"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"{ lib, stdenvNoCC, fetchurl, zstd }:\n",
+		"    aarch64-darwin = fetchurl {\n      url = \"https://example.com/1.2.3/jack-1.2.3-darwin-arm64.tar.gz\";\n      hash = \"" + hash + "\";\n    };\n",
+		`url = "https://example.com/1.2.3/jack-1.2.3-darwin-universal.tar.gz";`,
+		"    x86_64-linux = fetchurl {\n",
+		`  pname = "jack";`,
+		`  version = "1.2.3";`,
+		"  nativeBuildInputs = [ zstd ];\n",
+		`    license = lib.getLicenseFromSpdxId "MIT";`,
+		`    mainProgram = "jack";`,
+		`(throw "jack: unsupported system ${stdenvNoCC.hostPlatform.system}")`,
+	} {
+		if !strings.Contains(derivation, want) {
+			t.Errorf("default.nix missing %q:\n%s", want, derivation)
+		}
+	}
+	if strings.Count(derivation, "aarch64-darwin") != 1 || !strings.Contains(derivation, "x86_64-darwin") || strings.Contains(derivation, "windows") {
+		t.Errorf("default.nix sources:\n%s", derivation)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"unicode/utf16"
+)
+
+// Shell Link (.lnk) binary format, target by LinkInfo local base path only (no ID list)
+//
+// https://learn.microsoft.com/en-us/openspecs/windows_protocols/ms-shllink
+
+const (
+	linkHasLinkInfo      = 0x00000002
+	linkHasName          = 0x00000004
+	linkHasWorkingDir    = 0x00000010
+	linkHasArguments     = 0x00000020
+	linkIsUnicode        = 0x00000080
+	fileAttributeArchive = 0x00000020
+	swShowNormal         = 1
+	driveFixed           = 3
+	linkInfoHeaderSize   = 0x24
+	volumeIDSize         = 0x11
+)
+
+var (
+	// {00021401-0000-0000-C000-000000000046}
+	shellLinkCLSID = [16]byte{0x01, 0x14, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0xC0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x46}
+)
+
+func ansiString(s string) []byte {
+	b := make([]byte, 0, len(s)+1)
+	for _, r := range s {
+		if r >= 0x80 {
+			r = '?' // the unicode path is used when present
+		}
+		b = append(b, byte(r))
+	}
+	return append(b, 0)
+}
+
+func utf16String(s string, terminate bool) []byte {
+	u := utf16.Encode([]rune(s))
+	if terminate {
+		u = append(u, 0)
+	}
+	b := make([]byte, len(u)*2)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[i*2:], c)
+	}
+	return b
+}
+
+// writeShellLink writes a shortcut to target, arguments, workDir and description are optional
+func writeShellLink(w io.Writer, target, arguments, workDir, description string) error {
+	flags := uint32(linkHasLinkInfo | linkIsUnicode)
+	if len(description) != 0 {
+		flags |= linkHasName
+	}
+	if len(workDir) != 0 {
+		flags |= linkHasWorkingDir
+	}
+	if len(arguments) != 0 {
+		flags |= linkHasArguments
+	}
+	le := binary.LittleEndian
+	var buf bytes.Buffer
+	// ShellLinkHeader
+	_ = binary.Write(&buf, le, uint32(0x4C))
+	buf.Write(shellLinkCLSID[:])
+	_ = binary.Write(&buf, le, flags)
+	_ = binary.Write(&buf, le, uint32(fileAttributeArchive))
+	buf.Write(make([]byte, 24))           // creation, access, write time
+	_ = binary.Write(&buf, le, uint32(0)) // file size
+	_ = binary.Write(&buf, le, int32(0))  // icon index
+	_ = binary.Write(&buf, le, uint32(swShowNormal))
+	buf.Write(make([]byte, 2+2+4+4)) // hotkey, reserved
+	// LinkInfo
+	localBasePath := ansiString(target)
+	localBasePathUnicode := utf16String(target, true)
+	volumeIDOffset := uint32(linkInfoHeaderSize)
+	localBasePathOffset := volumeIDOffset + volumeIDSize
+	commonPathSuffixOffset := localBasePathOffset + uint32(len(localBasePath))
+	localBasePathOffsetUnicode := commonPathSuffixOffset + 1
+	commonPathSuffixOffsetUnicode := localBasePathOffsetUnicode + uint32(len(localBasePathUnicode))
+	linkInfoSize := commonPathSuffixOffsetUnicode + 2
+	for _, v := range []uint32{linkInfoSize, linkInfoHeaderSize, 1, volumeIDOffset, localBasePathOffset, 0, commonPathSuffixOffset, localBasePathOffsetUnicode, commonPathSuffixOffsetUnicode} {
+		_ = binary.Write(&buf, le, v)
+	}
+	// VolumeID: fixed drive, empty label
+	for _, v := range []uint32{volumeIDSize, driveFixed, 0, 0x10} {
+		_ = binary.Write(&buf, le, v)
+	}
+	buf.WriteByte(0)
+	buf.Write(localBasePath)
+	buf.WriteByte(0) // common path suffix
+	buf.Write(localBasePathUnicode)
+	buf.Write([]byte{0, 0})
+	// StringData: counted UTF-16 strings
+	for _, s := range []string{description, workDir, arguments} {
+		if len(s) == 0 {
+			continue
+		}
+		u := utf16String(s, false)
+		_ = binary.Write(&buf, le, uint16(len(u)/2))
+		buf.Write(u)
+	}
+	// terminal block
+	_ = binary.Write(&buf, le, uint32(0))
+	_, err := w.Write(buf.Bytes())
+	return err
+}
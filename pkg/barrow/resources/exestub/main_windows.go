@@ -0,0 +1,312 @@
+//go:build windows
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	uninstallKeyPrefix = `Software\Microsoft\Windows\CurrentVersion\Uninstall\`
+	keyWrite           = 0x20006
+	keyWow6464Key      = 0x0100
+	regSZ              = 1
+	regDWORD           = 4
+	createNoWindow     = 0x08000000
+)
+
+var (
+	advapi32                = syscall.NewLazyDLL("advapi32.dll")
+	kernel32                = syscall.NewLazyDLL("kernel32.dll")
+	procRegCreateKeyExW     = advapi32.NewProc("RegCreateKeyExW")
+	procRegSetValueExW      = advapi32.NewProc("RegSetValueExW")
+	procRegDeleteTreeW      = advapi32.NewProc("RegDeleteTreeW")
+	procGetConsoleProcesses = kernel32.NewProc("GetConsoleProcessList")
+)
+
+func rootKey(scope string) syscall.Handle {
+	if scope == ScopeMachine {
+		return syscall.HKEY_LOCAL_MACHINE
+	}
+	return syscall.HKEY_CURRENT_USER
+}
+
+func regCreateKey(root syscall.Handle, path string) (syscall.Handle, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var key syscall.Handle
+	r, _, _ := procRegCreateKeyExW.Call(uintptr(root), uintptr(unsafe.Pointer(p)), 0, 0, 0, keyWrite|keyWow6464Key, 0, uintptr(unsafe.Pointer(&key)), 0)
+	if r != 0 {
+		return 0, syscall.Errno(r)
+	}
+	return key, nil
+}
+
+func regSetValue(key syscall.Handle, name string, typ uint32, data []byte) error {
+	p, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		return err
+	}
+	var ptr uintptr
+	if len(data) != 0 {
+		ptr = uintptr(unsafe.Pointer(&data[0]))
+	}
+	if r, _, _ := procRegSetValueExW.Call(uintptr(key), uintptr(unsafe.Pointer(p)), 0, uintptr(typ), ptr, uintptr(len(data))); r != 0 {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+func regSetString(key syscall.Handle, name, value string) error {
+	return regSetValue(key, name, regSZ, utf16String(value, true))
+}
+
+func regSetDWORD(key syscall.Handle, name string, value uint32) error {
+	return regSetValue(key, name, regDWORD, []byte{byte(value), byte(value >> 8), byte(value >> 16), byte(value >> 24)})
+}
+
+func regDeleteTree(root syscall.Handle, path string) error {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return err
+	}
+	if r, _, _ := procRegDeleteTreeW.Call(uintptr(root), uintptr(unsafe.Pointer(p))); r != 0 && syscall.Errno(r) != syscall.ERROR_FILE_NOT_FOUND {
+		return syscall.Errno(r)
+	}
+	return nil
+}
+
+// registerUninstaller adds the entry shown in Apps & features
+func registerUninstaller(setup *Setup, prefix string, size int64) error {
+	key, err := regCreateKey(rootKey(setup.Scope), uninstallKeyPrefix+setup.Name)
+	if err != nil {
+		return err
+	}
+	defer syscall.RegCloseKey(key)
+	uninstaller := filepath.Join(prefix, uninstallerName)
+	icon := uninstaller
+	if len(setup.Shortcuts) != 0 {
+		icon = filepath.Join(prefix, filepath.FromSlash(setup.Shortcuts[0].Target))
+	}
+	values := [][2]string{
+		{"DisplayName", setup.Name},
+		{"DisplayVersion", setup.Version},
+		{"Publisher", setup.Publisher},
+		{"URLInfoAbout", setup.Homepage},
+		{"InstallLocation", prefix},
+		{"DisplayIcon", icon},
+		{"UninstallString", `"` + uninstaller + `" --uninstall`},
+		{"QuietUninstallString", `"` + uninstaller + `" --uninstall --quiet`},
+	}
+	for _, kv := range values {
+		if len(kv[1]) == 0 {
+			continue
+		}
+		if err := regSetString(key, kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+	for name, v := range map[string]uint32{"NoModify": 1, "NoRepair": 1, "EstimatedSize": uint32(size / 1024)} {
+		if err := regSetDWORD(key, name, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func programsFolder(scope string) string {
+	if scope == ScopeMachine {
+		return filepath.Join(expandPercent("%ProgramData%"), `Microsoft\Windows\Start Menu\Programs`)
+	}
+	return filepath.Join(expandPercent("%APPDATA%"), `Microsoft\Windows\Start Menu\Programs`)
+}
+
+func createShortcuts(setup *Setup, prefix string) ([]string, error) {
+	folder := programsFolder(setup.Scope)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return nil, err
+	}
+	created := make([]string, 0, len(setup.Shortcuts))
+	for _, s := range setup.Shortcuts {
+		target := filepath.Join(prefix, filepath.FromSlash(s.Target))
+		lnk := filepath.Join(folder, s.Name+".lnk")
+		fd, err := os.Create(lnk)
+		if err != nil {
+			return created, err
+		}
+		if err := writeShellLink(fd, target, s.Arguments, filepath.Dir(target), s.Description); err != nil {
+			_ = fd.Close()
+			return created, err
+		}
+		if err := fd.Close(); err != nil {
+			return created, err
+		}
+		created = append(created, lnk)
+	}
+	return created, nil
+}
+
+type options struct {
+	prefix     string
+	uninstall  bool
+	quiet      bool
+	removeSelf bool
+}
+
+func (o *options) printf(format string, a ...any) {
+	if !o.quiet {
+		fmt.Fprintf(os.Stderr, format, a...)
+	}
+}
+
+func install(o *options, exe string) error {
+	zr, setup, closer, err := openPayload(exe)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+	prefix := o.prefix
+	if len(prefix) == 0 {
+		prefix = setup.defaultPrefix()
+	}
+	if prefix, err = filepath.Abs(prefix); err != nil {
+		return err
+	}
+	o.printf("Installing %s %s to %s\n", setup.Name, setup.Version, prefix)
+	if err := os.MkdirAll(prefix, 0755); err != nil {
+		return err
+	}
+	files, err := extract(zr, prefix, func(name string) {
+		o.printf("  %s\n", name)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeUninstaller(exe, setup.StubSize, filepath.Join(prefix, uninstallerName)); err != nil {
+		return err
+	}
+	shortcuts, err := createShortcuts(setup, prefix)
+	m := &Manifest{Name: setup.Name, Version: setup.Version, Scope: setup.Scope, Files: files, Shortcuts: shortcuts}
+	if mErr := writeManifest(prefix, m); mErr != nil {
+		return mErr
+	}
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, f := range zr.File {
+		size += int64(f.UncompressedSize64)
+	}
+	if err := registerUninstaller(setup, prefix, size); err != nil {
+		return fmt.Errorf("register uninstaller error: %w", err)
+	}
+	o.printf("%s %s installed\n", setup.Name, setup.Version)
+	return nil
+}
+
+// uninstall: a running executable cannot be removed, so the uninstaller inside prefix relaunches from a temporary copy
+// that deletes itself on exit
+func uninstall(o *options, exe string) error {
+	prefix := o.prefix
+	if len(prefix) == 0 {
+		prefix = filepath.Dir(exe)
+	}
+	prefix, err := filepath.Abs(prefix)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Dir(exe), prefix) {
+		temp := filepath.Join(os.TempDir(), fmt.Sprintf("uninstall-%d.exe", os.Getpid()))
+		si, err := os.Stat(exe)
+		if err != nil {
+			return err
+		}
+		if err := writeUninstaller(exe, si.Size(), temp); err != nil {
+			return err
+		}
+		args := []string{"--uninstall", "--remove-self", "--prefix=" + prefix}
+		if o.quiet {
+			args = append(args, "--quiet")
+		}
+		cmd := exec.Command(temp, args...)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+		os.Exit(0) // release uninstall.exe, the copy continues in this console
+	}
+	m, err := readManifest(prefix)
+	if err != nil {
+		return fmt.Errorf("read install manifest error: %w", err)
+	}
+	o.printf("Uninstalling %s %s from %s\n", m.Name, m.Version, prefix)
+	errs := removeInstalled(prefix, m)
+	if err := regDeleteTree(rootKey(m.Scope), uninstallKeyPrefix+m.Name); err != nil {
+		errs = append(errs, err)
+	}
+	for _, e := range errs {
+		o.printf("  %v\n", e)
+	}
+	if len(errs) != 0 {
+		return fmt.Errorf("%d items could not be removed", len(errs))
+	}
+	o.printf("%s %s uninstalled\n", m.Name, m.Version)
+	return nil
+}
+
+// removeSelf: the temporary uninstaller cannot delete itself while running, a hidden cmd deletes it
+// once this process has exited; MoveFileEx(MOVEFILE_DELAY_UNTIL_REBOOT) would need administrator rights
+func removeSelf(exe string) {
+	cmd := exec.Command("cmd.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		CmdLine:       fmt.Sprintf(`cmd.exe /C ping -n 3 127.0.0.1 >nul & del /F /Q "%s"`, exe),
+		CreationFlags: createNoWindow,
+	}
+	_ = cmd.Start()
+}
+
+// ownConsole: started from Explorer, the console closes as soon as we exit
+func ownConsole() bool {
+	var pids [2]uint32
+	n, _, _ := procGetConsoleProcesses.Call(uintptr(unsafe.Pointer(&pids[0])), 2)
+	return n == 1
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.prefix, "prefix", "", "directory in which to install")
+	flag.BoolVar(&o.uninstall, "uninstall", false, "remove an installation")
+	flag.BoolVar(&o.quiet, "quiet", false, "do not print progress")
+	flag.BoolVar(&o.removeSelf, "remove-self", false, "delete this executable on exit, set on the temporary uninstaller")
+	flag.Parse()
+	exe, err := os.Executable()
+	if err == nil {
+		if o.uninstall {
+			err = uninstall(&o, exe)
+		} else {
+			err = install(&o, exe)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\x1b[31merror: %v\x1b[0m\n", err)
+	}
+	if !o.quiet && ownConsole() {
+		fmt.Fprintf(os.Stderr, "Press Enter to exit...")
+		_, _ = fmt.Scanln()
+	}
+	if o.removeSelf && len(exe) != 0 {
+		removeSelf(exe)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,246 @@
+// Command setup is the self-extracting installer stub of the bali exe pack format.
+//
+// bali compiles it for the target arch, then appends the payload: a zip archive whose
+// offsets are relative to the start of the executable, the setup configuration is the zip comment.
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	ScopeUser    = "user"
+	ScopeMachine = "machine"
+
+	uninstallerName = "uninstall.exe"
+	manifestName    = "uninstall.json"
+)
+
+// Shortcut: Target is relative to the install prefix
+type Shortcut struct {
+	Name        string `json:"name"`
+	Target      string `json:"target"`
+	Arguments   string `json:"arguments,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Setup: the configuration written by bali into the zip comment
+type Setup struct {
+	Name      string      `json:"name"`
+	Version   string      `json:"version"`
+	Publisher string      `json:"publisher,omitempty"`
+	Homepage  string      `json:"homepage,omitempty"`
+	Scope     string      `json:"scope,omitempty"`
+	Prefix    string      `json:"prefix,omitempty"`
+	StubSize  int64       `json:"stub_size"`
+	Shortcuts []*Shortcut `json:"shortcuts,omitempty"`
+}
+
+// Manifest: what was installed, read by the uninstaller
+type Manifest struct {
+	Name      string   `json:"name"`
+	Version   string   `json:"version"`
+	Scope     string   `json:"scope"`
+	Files     []string `json:"files"`               // relative to the prefix
+	Shortcuts []string `json:"shortcuts,omitempty"` // absolute paths
+}
+
+var (
+	ErrNoPayload = errors.New("setup: installer payload not found")
+)
+
+// openPayload opens the zip payload appended to the executable
+func openPayload(exe string) (*zip.Reader, *Setup, io.Closer, error) {
+	fd, err := os.Open(exe)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	si, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, nil, nil, err
+	}
+	zr, err := zip.NewReader(fd, si.Size())
+	if err != nil {
+		_ = fd.Close()
+		return nil, nil, nil, ErrNoPayload
+	}
+	var setup Setup
+	if err := json.Unmarshal([]byte(zr.Comment), &setup); err != nil {
+		_ = fd.Close()
+		return nil, nil, nil, fmt.Errorf("setup: bad installer configuration: %w", err)
+	}
+	return zr, &setup, fd, nil
+}
+
+// expandPercent expands %VAR% like cmd.exe
+func expandPercent(s string) string {
+	var sb strings.Builder
+	for {
+		i := strings.IndexByte(s, '%')
+		if i == -1 {
+			sb.WriteString(s)
+			return sb.String()
+		}
+		j := strings.IndexByte(s[i+1:], '%')
+		if j == -1 {
+			sb.WriteString(s)
+			return sb.String()
+		}
+		sb.WriteString(s[:i])
+		name := s[i+1 : i+1+j]
+		if v, ok := os.LookupEnv(name); ok && len(name) != 0 {
+			sb.WriteString(v)
+		} else {
+			sb.WriteString(s[i : i+j+2])
+		}
+		s = s[i+j+2:]
+	}
+}
+
+// defaultPrefix: per-user installs do not require elevation
+func (s *Setup) defaultPrefix() string {
+	if len(s.Prefix) != 0 {
+		return expandPercent(s.Prefix)
+	}
+	if s.Scope == ScopeMachine {
+		return filepath.Join(expandPercent("%ProgramFiles%"), s.Name)
+	}
+	return filepath.Join(expandPercent("%LOCALAPPDATA%"), "Programs", s.Name)
+}
+
+// safeJoin rejects names escaping the prefix
+func safeJoin(prefix, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("setup: illegal file name '%s'", name)
+	}
+	return filepath.Join(prefix, clean), nil
+}
+
+func extractFile(f *zip.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	out, err := os.OpenFile(target, os.O_RDWR|os.O_CREATE|os.O_TRUNC, f.Mode().Perm()|0200)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// extract writes regular files and directories, symbolic links (crate aliases) are skipped
+func extract(zr *zip.Reader, prefix string, progress func(name string)) ([]string, error) {
+	files := make([]string, 0, len(zr.File))
+	for _, f := range zr.File {
+		target, err := safeJoin(prefix, f.Name)
+		if err != nil {
+			return files, err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return files, err
+			}
+			continue
+		case !mode.IsRegular():
+			continue
+		}
+		progress(f.Name)
+		if err := extractFile(f, target); err != nil {
+			return files, fmt.Errorf("setup: extract %s: %w", f.Name, err)
+		}
+		files = append(files, filepath.ToSlash(filepath.Clean(f.Name)))
+	}
+	return files, nil
+}
+
+// writeUninstaller copies the stub (without payload) as the uninstaller
+func writeUninstaller(exe string, stubSize int64, target string) error {
+	in, err := os.Open(exe)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	if _, err := io.CopyN(out, in, stubSize); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func writeManifest(prefix string, m *Manifest) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(prefix, manifestName), b, 0644)
+}
+
+func readManifest(prefix string) (*Manifest, error) {
+	b, err := os.ReadFile(filepath.Join(prefix, manifestName))
+	if err != nil {
+		return nil, err
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// removeInstalled removes files, then empty parent directories up to and including prefix
+func removeInstalled(prefix string, m *Manifest) []error {
+	var errs []error
+	dirs := make(map[string]bool)
+	for _, name := range append(m.Files, uninstallerName, manifestName) {
+		target, err := safeJoin(prefix, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+		for d := filepath.Dir(target); len(d) > len(prefix); d = filepath.Dir(d) {
+			dirs[d] = true
+		}
+	}
+	for _, s := range m.Shortcuts {
+		if err := os.Remove(s); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	// deepest first
+	sorted := make([]string, 0, len(dirs))
+	for d := range dirs {
+		sorted = append(sorted, d)
+	}
+	slices.SortFunc(sorted, func(a, b string) int { return len(b) - len(a) })
+	for _, d := range append(sorted, prefix) {
+		_ = os.Remove(d) // only empty directories
+	}
+	return errs
+}
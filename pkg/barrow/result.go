@@ -0,0 +1,40 @@
+package barrow
+
+import (
+	"time"
+)
+
+// CrateResult: a compiled crate
+type CrateResult struct {
+	Name    string
+	Version string
+	Path    string // the binary in the build directory
+	Elapsed time.Duration
+}
+
+// ArtifactFile: a file written into Destination
+type ArtifactFile struct {
+	Name   string
+	Path   string
+	SHA256 string
+}
+
+// PackResult: the artifact of one pack format, Files lists every file the packager wrote,
+// several for winget manifests or chocolatey packages
+type PackResult struct {
+	Format  string
+	Path    string
+	Files   []*ArtifactFile
+	Elapsed time.Duration
+}
+
+// BuildResult: what Run built, partial when Run failed
+type BuildResult struct {
+	Name      string
+	Version   string
+	Target    string
+	Arch      string
+	Crates    []*CrateResult
+	Artifacts []*PackResult
+	Elapsed   time.Duration
+}
@@ -2,13 +2,8 @@ package barrow
 
 import (
 	"context"
-	"crypto/sha256"
-	"fmt"
 	"io"
 	"io/fs"
-	"os"
-	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -22,96 +17,28 @@ const (
 	tagLink = 0o120000
 )
 
-func (b *BarrowCtx) addItem2RPM(r *rpmpack.RPM, item *FileItem, prefix string) error {
-	itemPath := filepath.Join(b.CWD, item.Path)
-	var nameInArchive string
-	switch {
-	case len(item.Rename) != 0:
-		nameInArchive = filepath.Join(prefix, item.Destination, item.Rename)
-	default:
-		nameInArchive = filepath.Join(prefix, item.Destination, filepath.Base(item.Path))
-	}
-	si, err := os.Lstat(itemPath)
-	if err != nil {
-		return err
-	}
-	if isSymlink(si) {
-		linkTarget, err := os.Readlink(itemPath)
-		if err != nil {
-			return fmt.Errorf("add %s to zip error: %w", nameInArchive, err)
-		}
-		r.AddFile(rpmpack.RPMFile{
-			Name:  ToNixPath(nameInArchive),
-			Body:  []byte(ToNixPath(linkTarget)),
-			Mode:  tagLink,
-			Group: "root",
-			Owner: "root",
-			MTime: uint32(si.ModTime().Unix()),
-		})
-		return nil
-	}
-	mode := si.Mode().Perm()
-	if len(item.Permissions) != 0 {
-		if m, err := strconv.ParseInt(item.Permissions, 8, 64); err == nil {
-			mode = fs.FileMode(m)
-		}
-	}
-	fd, err := os.Open(itemPath)
-	if err != nil {
-		return err
-	}
-	defer fd.Close()
-	payload, err := io.ReadAll(fd)
-	if err != nil {
-		return err
-	}
-	r.AddFile(rpmpack.RPMFile{
-		Name:  ToNixPath(nameInArchive),
-		Body:  payload,
-		Mode:  uint(mode),
+func addStaged2RPM(r *rpmBuilder, f *StagedFile) {
+	file := rpmpack.RPMFile{
+		Name:  ToNixPath(f.Name),
+		Mode:  uint(unixPerm(f.Mode)),
 		Group: "root",
 		Owner: "root",
-		MTime: uint32(si.ModTime().Unix()),
-	})
-	return nil
-}
-
-func (b *BarrowCtx) addCrate2RPM(r *rpmpack.RPM, crate *Crate, prefix string) error {
-	baseName := b.basename(crate.Name)
-	out := filepath.Join(b.Out, crate.Destination, baseName)
-	fd, err := os.Open(out)
-	if err != nil {
-		return err
+		MTime: uint32(f.ModTime.Unix()),
 	}
-	defer fd.Close()
-	si, err := fd.Stat()
-	if err != nil {
-		return err
-	}
-	payload, err := io.ReadAll(fd)
-	if err != nil {
-		return err
+	switch {
+	case f.Mode&fs.ModeSymlink != 0:
+		file.Body = []byte(ToNixPath(f.Link))
+		file.Mode = tagLink
+		r.AddFile(file)
+	case f.Mode.IsDir():
+		file.Mode |= 040000
+		r.AddFile(file)
+	default:
+		r.AddSource(file, f.Source)
 	}
-	nameInArchive := filepath.Join(prefix, crate.Destination, baseName)
-	r.AddFile(rpmpack.RPMFile{
-		Name:  ToNixPath(nameInArchive),
-		Body:  payload,
-		Mode:  0755,
-		Group: "root",
-		Owner: "root",
-		MTime: uint32(si.ModTime().Unix()),
-	})
-	return nil
 }
 
 var (
-	rpmSupportedCompressor = map[string]bool{
-		"":     true,
-		"gzip": true,
-		"zstd": true,
-		"lzma": true,
-		"xz":   true,
-	}
 	// https://docs.fedoraproject.org/ro/Fedora_Draft_Documentation/0.1/html/RPM_Guide/ch01s03.html
 	// https://github.com/rpm-software-management/rpm/blob/4a9b7b5908d8b463a836b51322242677677bd8b7/lib/rpmrc.cc#L1167
 	// nolint: gochecknoglobals
@@ -137,16 +64,17 @@ func rpmArchGuard(arch string) string {
 	return arch
 }
 
-func (b *BarrowCtx) rpm(ctx context.Context, p *Package, crates []*Crate) error {
+func (b *BarrowCtx) rpm(ctx context.Context, p *Package, crates []*Crate) (string, error) {
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return "", ctx.Err()
 	default:
 	}
-	if !rpmSupportedCompressor[b.Compression] {
-		return fmt.Errorf("unsupported compressor '%s'", b.Compression)
+	c, err := b.formatCompression(p, "rpm")
+	if err != nil {
+		return "", err
 	}
-	r, err := rpmpack.NewRPM(rpmpack.RPMMetaData{
+	r, err := newRPMBuilder(rpmpack.RPMMetaData{
 		Name:        nonEmpty(p.PackageName, p.Name),
 		Summary:     nonEmpty(p.Summary, strings.Split(p.Description, "\n")[0]),
 		Description: p.Description,
@@ -159,40 +87,24 @@ func (b *BarrowCtx) rpm(ctx context.Context, p *Package, crates []*Crate) error
 		Group:       p.Group,
 		Licence:     p.License,
 		BuildHost:   b.Getenv("BUILD_HOST"),
-		Compressor:  b.Compression,
 		BuildTime:   time.Now(),
-	})
+	}, c)
 	if err != nil {
-		return err
-	}
-	for _, item := range p.Include {
-		if err := b.addItem2RPM(r, item, p.Prefix); err != nil {
-			return err
-		}
+		return "", err
 	}
-	for _, crate := range crates {
-		if err := b.addCrate2RPM(r, crate, p.Prefix); err != nil {
-			return err
-		}
+	staged, err := b.Stage(p, crates, p.Prefix)
+	if err != nil {
+		return "", err
 	}
-	rpmPackageName := fmt.Sprintf("%s-%s-%s.%s.rpm", r.Name, r.Version, r.Release, r.Arch)
-	var rpmPath string
-	if filepath.IsAbs(b.Destination) {
-		rpmPath = filepath.Join(b.Destination, rpmPackageName)
-	} else {
-		rpmPath = filepath.Join(b.CWD, b.Destination, rpmPackageName)
+	for _, f := range staged {
+		addStaged2RPM(r, f)
 	}
-	_ = os.MkdirAll(filepath.Dir(rpmPath), 0755)
-	fd, err := os.Create(rpmPath)
+	b.addServices2RPM(r, p, crates)
+	rpmPackageName, err := b.ArtifactName("rpm", p, map[string]string{"name": r.Name, "release": r.Release, "arch": r.Arch})
 	if err != nil {
-		return err
-	}
-	defer fd.Close()
-	h := sha256.New()
-	w := io.MultiWriter(fd, h)
-	if err := r.Write(w); err != nil {
-		return err
+		return "", err
 	}
-	hashPrint(h, rpmPackageName)
-	return nil
+	return b.WriteArtifact(ctx, rpmPackageName, 0644, func(w io.Writer) error {
+		return r.Write(ctx, w, b.destinationPath(""))
+	})
 }
@@ -0,0 +1,361 @@
+package barrow
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/google/rpmpack"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const (
+	rpmTagSignatures    = 62 // region of the signature header
+	rpmTagImmutable     = 63 // region of the main header
+	rpmTagSize          = 1009
+	rpmTagLongSize      = 5009
+	rpmTagPayloadDigest = 5092
+	// signature tags
+	rpmSigSize            = 1000
+	rpmSigPayloadSize     = 1007
+	rpmSigLongSize        = 270
+	rpmSigLongArchiveSize = 271
+	rpmSigSHA256          = 273
+	// header types
+	rpmTypeChar   = 1
+	rpmTypeInt8   = 2
+	rpmTypeBinary = 7
+)
+
+// rpmTypeAlign: integers are aligned to their size in the header store
+var rpmTypeAlign = map[int]int{rpmTypeInt16: 2, rpmTypeInt32: 4, rpmTypeInt64: 8}
+
+// rpmEntry: a file of the rpm, regular files with a Source are read from disk while the payload is written
+type rpmEntry struct {
+	rpmpack.RPMFile
+	Source string
+}
+
+// rpmBuilder streams the payload into a spool file, rpmpack only writes the lead and the headers.
+// Peak memory no longer depends on the size of the packaged files.
+type rpmBuilder struct {
+	*rpmpack.RPM
+	entries map[string]*rpmEntry
+	c       *compressionSpec
+}
+
+func newRPMBuilder(m rpmpack.RPMMetaData, c *compressionSpec) (*rpmBuilder, error) {
+	// rpmpack compresses only an empty payload, the level belongs to our compressor
+	m.Compressor = c.Method
+	r, err := rpmpack.NewRPM(m)
+	if err != nil {
+		return nil, err
+	}
+	return &rpmBuilder{RPM: r, entries: make(map[string]*rpmEntry), c: c}, nil
+}
+
+// AddFile adds a file whose body is in memory: symlinks, generated units
+func (r *rpmBuilder) AddFile(f rpmpack.RPMFile) {
+	if f.Name == "/" {
+		return
+	}
+	r.entries[f.Name] = &rpmEntry{RPMFile: f}
+}
+
+// AddSource adds a regular file read from source when the payload is written
+func (r *rpmBuilder) AddSource(f rpmpack.RPMFile, source string) {
+	if f.Name == "/" {
+		return
+	}
+	r.entries[f.Name] = &rpmEntry{RPMFile: f, Source: source}
+}
+
+func (r *rpmBuilder) compressor() (FnCompressor, error) {
+	switch r.c.Method {
+	case "gzip":
+		c := *r.c
+		if c.Level == -1 {
+			c.Level = 9 // rpmpack default
+		}
+		return c.gzipWriter, nil
+	case "zstd":
+		return r.c.zstdWriter, nil
+	case "xz":
+		return r.c.xzWriter, nil
+	case "lzma":
+		return func(w io.Writer) (io.WriteCloser, error) {
+			return lzma.NewWriter(w)
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported rpm compression '%s'", r.c.Method)
+}
+
+// writeEntry writes one cpio member, returns size and digest for the file indexes
+func (r *rpmBuilder) writeEntry(ctx context.Context, cw *cpio.Writer, e *rpmEntry) (uint32, string, error) {
+	hdr := &cpio.Header{Name: e.Name, Mode: cpio.FileMode(e.Mode), Links: 1}
+	switch {
+	case e.Mode&040000 != 0: // directory
+		hdr.Links = 2
+		return 4096, "", cw.WriteHeader(hdr)
+	case e.Mode&tagLink == tagLink:
+		hdr.Size = int64(len(e.Body))
+		if err := cw.WriteHeader(hdr); err != nil {
+			return 0, "", err
+		}
+		_, err := cw.Write(e.Body)
+		return uint32(len(e.Body)), "", err
+	}
+	hdr.Mode |= 0100000
+	var src io.Reader = bytes.NewReader(e.Body)
+	hdr.Size = int64(len(e.Body))
+	if len(e.Source) != 0 {
+		fd, err := os.Open(e.Source)
+		if err != nil {
+			return 0, "", err
+		}
+		defer fd.Close()
+		si, err := fd.Stat()
+		if err != nil {
+			return 0, "", err
+		}
+		src, hdr.Size = fd, si.Size()
+	}
+	if hdr.Size > 1<<32-1 {
+		return 0, "", fmt.Errorf("%s: files over 4 GiB are not supported", e.Name)
+	}
+	if err := cw.WriteHeader(hdr); err != nil {
+		return 0, "", err
+	}
+	h := sha256.New()
+	n, err := copyContext(ctx, io.MultiWriter(cw, h), src)
+	if err != nil {
+		return 0, "", err
+	}
+	if n != hdr.Size {
+		return 0, "", fmt.Errorf("%s: size changed while packaging", e.Name)
+	}
+	return uint32(n), hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// spool writes the compressed cpio payload into fd, in the order rpmpack writes the file indexes
+func (r *rpmBuilder) spool(ctx context.Context, fd *os.File) (payloadSize int64, err error) {
+	newCompressor, err := r.compressor()
+	if err != nil {
+		return 0, err
+	}
+	ph := sha256.New()
+	zw, err := newCompressor(io.MultiWriter(fd, ph))
+	if err != nil {
+		return 0, err
+	}
+	cw := cpio.NewWriter(zw)
+	names := make([]string, 0, len(r.entries))
+	for name := range r.entries {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	sizes := make([]uint32, 0, len(names))
+	digests := make([]string, 0, len(names))
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			_ = zw.Close()
+			return 0, err
+		}
+		e := r.entries[name]
+		size, digest, err := r.writeEntry(ctx, cw, e)
+		if err != nil {
+			_ = zw.Close()
+			return 0, fmt.Errorf("failed to write file %q: %w", name, err)
+		}
+		if e.Mode&040000 == 0 {
+			payloadSize += int64(size)
+		}
+		sizes = append(sizes, size)
+		digests = append(digests, digest)
+		// the body of regular files stays out of rpmpack, the indexes are overwritten below
+		f := e.RPMFile
+		if f.Mode&tagLink != tagLink {
+			f.Body = nil
+		}
+		r.RPM.AddFile(f)
+	}
+	if err := cw.Close(); err != nil {
+		_ = zw.Close()
+		return 0, err
+	}
+	if err := zw.Close(); err != nil {
+		return 0, err
+	}
+	if len(names) != 0 {
+		r.AddCustomTag(rpmTagFileSizes, rpmpack.EntryUint32(sizes))
+		r.AddCustomTag(rpmTagFileDigests, rpmpack.EntryStringSlice(digests))
+	}
+	r.AddCustomTag(rpmTagPayloadDigest, rpmpack.EntryStringSlice([]string{hex.EncodeToString(ph.Sum(nil))}))
+	return payloadSize, nil
+}
+
+// rpmValue: type, count and store bytes of a header entry
+type rpmValue struct {
+	typ   int
+	count int
+	data  []byte
+}
+
+// values returns the entries of h without its region tag
+func (h *rpmHeader) values() (map[int]*rpmValue, error) {
+	values := make(map[int]*rpmValue, len(h.entries))
+	for tag, e := range h.entries {
+		if tag == rpmTagSignatures || tag == rpmTagImmutable {
+			continue
+		}
+		b := h.store[e.offset:]
+		var size int
+		switch e.typ {
+		case rpmTypeChar, rpmTypeInt8, rpmTypeBinary:
+			size = e.count
+		case rpmTypeInt16:
+			size = 2 * e.count
+		case rpmTypeInt32:
+			size = 4 * e.count
+		case rpmTypeInt64:
+			size = 8 * e.count
+		case rpmTypeString, rpmTypeStringArray, rpmTypeI18NString:
+			for range e.count {
+				i := bytes.IndexByte(b[size:], 0)
+				if i == -1 {
+					return nil, fmt.Errorf("rpm tag %d: unterminated string", tag)
+				}
+				size += i + 1
+			}
+		default:
+			return nil, fmt.Errorf("rpm tag %d: unsupported type %d", tag, e.typ)
+		}
+		if size > len(b) {
+			return nil, fmt.Errorf("rpm tag %d out of range", tag)
+		}
+		values[tag] = &rpmValue{typ: e.typ, count: e.count, data: b[:size]}
+	}
+	return values, nil
+}
+
+// encodeRPMHeader writes values sorted by tag after the region entry, integers aligned to their size
+func encodeRPMHeader(region int, values map[int]*rpmValue) []byte {
+	tags := slices.Sorted(maps.Keys(values))
+	var store bytes.Buffer
+	offsets := make([]int, len(tags))
+	for i, tag := range tags {
+		v := values[tag]
+		if align := rpmTypeAlign[v.typ]; align != 0 && store.Len()%align != 0 {
+			store.Write(make([]byte, align-store.Len()%align))
+		}
+		offsets[i] = store.Len()
+		store.Write(v.data)
+	}
+	count := len(tags) + 1
+	// the region trailer is an index entry whose negative offset covers every index entry
+	regionOffset := store.Len()
+	_ = binary.Write(&store, binary.BigEndian, []int32{int32(region), rpmTypeBinary, -int32(16 * count), 16})
+	var b bytes.Buffer
+	b.Write(rpmHeaderMagic)
+	_ = binary.Write(&b, binary.BigEndian, []int32{0, int32(count), int32(store.Len())})
+	_ = binary.Write(&b, binary.BigEndian, []int32{int32(region), rpmTypeBinary, int32(regionOffset), 16})
+	for i, tag := range tags {
+		v := values[tag]
+		_ = binary.Write(&b, binary.BigEndian, []int32{int32(tag), int32(v.typ), int32(offsets[i]), int32(v.count)})
+	}
+	b.Write(store.Bytes())
+	return b.Bytes()
+}
+
+// setRPMSize sets tag to size, or longTag when size overflows an int32 as rpm does for packages over 2 GiB
+func setRPMSize(values map[int]*rpmValue, tag, longTag int, size int64) {
+	if size > math.MaxInt32 {
+		delete(values, tag)
+		values[longTag] = &rpmValue{typ: rpmTypeInt64, count: 1, data: binary.BigEndian.AppendUint64(nil, uint64(size))}
+		return
+	}
+	delete(values, longTag)
+	values[tag] = &rpmValue{typ: rpmTypeInt32, count: 1, data: binary.BigEndian.AppendUint32(nil, uint32(size))}
+}
+
+// rewriteRPMHeaders: rpmpack sized and signed its own empty payload, head is its lead and headers.
+// Returns lead, signature and main header describing the spooled payload
+func rewriteRPMHeaders(head []byte, payloadSize, compressedSize int64) ([]byte, error) {
+	if len(head) < rpmLeadSize {
+		return nil, fmt.Errorf("rpm lead too short")
+	}
+	r := bytes.NewReader(head[rpmLeadSize:])
+	sig, err := readRPMHeader(r, true)
+	if err != nil {
+		return nil, fmt.Errorf("read signature header error: %w", err)
+	}
+	h, err := readRPMHeader(r, false)
+	if err != nil {
+		return nil, fmt.Errorf("read header error: %w", err)
+	}
+	hv, err := h.values()
+	if err != nil {
+		return nil, err
+	}
+	setRPMSize(hv, rpmTagSize, rpmTagLongSize, payloadSize)
+	hb := encodeRPMHeader(rpmTagImmutable, hv)
+	sv, err := sig.values()
+	if err != nil {
+		return nil, err
+	}
+	setRPMSize(sv, rpmSigSize, rpmSigLongSize, int64(len(hb))+compressedSize)
+	setRPMSize(sv, rpmSigPayloadSize, rpmSigLongArchiveSize, payloadSize)
+	sum := sha256.Sum256(hb)
+	sv[rpmSigSHA256] = &rpmValue{typ: rpmTypeString, count: 1, data: append([]byte(hex.EncodeToString(sum[:])), 0)}
+	sb := encodeRPMHeader(rpmTagSignatures, sv)
+	b := make([]byte, 0, rpmLeadSize+len(sb)+7+len(hb))
+	b = append(b, head[:rpmLeadSize]...)
+	b = append(b, sb...)
+	b = append(b, make([]byte, (8-len(sb)%8)%8)...)
+	return append(b, hb...), nil
+}
+
+// Write spools the payload in dir, then writes lead, headers and payload to w
+func (r *rpmBuilder) Write(ctx context.Context, w io.Writer, dir string) error {
+	fd, err := os.CreateTemp(dir, ".bali-rpm-payload-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fd.Close()
+		_ = os.Remove(fd.Name())
+	}()
+	payloadSize, err := r.spool(ctx, fd)
+	if err != nil {
+		return err
+	}
+	compressedSize, err := fd.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	var head bytes.Buffer
+	if err := r.RPM.Write(&head); err != nil {
+		return err
+	}
+	b, err := rewriteRPMHeaders(head.Bytes(), payloadSize, compressedSize)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, fd)
+	return err
+}
@@ -0,0 +1,156 @@
+package barrow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cavaliergopher/cpio"
+	"github.com/google/rpmpack"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+func TestRPMPayload(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	jack, err := os.ReadFile(filepath.Join(b.Out, "bin/jack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, method := range []string{"gzip", "zstd:3", "xz", "lzma"} {
+		b.Compression = method
+		artifact, err := b.rpm(context.Background(), p, crates)
+		if err != nil {
+			t.Fatalf("pack rpm %s error: %v", method, err)
+		}
+		if _, err := b.Verify(context.Background(), artifact); err != nil {
+			t.Fatalf("verify rpm %s error: %v", method, err)
+		}
+		fd, err := os.Open(artifact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fd.Close()
+		if _, err := fd.Seek(rpmLeadSize, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		sig, err := readRPMHeader(fd, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headerStart, _ := fd.Seek(0, io.SeekCurrent)
+		h, err := readRPMHeader(fd, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloadStart, _ := fd.Seek(0, io.SeekCurrent)
+		ph := sha256.New()
+		if _, err := io.Copy(ph, fd); err != nil {
+			t.Fatal(err)
+		}
+		if digest := h.strings(rpmTagPayloadDigest); len(digest) != 1 || digest[0] != hex.EncodeToString(ph.Sum(nil)) {
+			t.Fatalf("%s: payload digest mismatch", method)
+		}
+		if _, err := fd.Seek(payloadStart, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		si, _ := fd.Stat()
+		if size := sig.ints(rpmSigSize); len(size) != 1 || size[0] != si.Size()-headerStart {
+			t.Fatalf("%s: signature size %v, expected %d", method, size, si.Size()-headerStart)
+		}
+		var zr io.Reader
+		if method == "lzma" {
+			if zr, err = lzma.NewReader(fd); err != nil {
+				t.Fatal(err)
+			}
+		} else if zr, err = newDecompressor(bufio.NewReader(fd), method, false); err != nil {
+			t.Fatal(err)
+		}
+		cr := cpio.NewReader(zr)
+		var found bool
+		for {
+			hdr, err := cr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: read payload error: %v", method, err)
+			}
+			if hdr.Name != "/usr/local/bin/jack" {
+				continue
+			}
+			body, err := io.ReadAll(cr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			found = bytes.Equal(body, jack)
+		}
+		if !found {
+			t.Fatalf("%s: payload does not contain the crate", method)
+		}
+	}
+}
+
+func TestRewriteRPMHeaders(t *testing.T) {
+	r, err := rpmpack.NewRPM(rpmpack.RPMMetaData{Name: "jack", Version: "1.2.3", Arch: "x86_64", Compressor: "gzip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddFile(rpmpack.RPMFile{Name: "/usr/bin/jack", Mode: 0100755})
+	var rpm bytes.Buffer
+	if err := r.Write(&rpm); err != nil {
+		t.Fatal(err)
+	}
+	// the sizes of its own payload: rewriting reproduces the headers of rpmpack
+	fd := bytes.NewReader(rpm.Bytes()[rpmLeadSize:])
+	if _, err := readRPMHeader(fd, true); err != nil {
+		t.Fatal(err)
+	}
+	h, err := readRPMHeader(fd, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := rpm.Bytes()[:rpm.Len()-fd.Len()]
+	b, err := rewriteRPMHeaders(head, h.ints(rpmTagSize)[0], int64(fd.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, head) {
+		t.Fatalf("rewritten headers differ from rpmpack:\n%x\n%x", b, head)
+	}
+	// payloads over 2 GiB
+	const payloadSize, compressedSize = 3 << 30, 5 << 30
+	if b, err = rewriteRPMHeaders(head, payloadSize, compressedSize); err != nil {
+		t.Fatal(err)
+	}
+	fd = bytes.NewReader(b[rpmLeadSize:])
+	sig, err := readRPMHeader(fd, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hb := b[len(b)-fd.Len():]
+	if h, err = readRPMHeader(fd, false); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(hb)
+	if size := h.ints(rpmTagLongSize); len(size) != 1 || size[0] != payloadSize || h.ints(rpmTagSize) != nil {
+		t.Errorf("header size: %v %v", h.ints(rpmTagSize), size)
+	}
+	if size := sig.ints(rpmSigLongSize); len(size) != 1 || size[0] != int64(len(hb))+compressedSize || sig.ints(rpmSigSize) != nil {
+		t.Errorf("signature size: %v %v", sig.ints(rpmSigSize), size)
+	}
+	if size := sig.ints(rpmSigLongArchiveSize); len(size) != 1 || size[0] != payloadSize || sig.ints(rpmSigPayloadSize) != nil {
+		t.Errorf("signature archive size: %v %v", sig.ints(rpmSigPayloadSize), size)
+	}
+	if digest := sig.strings(rpmSigSHA256); len(digest) != 1 || digest[0] != hex.EncodeToString(sum[:]) {
+		t.Errorf("signature header digest: %v", digest)
+	}
+	if e := h.entries[rpmTagLongSize]; e.offset%8 != 0 {
+		t.Errorf("int64 tag offset %d is not aligned", e.offset)
+	}
+}
@@ -0,0 +1,108 @@
+package barrow
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"path"
+	"strings"
+)
+
+type ScoopConfig struct {
+	Bin       []string `toml:"bin,omitempty"`       // executables added to PATH, relative to the archive root, default: crates
+	Persist   []string `toml:"persist,omitempty"`   // files and directories kept across updates
+	Shortcuts bool     `toml:"shortcuts,omitempty"` // add the [[exe.shortcuts]] to the Start menu
+}
+
+type scoopArchitecture struct {
+	URL        string `json:"url"`
+	Hash       string `json:"hash"`
+	ExtractDir string `json:"extract_dir,omitempty"`
+}
+
+// scoopManifest: field order follows the Scoop app manifest documentation
+type scoopManifest struct {
+	Version      string                        `json:"version"`
+	Description  string                        `json:"description,omitempty"`
+	Homepage     string                        `json:"homepage,omitempty"`
+	License      string                        `json:"license,omitempty"`
+	Architecture map[string]*scoopArchitecture `json:"architecture"`
+	Bin          []string                      `json:"bin,omitempty"`
+	Shortcuts    [][]string                    `json:"shortcuts,omitempty"`
+	Persist      []string                      `json:"persist,omitempty"`
+}
+
+var (
+	scoopArchs = map[string]string{
+		"amd64": "64bit",
+		"386":   "32bit",
+		"arm64": "arm64",
+	}
+)
+
+func (b *BarrowCtx) scoopManifest(p *Package, crates []*Crate, archives []*releaseArchive) *scoopManifest {
+	cfg := p.Scoop
+	if cfg == nil {
+		cfg = &ScoopConfig{}
+	}
+	m := &scoopManifest{
+		Version:      p.Version,
+		Description:  p.Summary,
+		Homepage:     p.Homepage,
+		License:      p.License,
+		Architecture: make(map[string]*scoopArchitecture),
+		Persist:      cfg.Persist,
+	}
+	for _, a := range archives {
+		arch, ok := scoopArchs[a.Arch]
+		if !ok {
+			continue
+		}
+		m.Architecture[arch] = &scoopArchitecture{
+			URL:  a.URL,
+			Hash: a.SHA256,
+			// zip archives keep the package layout below name-version-target-arch
+			ExtractDir: strings.TrimSuffix(a.Name, path.Ext(a.Name)),
+		}
+	}
+	m.Bin = cfg.Bin
+	if len(m.Bin) == 0 {
+		for _, crate := range crates {
+			m.Bin = append(m.Bin, path.Join(ToNixPath(crate.Destination), crate.Name+".exe"))
+		}
+	}
+	if cfg.Shortcuts && p.Exe != nil {
+		for _, s := range p.Exe.Shortcuts {
+			m.Shortcuts = append(m.Shortcuts, []string{AsRelativePath(s.Target), s.Name})
+		}
+	}
+	return m
+}
+
+// scoop writes the Scoop app manifest <name>.json for the windows zip archives in Destination
+func (b *BarrowCtx) scoop(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	archives, err := b.releaseArchives(p, []string{"windows"}, []string{".zip"})
+	if err != nil {
+		return "", err
+	}
+	for _, a := range archives {
+		b.stage("scoop", "%s/%s --> %s", a.Target, a.Arch, a.URL)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(b.scoopManifest(p, crates, archives)); err != nil {
+		return "", err
+	}
+	name, err := b.ArtifactName("scoop", p, nil)
+	if err != nil {
+		return "", err
+	}
+	return b.writeManifest(ctx, name, buf.Bytes())
+}
@@ -0,0 +1,227 @@
+package barrow
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/rpmpack"
+	"github.com/goreleaser/nfpm/v2"
+	"github.com/goreleaser/nfpm/v2/files"
+)
+
+// ServiceConfig: [service] in crate.toml, the crate runs as a systemd service
+type ServiceConfig struct {
+	Name             string            `toml:"name,omitempty"`        // unit name without .service, default: crate name
+	Description      string            `toml:"description,omitempty"` // default: crate description
+	ExecStart        string            `toml:"exec-start,omitempty"`  // default: the installed crate
+	User             string            `toml:"user,omitempty"`
+	Group            string            `toml:"group,omitempty"`
+	Restart          string            `toml:"restart,omitempty"` // default: on-failure
+	Environment      map[string]string `toml:"environment,omitempty"`
+	WorkingDirectory string            `toml:"working-directory,omitempty"`
+	After            []string          `toml:"after,omitempty"`     // default: network.target
+	WantedBy         string            `toml:"wanted-by,omitempty"` // default: multi-user.target
+}
+
+// serviceUnit: a generated systemd unit
+type serviceUnit struct {
+	Name    string // jack.service
+	Content string
+	ModTime time.Time
+}
+
+// systemdUnitDir: where the distribution keeps units shipped by packages
+func systemdUnitDir(format string) string {
+	if format == "deb" {
+		return "/lib/systemd/system"
+	}
+	return "/usr/lib/systemd/system"
+}
+
+// systemdQuote: quote a value with spaces or quotes for an assignment
+func systemdQuote(s string) string {
+	if !strings.ContainsAny(s, " \t\"'\\") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (b *BarrowCtx) serviceUnit(p *Package, crate *Crate) *serviceUnit {
+	s := crate.Service
+	execStart := s.ExecStart
+	if len(execStart) == 0 {
+		execStart = path.Join("/", ToNixPath(p.Prefix), ToNixPath(crate.Destination), crate.Name)
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[Unit]\nDescription=%s\n", nonEmpty(s.Description, nonEmpty(crate.Description, crate.Name)))
+	if len(p.Homepage) != 0 {
+		fmt.Fprintf(&sb, "Documentation=%s\n", p.Homepage)
+	}
+	after := s.After
+	if len(after) == 0 {
+		after = []string{"network.target"}
+	}
+	fmt.Fprintf(&sb, "After=%s\n\n[Service]\nType=simple\nExecStart=%s\n", strings.Join(after, " "), execStart)
+	for _, kv := range [][2]string{{"User", s.User}, {"Group", s.Group}, {"WorkingDirectory", s.WorkingDirectory}} {
+		if len(kv[1]) != 0 {
+			fmt.Fprintf(&sb, "%s=%s\n", kv[0], kv[1])
+		}
+	}
+	keys := make([]string, 0, len(s.Environment))
+	for k := range s.Environment {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		fmt.Fprintf(&sb, "Environment=%s\n", systemdQuote(k+"="+s.Environment[k]))
+	}
+	fmt.Fprintf(&sb, "Restart=%s\n\n[Install]\nWantedBy=%s\n", nonEmpty(s.Restart, "on-failure"), nonEmpty(s.WantedBy, "multi-user.target"))
+	return &serviceUnit{Name: nonEmpty(s.Name, crate.Name) + ".service", Content: sb.String(), ModTime: b.unitModTime(crate)}
+}
+
+// unitModTime: SOURCE_DATE_EPOCH when set, otherwise the mtime of the compiled crate, repeated builds produce the same unit
+func (b *BarrowCtx) unitModTime(crate *Crate) time.Time {
+	if epoch, err := strconv.ParseInt(b.Getenv("SOURCE_DATE_EPOCH"), 10, 64); err == nil {
+		return time.Unix(epoch, 0)
+	}
+	si, err := os.Stat(filepath.Join(b.Out, crate.Destination, b.basename(crate.Name)))
+	if err != nil {
+		// not compiled, staging the crate fails
+		return time.Unix(0, 0)
+	}
+	return si.ModTime()
+}
+
+func (b *BarrowCtx) serviceUnits(p *Package, crates []*Crate) []*serviceUnit {
+	var units []*serviceUnit
+	for _, crate := range crates {
+		if crate.Service != nil {
+			units = append(units, b.serviceUnit(p, crate))
+		}
+	}
+	return units
+}
+
+// serviceScripts: daemon-reload/enable on install, stop/disable on removal, restart on upgrade
+type serviceScripts struct {
+	PostInstall string
+	PreRemove   string
+	PostRemove  string
+	PostUpgrade string // arch only
+}
+
+func newServiceScripts(format string, units []*serviceUnit) *serviceScripts {
+	names := make([]string, 0, len(units))
+	for _, u := range units {
+		names = append(names, u.Name)
+	}
+	list := strings.Join(names, " ")
+	const guard = "if [ -d /run/systemd/system ]; then\n"
+	reload := "  systemctl daemon-reload >/dev/null 2>&1 || :\n"
+	enable := fmt.Sprintf("  systemctl enable %s >/dev/null 2>&1 || :\n", list)
+	stop := fmt.Sprintf("  systemctl --no-reload disable --now %s >/dev/null 2>&1 || :\n", list)
+	restart := fmt.Sprintf("  systemctl try-restart %s >/dev/null 2>&1 || :\n", list)
+	s := &serviceScripts{}
+	switch format {
+	case "rpm":
+		// $1: number of installed instances after the transaction
+		s.PostInstall = guard + reload + "  if [ $1 -eq 1 ]; then\n  " + enable + "  fi\nfi\n"
+		s.PreRemove = "if [ $1 -eq 0 ] && [ -d /run/systemd/system ]; then\n" + stop + "fi\n"
+		s.PostRemove = guard + reload + "  if [ $1 -ge 1 ]; then\n  " + restart + "  fi\nfi\n"
+	case "deb":
+		s.PostInstall = "#!/bin/sh\nset -e\nif [ \"$1\" = \"configure\" ] && [ -d /run/systemd/system ]; then\n" + reload + enable + "  if [ -n \"$2\" ]; then\n  " + restart + "  fi\nfi\n"
+		s.PreRemove = "#!/bin/sh\nset -e\nif [ \"$1\" = \"remove\" ] && [ -d /run/systemd/system ]; then\n" + stop + "fi\n"
+		s.PostRemove = "#!/bin/sh\nset -e\nif [ -d /run/systemd/system ]; then\n" + reload + "fi\n"
+	default:
+		// arch: bodies of the .INSTALL functions
+		s.PostInstall = guard + reload + enable + "fi\n"
+		s.PreRemove = guard + stop + "fi\n"
+		s.PostRemove = guard + reload + "fi\n"
+		s.PostUpgrade = guard + reload + restart + "fi\n"
+	}
+	return s
+}
+
+func (b *BarrowCtx) addServices2RPM(r *rpmBuilder, p *Package, crates []*Crate) {
+	units := b.serviceUnits(p, crates)
+	if len(units) == 0 {
+		return
+	}
+	for _, u := range units {
+		b.stage("service", "%s --> %s", u.Name, path.Join(systemdUnitDir("rpm"), u.Name))
+		r.AddFile(rpmpack.RPMFile{
+			Name:  path.Join(systemdUnitDir("rpm"), u.Name),
+			Body:  []byte(u.Content),
+			Mode:  0644,
+			Group: "root",
+			Owner: "root",
+			MTime: uint32(u.ModTime.Unix()),
+		})
+	}
+	s := newServiceScripts("rpm", units)
+	r.AddPostin(s.PostInstall)
+	r.AddPreun(s.PreRemove)
+	r.AddPostun(s.PostRemove)
+}
+
+// addServices2Nfpm stages the units and scriptlets in a temporary directory, nfpm reads them while packaging
+func (b *BarrowCtx) addServices2Nfpm(info *nfpm.Info, p *Package, crates []*Crate, format string) (func(), error) {
+	units := b.serviceUnits(p, crates)
+	if len(units) == 0 {
+		return func() {}, nil
+	}
+	dir, err := os.MkdirTemp("", "bali-service-")
+	if err != nil {
+		return nil, err
+	}
+	cleanup := func() {
+		_ = os.RemoveAll(dir)
+	}
+	write := func(name, content string, mode os.FileMode) (string, error) {
+		saveTo := filepath.Join(dir, name)
+		return saveTo, os.WriteFile(saveTo, []byte(content), mode)
+	}
+	for _, u := range units {
+		source, err := write(u.Name, u.Content, 0644)
+		if err != nil {
+			cleanup()
+			return nil, err
+		}
+		b.stage("service", "%s --> %s", u.Name, path.Join(systemdUnitDir(format), u.Name))
+		info.Contents = append(info.Contents, &files.Content{
+			Source:      source,
+			Destination: path.Join(systemdUnitDir(format), u.Name),
+			FileInfo: &files.ContentFileInfo{
+				Owner: "root",
+				Group: "root",
+				Mode:  0644,
+				MTime: u.ModTime,
+			},
+		})
+	}
+	s := newServiceScripts(format, units)
+	for _, script := range []struct {
+		name, content string
+		saveTo        *string
+	}{
+		{"postinstall", s.PostInstall, &info.Scripts.PostInstall},
+		{"preremove", s.PreRemove, &info.Scripts.PreRemove},
+		{"postremove", s.PostRemove, &info.Scripts.PostRemove},
+		{"postupgrade", s.PostUpgrade, &info.ArchLinux.Scripts.PostUpgrade},
+	} {
+		if len(script.content) == 0 {
+			continue
+		}
+		if *script.saveTo, err = write(script.name, script.content, 0755); err != nil {
+			cleanup()
+			return nil, err
+		}
+	}
+	return cleanup, nil
+}
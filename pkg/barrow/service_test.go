@@ -0,0 +1,120 @@
+package barrow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServiceUnit(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	p.Homepage = "https://example.com/jack"
+	crates[0].Service = &ServiceConfig{
+		User:        "jack",
+		Environment: map[string]string{"JACK_HOME": "/var/lib/jack", "JACK_OPTS": "-v --color"},
+	}
+	u := b.serviceUnit(p, crates[0])
+	if u.Name != "jack.service" {
+		t.Fatalf("unit name %s", u.Name)
+	}
+	want := `[Unit]
+Description=jack
+Documentation=https://example.com/jack
+After=network.target
+
+[Service]
+Type=simple
+ExecStart=/usr/local/bin/jack
+User=jack
+Environment=JACK_HOME=/var/lib/jack
+Environment="JACK_OPTS=-v --color"
+Restart=on-failure
+
+[Install]
+WantedBy=multi-user.target
+`
+	if u.Content != want {
+		t.Errorf("unit:\n%s\nwant:\n%s", u.Content, want)
+	}
+	crates[0].Service = &ServiceConfig{Name: "jackd", ExecStart: "/usr/local/bin/jack serve", Restart: "always"}
+	if u := b.serviceUnit(p, crates[0]); u.Name != "jackd.service" ||
+		!strings.Contains(u.Content, "ExecStart=/usr/local/bin/jack serve\n") || !strings.Contains(u.Content, "Restart=always\n") {
+		t.Errorf("unit %s:\n%s", u.Name, u.Content)
+	}
+	si, err := os.Stat(filepath.Join(b.Out, "bin/jack"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := b.serviceUnit(p, crates[0]); !u.ModTime.Equal(si.ModTime()) {
+		t.Errorf("unit mtime %v, crate mtime %v", u.ModTime, si.ModTime())
+	}
+	b.extraEnv["SOURCE_DATE_EPOCH"] = "1700000000"
+	if u := b.serviceUnit(p, crates[0]); u.ModTime.Unix() != 1700000000 {
+		t.Errorf("unit mtime %v ignores SOURCE_DATE_EPOCH", u.ModTime)
+	}
+}
+
+func TestServiceScripts(t *testing.T) {
+	units := []*serviceUnit{{Name: "jack.service"}}
+	rpm := newServiceScripts("rpm", units)
+	if !strings.Contains(rpm.PostInstall, "if [ $1 -eq 1 ]; then\n    systemctl enable jack.service") ||
+		!strings.HasPrefix(rpm.PreRemove, "if [ $1 -eq 0 ]") || !strings.Contains(rpm.PostRemove, "try-restart jack.service") {
+		t.Errorf("rpm scriptlets: %+v", rpm)
+	}
+	deb := newServiceScripts("deb", units)
+	for _, script := range []string{deb.PostInstall, deb.PreRemove, deb.PostRemove} {
+		if !strings.HasPrefix(script, "#!/bin/sh\nset -e\n") {
+			t.Errorf("deb maintainer script:\n%s", script)
+		}
+	}
+	arch := newServiceScripts("arch", units)
+	if strings.HasPrefix(arch.PostInstall, "#!") || len(arch.PostUpgrade) == 0 {
+		t.Errorf("arch install functions: %+v", arch)
+	}
+}
+
+func TestServicePackages(t *testing.T) {
+	b, p, _ := newTestModule(t)
+	// Verify loads the crates again
+	crateFile := filepath.Join(b.CWD, "cmd/jack/crate.toml")
+	fd, err := os.OpenFile(crateFile, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fd.WriteString("\n[service]\nuser = \"jack\"\n")
+	_ = fd.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	crate, err := b.LoadCrate("cmd/jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crate.Service == nil || crate.Service.User != "jack" {
+		t.Fatalf("crate service: %+v", crate.Service)
+	}
+	crates := []*Crate{crate}
+	ctx := context.Background()
+	for format, pack := range map[string]func(context.Context, *Package, []*Crate) (string, error){
+		"rpm":  b.rpm,
+		"deb":  b.deb,
+		"arch": b.archLinux,
+	} {
+		artifact, err := pack(ctx, p, crates)
+		if err != nil {
+			t.Fatalf("pack %s error: %v", format, err)
+		}
+		r, err := b.Verify(ctx, artifact)
+		if err != nil {
+			t.Fatalf("verify %s error: %v", format, err)
+		}
+		if !r.OK() {
+			t.Errorf("verify %s: %v", format, r.Problems)
+		}
+		if r.Artifact.Lookup(strings.TrimPrefix(systemdUnitDir(format), "/")+"/jack.service") == nil {
+			t.Errorf("%s: jack.service not installed", format)
+		}
+	}
+}
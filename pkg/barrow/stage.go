@@ -0,0 +1,111 @@
+package barrow
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// StagedFile: one entry of a package, [[include]] items, crates and their aliases
+type StagedFile struct {
+	Name    string      // path in the package, prefix included
+	Source  string      // file or directory on disk, empty for symlinks
+	Mode    fs.FileMode // type and permissions
+	ModTime time.Time
+	Size    int64
+	Link    string // symlink target relative to the directory of Name
+}
+
+// stagedName: path of an [[include]] item below prefix
+func (item *FileItem) stagedName(prefix string) string {
+	if len(item.Rename) != 0 {
+		return filepath.Join(prefix, item.Destination, item.Rename)
+	}
+	return filepath.Join(prefix, item.Destination, filepath.Base(item.Path))
+}
+
+// stageItem follows symlinks, permissions of bali.toml replace the mode of the file
+func (b *BarrowCtx) stageItem(item *FileItem, prefix string) (*StagedFile, error) {
+	itemPath := filepath.Join(b.CWD, item.Path)
+	si, err := os.Stat(itemPath)
+	if err != nil {
+		return nil, err
+	}
+	mode := si.Mode()
+	if len(item.Permissions) != 0 {
+		if m, err := strconv.ParseInt(item.Permissions, 8, 64); err == nil {
+			mode = mode&fs.ModeType | fs.FileMode(m)
+		}
+	}
+	return &StagedFile{Name: item.stagedName(prefix), Source: itemPath, Mode: mode, ModTime: si.ModTime(), Size: si.Size()}, nil
+}
+
+// crateFiles: the crate and its aliases below prefix, without ModTime and Size
+func (b *BarrowCtx) crateFiles(crate *Crate, prefix string) ([]*StagedFile, error) {
+	baseName := b.basename(crate.Name)
+	nameInArchive := filepath.Join(prefix, crate.Destination, baseName)
+	files := []*StagedFile{{Name: nameInArchive, Source: filepath.Join(b.Out, crate.Destination, baseName), Mode: 0755}}
+	for _, a := range crate.Alias {
+		aliasExpend := filepath.Join(prefix, b.ExpandEnv(b.basename(a)))
+		aliasPath, err := filepath.Rel(filepath.Dir(aliasExpend), filepath.Dir(nameInArchive))
+		if err != nil {
+			return nil, err
+		}
+		aliasLink := filepath.Join(aliasPath, filepath.Base(nameInArchive))
+		files = append(files, &StagedFile{Name: aliasExpend, Mode: fs.ModeSymlink | 0777, Link: aliasLink})
+	}
+	return files, nil
+}
+
+func (b *BarrowCtx) stageCrate(crate *Crate, prefix string) ([]*StagedFile, error) {
+	files, err := b.crateFiles(crate, prefix)
+	if err != nil {
+		return nil, err
+	}
+	si, err := os.Stat(files[0].Source)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		f.ModTime = si.ModTime()
+	}
+	files[0].Size = si.Size()
+	return files, nil
+}
+
+// unixPerm: permission bits of tar and cpio headers, bali.toml permissions may carry setuid, setgid and sticky bits
+func unixPerm(mode fs.FileMode) int64 {
+	perm := int64(mode & 0o7777)
+	if mode&fs.ModeSetuid != 0 {
+		perm |= 0o4000
+	}
+	if mode&fs.ModeSetgid != 0 {
+		perm |= 0o2000
+	}
+	if mode&fs.ModeSticky != 0 {
+		perm |= 0o1000
+	}
+	return perm
+}
+
+// Stage lists the files of a package below prefix: [[include]] items, then each crate followed by its aliases
+func (b *BarrowCtx) Stage(p *Package, crates []*Crate, prefix string) ([]*StagedFile, error) {
+	staged := make([]*StagedFile, 0, len(p.Include)+len(crates))
+	for _, item := range p.Include {
+		f, err := b.stageItem(item, prefix)
+		if err != nil {
+			return nil, err
+		}
+		staged = append(staged, f)
+	}
+	for _, crate := range crates {
+		files, err := b.stageCrate(crate, prefix)
+		if err != nil {
+			return nil, err
+		}
+		staged = append(staged, files...)
+	}
+	return staged, nil
+}
@@ -2,121 +2,55 @@ package barrow
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"context"
-	"crypto/sha256"
 	"embed"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
-	"path/filepath"
-	"strconv"
-
-	"github.com/andybalholm/brotli"
-	"github.com/dsnet/compress/bzip2"
-	"github.com/klauspost/compress/zstd"
-	"github.com/ulikunitz/xz"
 )
 
-func (b *BarrowCtx) addItem2Tar(z *tar.Writer, item *FileItem, prefix string) error {
-	itemPath := filepath.Join(b.CWD, item.Path)
-	si, err := os.Stat(itemPath)
-	if err != nil {
-		return err
+func addStaged2Tar(ctx context.Context, z *tar.Writer, f *StagedFile) error {
+	hdr := &tar.Header{
+		Name:     AsExplicitRelativePath(f.Name),
+		Mode:     unixPerm(f.Mode),
+		ModTime:  f.ModTime,
+		Typeflag: tar.TypeReg,
+		Size:     f.Size,
 	}
-	var nameInArchive string
 	switch {
-	case len(item.Rename) != 0:
-		nameInArchive = filepath.Join(prefix, item.Destination, item.Rename)
-	default:
-		nameInArchive = filepath.Join(prefix, item.Destination, filepath.Base(item.Path))
-	}
-	hdr, err := tar.FileInfoHeader(si, "")
-	if err != nil {
-		return err
-	}
-	if len(item.Permissions) != 0 {
-		if m, err := strconv.ParseInt(item.Permissions, 8, 64); err == nil {
-			hdr.Mode = m
-		}
-	}
-	hdr.Name = AsExplicitRelativePath(nameInArchive)
-	if err = z.WriteHeader(hdr); err != nil {
+	case f.Mode&fs.ModeSymlink != 0:
+		hdr.Typeflag, hdr.Mode, hdr.Size = tar.TypeSymlink, 0, 0
+		hdr.Linkname = AsExplicitRelativePath(f.Link)
+		hdr.Format = tar.FormatGNU
+	case f.Mode.IsDir():
+		hdr.Typeflag, hdr.Size = tar.TypeDir, 0
+	}
+	if err := z.WriteHeader(hdr); err != nil {
 		return fmt.Errorf("write tar header error: %w", err)
 	}
-	if si.IsDir() {
-		return nil
-	}
 	if hdr.Typeflag != tar.TypeReg {
 		return nil
 	}
-	fd, err := os.Open(itemPath)
+	fd, err := os.Open(f.Source)
 	if err != nil {
 		return err
 	}
 	defer fd.Close()
-	if _, err := io.Copy(z, fd); err != nil {
+	if _, err := copyContext(ctx, z, fd); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (b *BarrowCtx) addCrate2Tar(z *tar.Writer, crate *Crate, prefix string) error {
-	baseName := b.basename(crate.Name)
-	out := filepath.Join(b.Out, crate.Destination, baseName)
-	si, err := os.Lstat(out)
-	if err != nil {
-		return err
-	}
-	nameInArchive := filepath.Join(prefix, crate.Destination, baseName)
-	hdr, err := tar.FileInfoHeader(si, "")
-	if err != nil {
-		return err
-	}
-	hdr.Name = AsExplicitRelativePath(nameInArchive)
-	hdr.Mode = 0755
-	if err = z.WriteHeader(hdr); err != nil {
-		return fmt.Errorf("write tar header error: %w", err)
-	}
-	fd, err := os.Open(out)
+func (b *BarrowCtx) tarInternal(ctx context.Context, p *Package, crates []*Crate, prefix string, w io.Writer) error {
+	staged, err := b.Stage(p, crates, prefix)
 	if err != nil {
 		return err
 	}
-	defer fd.Close()
-	if _, err := io.Copy(z, fd); err != nil {
-		return err
-	}
-	for _, a := range crate.Alias {
-		aliasExpend := filepath.Join(prefix, b.ExpandEnv(b.basename(a)))
-		aliasPath, err := filepath.Rel(filepath.Dir(aliasExpend), filepath.Dir(nameInArchive))
-		if err != nil {
-			return err
-		}
-		aliasLink := filepath.Join(aliasPath, filepath.Base(nameInArchive))
-		ah := &tar.Header{
-			Name:     AsExplicitRelativePath(aliasExpend),
-			Linkname: AsExplicitRelativePath(aliasLink),
-			Typeflag: tar.TypeSymlink,
-			Format:   tar.FormatGNU,
-			ModTime:  si.ModTime(),
-		}
-		if err = z.WriteHeader(ah); err != nil {
-			return fmt.Errorf("write tar header error: %w", err)
-		}
-	}
-	return nil
-}
-
-func (b *BarrowCtx) tarInternal(p *Package, crates []*Crate, prefix string, w io.Writer) error {
 	z := tar.NewWriter(w)
-	for _, item := range p.Include {
-		if err := b.addItem2Tar(z, item, prefix); err != nil {
-			_ = z.Close()
-			return err
-		}
-	}
-	for _, crate := range crates {
-		if err := b.addCrate2Tar(z, crate, prefix); err != nil {
+	for _, f := range staged {
+		if err := addStaged2Tar(ctx, z, f); err != nil {
 			_ = z.Close()
 			return err
 		}
@@ -127,134 +61,97 @@ func (b *BarrowCtx) tarInternal(p *Package, crates []*Crate, prefix string, w io
 //go:embed resources/template.sh
 var resources embed.FS
 
-func (b *BarrowCtx) sh(ctx context.Context, p *Package, crates []*Crate) error {
+func (b *BarrowCtx) sh(ctx context.Context, p *Package, crates []*Crate) (string, error) {
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return "", ctx.Err()
 	default:
 	}
-	newCompressor, _, err := tarCompressor(b.Compression)
+	c, err := b.formatCompression(p, "sh")
 	if err != nil {
-		return err
-	}
-	tarFileName := fmt.Sprintf("%s-%s-%s-%s.sh", p.Name, p.Version, b.Target, b.Arch)
-	var tarPath string
-	if filepath.IsAbs(b.Destination) {
-		tarPath = filepath.Join(b.Destination, tarFileName)
-	} else {
-		tarPath = filepath.Join(b.CWD, b.Destination, tarFileName)
+		return "", err
 	}
-	_ = os.MkdirAll(filepath.Dir(tarPath), 0755)
-	fd, err := os.OpenFile(tarPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	newCompressor, _, err := tarCompressor(c)
 	if err != nil {
-		return err
+		return "", err
 	}
-	h := sha256.New()
-	w := io.MultiWriter(fd, h)
-	rfd, err := resources.Open("resources/template.sh")
+	name, err := b.ArtifactName("sh", p, nil)
 	if err != nil {
-		return err
+		return "", err
 	}
-	if _, err := fd.ReadFrom(rfd); err != nil {
-		_ = fd.Close()
-		return err
-	}
-	cw, err := newCompressor(w)
-	if err != nil {
-		_ = fd.Close()
-		return err
-	}
-	if err := b.tarInternal(p, crates, "", cw); err != nil {
-		fmt.Fprintf(os.Stderr, "zip errpr: %d\n", err)
-		_ = cw.Close()
-		_ = fd.Close()
-		_ = os.RemoveAll(tarPath)
-		return err
-	}
-	if err := cw.Close(); err != nil {
-		_ = fd.Close()
-		_ = os.RemoveAll(tarPath)
-		return err
-	}
-	hashPrint(h, tarFileName)
-	return nil
+	return b.WriteArtifact(ctx, name, 0755, func(w io.Writer) error {
+		rfd, err := resources.Open("resources/template.sh")
+		if err != nil {
+			return err
+		}
+		defer rfd.Close()
+		if _, err := io.Copy(w, rfd); err != nil {
+			return err
+		}
+		cw, err := newCompressor(w)
+		if err != nil {
+			return err
+		}
+		if err := b.tarInternal(ctx, p, crates, "", cw); err != nil {
+			_ = cw.Close()
+			return err
+		}
+		return cw.Close()
+	})
 }
 
 type FnCompressor func(w io.Writer) (io.WriteCloser, error)
 
-func tarCompressor(method string) (FnCompressor, string, error) {
-	switch method {
+func tarCompressor(c *compressionSpec) (FnCompressor, string, error) {
+	switch c.Method {
 	case "zstd":
-		return func(w io.Writer) (io.WriteCloser, error) {
-			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
-		}, ".tar.zst", nil
+		return c.zstdWriter, ".tar.zst", nil
 	case "xz":
-		return func(w io.Writer) (io.WriteCloser, error) {
-			return xz.NewWriter(w)
-		}, ".tar.xz", nil
+		return c.xzWriter, ".tar.xz", nil
 	case "bzip2":
-		return func(w io.Writer) (io.WriteCloser, error) {
-			return bzip2.NewWriter(w, nil)
-		}, ".tar.bz2", nil
+		return c.bzip2Writer, ".tar.bz2", nil
 	case "brotli":
-		return func(w io.Writer) (io.WriteCloser, error) {
-			return brotli.NewWriter(w), nil
-		}, ".tar.br", nil
+		return c.brotliWriter, ".tar.br", nil
 	case "", "gzip":
-		return func(w io.Writer) (io.WriteCloser, error) {
-			return gzip.NewWriter(w), nil
-		}, ".tar.gz", nil
+		return c.gzipWriter, ".tar.gz", nil
 	case "none":
 		return func(w io.Writer) (io.WriteCloser, error) {
 			return &nopCloser{Writer: w}, nil
 		}, ".tar", nil
 	default:
-		return nil, "", fmt.Errorf("unsupported tar compress method '%s'", method)
+		return nil, "", fmt.Errorf("unsupported tar compress method '%s'", c.Method)
 	}
 }
 
-func (b *BarrowCtx) tar(ctx context.Context, p *Package, crates []*Crate) error {
+func (b *BarrowCtx) tar(ctx context.Context, p *Package, crates []*Crate) (string, error) {
 	select {
 	case <-ctx.Done():
-		return ctx.Err()
+		return "", ctx.Err()
 	default:
 	}
 
-	newCompressor, suffix, err := tarCompressor(b.Compression)
+	c, err := b.formatCompression(p, "tar")
 	if err != nil {
-		return err
-	}
-	tarPrefix := fmt.Sprintf("%s-%s-%s-%s", p.Name, p.Version, b.Target, b.Arch)
-	tarFileName := tarPrefix + suffix
-	var tarPath string
-	if filepath.IsAbs(b.Destination) {
-		tarPath = filepath.Join(b.Destination, tarFileName)
-	} else {
-		tarPath = filepath.Join(b.CWD, b.Destination, tarFileName)
+		return "", err
 	}
-	_ = os.MkdirAll(filepath.Dir(tarPath), 0755)
-	fd, err := os.Create(tarPath)
+	newCompressor, suffix, err := tarCompressor(c)
 	if err != nil {
-		return err
+		return "", err
 	}
-	h := sha256.New()
-	cw, err := newCompressor(io.MultiWriter(fd, h))
+	name, err := b.ArtifactName("tar", p, map[string]string{"ext": suffix})
 	if err != nil {
-		_ = fd.Close()
-		return err
+		return "", err
 	}
-	if err := b.tarInternal(p, crates, tarPrefix, cw); err != nil {
-		fmt.Fprintf(os.Stderr, "zip errpr: %d\n", err)
-		_ = cw.Close()
-		_ = fd.Close()
-		_ = os.RemoveAll(tarPath)
-		return err
-	}
-	if err := cw.Close(); err != nil {
-		_ = fd.Close()
-		_ = os.RemoveAll(tarPath)
-		return err
-	}
-	hashPrint(h, tarFileName)
-	return nil
+	tarPrefix := b.archivePrefix(p)
+	return b.WriteArtifact(ctx, name, 0644, func(w io.Writer) error {
+		cw, err := newCompressor(w)
+		if err != nil {
+			return err
+		}
+		if err := b.tarInternal(ctx, p, crates, tarPrefix, cw); err != nil {
+			_ = cw.Close()
+			return err
+		}
+		return cw.Close()
+	})
 }
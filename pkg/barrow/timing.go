@@ -0,0 +1,51 @@
+package barrow
+
+import "time"
+
+// timing: wall-clock time of one build step, printed by the summary at the end of Run
+type timing struct {
+	step    string // compile, include, pack
+	name    string
+	elapsed time.Duration
+}
+
+type timings struct {
+	start time.Time
+	steps []timing
+}
+
+func newTimings() *timings {
+	return &timings{start: time.Now()}
+}
+
+// record adds a step started at start, returns the elapsed time
+func (t *timings) record(step, name string, start time.Time) time.Duration {
+	elapsed := time.Since(start)
+	t.steps = append(t.steps, timing{step: step, name: name, elapsed: elapsed})
+	return elapsed
+}
+
+func roundElapsed(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(10 * time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
+
+// printTimings reports the summary of Run
+func (b *BarrowCtx) printTimings(t *timings, p *Package) {
+	if len(t.steps) == 0 {
+		return
+	}
+	b.stage("summary", "%s %s for %s/%s in %s", p.Name, p.Version, b.Target, b.Arch, roundElapsed(time.Since(t.start)))
+	width := 0
+	for _, s := range t.steps {
+		width = max(width, len(s.name))
+	}
+	for _, s := range t.steps {
+		b.infof("  %-8s %-*s %s", s.step, width, s.name, roundElapsed(s.elapsed))
+	}
+}
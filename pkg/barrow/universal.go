@@ -0,0 +1,136 @@
+package barrow
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+)
+
+const (
+	// ArchUniversal: darwin only, build amd64 and arm64 and merge them into a fat Mach-O
+	ArchUniversal = "universal"
+	fatHeaderSize = 8
+	fatArchSize   = 20
+)
+
+var (
+	universalArchs = []string{"amd64", "arm64"}
+)
+
+func (b *BarrowCtx) isUniversal() bool {
+	return b.Target == "darwin" && b.Arch == ArchUniversal
+}
+
+// environWithArch: replace GOARCH in environ
+func environWithArch(environ []string, arch string) []string {
+	newEnv := make([]string, 0, len(environ)+1)
+	for _, e := range environ {
+		if strings.HasPrefix(e, "GOARCH=") {
+			continue
+		}
+		newEnv = append(newEnv, e)
+	}
+	return append(newEnv, "GOARCH="+arch)
+}
+
+type fatSlice struct {
+	path   string
+	cpu    macho.Cpu
+	subCpu uint32
+	offset int64
+	size   int64
+	align  uint32
+}
+
+// lipo: arm64 pages are 16K, others 4K
+func fatAlign(cpu macho.Cpu) uint32 {
+	if cpu == macho.CpuArm64 || cpu == macho.CpuArm {
+		return 14
+	}
+	return 12
+}
+
+func alignUp(offset int64, align uint32) int64 {
+	a := int64(1) << align
+	return (offset + a - 1) &^ (a - 1)
+}
+
+// MakeFatMachO merges thin Mach-O files into a universal (fat) Mach-O, like `lipo -create`
+func MakeFatMachO(dest string, sources ...string) error {
+	if len(sources) == 0 {
+		return fmt.Errorf("make fat mach-o: no input files")
+	}
+	slices := make([]*fatSlice, 0, len(sources))
+	seen := make(map[macho.Cpu]string)
+	for _, src := range sources {
+		f, err := macho.Open(src)
+		if err != nil {
+			return fmt.Errorf("make fat mach-o: open %s error: %w", src, err)
+		}
+		s := &fatSlice{path: src, cpu: f.Cpu, subCpu: f.SubCpu, align: fatAlign(f.Cpu)}
+		_ = f.Close()
+		if prev, ok := seen[s.cpu]; ok {
+			return fmt.Errorf("make fat mach-o: %s and %s have the same architecture %s", prev, src, s.cpu)
+		}
+		seen[s.cpu] = src
+		si, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		s.size = si.Size()
+		slices = append(slices, s)
+	}
+	offset := int64(fatHeaderSize + fatArchSize*len(slices))
+	for _, s := range slices {
+		s.offset = alignUp(offset, s.align)
+		offset = s.offset + s.size
+	}
+	if offset > math.MaxUint32 {
+		return fmt.Errorf("make fat mach-o: output too large (%d bytes)", offset)
+	}
+	header := make([]byte, 0, fatHeaderSize+fatArchSize*len(slices))
+	header = binary.BigEndian.AppendUint32(header, macho.MagicFat)
+	header = binary.BigEndian.AppendUint32(header, uint32(len(slices)))
+	for _, s := range slices {
+		header = binary.BigEndian.AppendUint32(header, uint32(s.cpu))
+		header = binary.BigEndian.AppendUint32(header, s.subCpu)
+		header = binary.BigEndian.AppendUint32(header, uint32(s.offset))
+		header = binary.BigEndian.AppendUint32(header, uint32(s.size))
+		header = binary.BigEndian.AppendUint32(header, s.align)
+	}
+	fd, err := os.OpenFile(dest, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	if err := writeFatSlices(fd, header, slices); err != nil {
+		_ = fd.Close()
+		_ = os.Remove(dest)
+		return err
+	}
+	return fd.Close()
+}
+
+func writeFatSlices(fd *os.File, header []byte, slices []*fatSlice) error {
+	if _, err := fd.Write(header); err != nil {
+		return err
+	}
+	for _, s := range slices {
+		if _, err := fd.Seek(s.offset, io.SeekStart); err != nil {
+			return err
+		}
+		in, err := os.Open(s.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(fd, in)
+		_ = in.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return fd.Sync()
+}
@@ -0,0 +1,50 @@
+package barrow
+
+import (
+	"debug/macho"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeThinMachO(t *testing.T, name string, cpu macho.Cpu, subCpu uint32) string {
+	t.Helper()
+	b := make([]byte, 0, 32)
+	b = binary.LittleEndian.AppendUint32(b, macho.Magic64)
+	b = binary.LittleEndian.AppendUint32(b, uint32(cpu))
+	b = binary.LittleEndian.AppendUint32(b, subCpu)
+	b = binary.LittleEndian.AppendUint32(b, uint32(macho.TypeExec))
+	b = append(b, make([]byte, 16)...) // ncmds, sizeofcmds, flags, reserved
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, b, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestMakeFatMachO(t *testing.T) {
+	amd64 := writeThinMachO(t, "amd64", macho.CpuAmd64, 3)
+	arm64 := writeThinMachO(t, "arm64", macho.CpuArm64, 0)
+	dest := filepath.Join(t.TempDir(), "universal")
+	if err := MakeFatMachO(dest, amd64, arm64); err != nil {
+		t.Fatalf("make fat mach-o error: %v", err)
+	}
+	ff, err := macho.OpenFat(dest)
+	if err != nil {
+		t.Fatalf("open fat mach-o error: %v", err)
+	}
+	defer ff.Close()
+	if len(ff.Arches) != 2 {
+		t.Fatalf("expected 2 arches, got %d", len(ff.Arches))
+	}
+	if ff.Arches[0].Cpu != macho.CpuAmd64 || ff.Arches[1].Cpu != macho.CpuArm64 {
+		t.Fatalf("unexpected arches: %s %s", ff.Arches[0].Cpu, ff.Arches[1].Cpu)
+	}
+	if ff.Arches[1].Offset%(1<<14) != 0 {
+		t.Fatalf("arm64 slice not aligned: %d", ff.Arches[1].Offset)
+	}
+	if err := MakeFatMachO(dest, amd64, amd64); err == nil {
+		t.Fatalf("expected duplicate architecture error")
+	}
+}
@@ -0,0 +1,285 @@
+package barrow
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// VerifyReport: result of checking an artifact against the Package/Crate metadata
+type VerifyReport struct {
+	Artifact *Artifact
+	Checked  int      // number of expected entries checked
+	Problems []string // mismatches, empty when the artifact is valid
+}
+
+func (r *VerifyReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *VerifyReport) problem(format string, a ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, a...))
+}
+
+type expectedEntry struct {
+	path     string
+	mode     fs.FileMode
+	linkname string
+	source   string // regular file: compare size and digest
+	isDir    bool
+}
+
+// archivePrefix: zip and tar contents are stored under name-version-target-arch
+func (b *BarrowCtx) archivePrefix(p *Package) string {
+	return fmt.Sprintf("%s-%s-%s-%s", p.Name, p.Version, b.Target, b.Arch)
+}
+
+// expectedStaged: what the artifact must carry for a staged file
+func expectedStaged(f *StagedFile) *expectedEntry {
+	e := &expectedEntry{path: cleanEntryPath(f.Name), mode: f.Mode, isDir: f.Mode.IsDir()}
+	switch {
+	case f.Mode&fs.ModeSymlink != 0:
+		e.linkname = path.Clean(filepath.ToSlash(f.Link))
+	case f.Mode.IsRegular():
+		e.source = f.Source
+	}
+	return e
+}
+
+func fileDigest(name string) (string, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer fd.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (b *BarrowCtx) verifyEntry(r *VerifyReport, want *expectedEntry) {
+	got := r.Artifact.Lookup(want.path)
+	if got == nil {
+		r.problem("%s: missing", want.path)
+		return
+	}
+	r.Checked++
+	switch {
+	case want.isDir:
+		if !got.Mode.IsDir() {
+			r.problem("%s: expected directory, got %s", want.path, got.Mode)
+		}
+		return
+	case want.mode&fs.ModeSymlink != 0:
+		if got.Mode&fs.ModeSymlink == 0 {
+			r.problem("%s: expected symlink, got %s", want.path, got.Mode)
+			return
+		}
+		if path.Clean(got.Linkname) != want.linkname {
+			r.problem("%s: symlink target '%s', expected '%s'", want.path, got.Linkname, want.linkname)
+		}
+		return
+	}
+	if !got.Mode.IsRegular() {
+		r.problem("%s: expected regular file, got %s", want.path, got.Mode)
+		return
+	}
+	if got.Mode.Perm() != want.mode.Perm() {
+		r.problem("%s: mode %04o, expected %04o", want.path, got.Mode.Perm(), want.mode.Perm())
+	}
+	si, err := os.Stat(want.source)
+	if err != nil {
+		// staged file not available, layout checks only
+		return
+	}
+	if got.Size != si.Size() {
+		r.problem("%s: size %d, expected %d", want.path, got.Size, si.Size())
+	}
+	if len(got.Digest) == 0 {
+		return
+	}
+	if digest, err := fileDigest(want.source); err == nil && digest != got.Digest {
+		r.problem("%s: sha256 %s, expected %s", want.path, got.Digest, digest)
+	}
+}
+
+func (b *BarrowCtx) verifyMetadata(r *VerifyReport, p *Package) {
+	a := r.Artifact
+	check := func(key, want string) {
+		if got := a.Metadata[key]; got != want {
+			r.problem("metadata %s: '%s', expected '%s'", key, got, want)
+		}
+	}
+	switch a.Format {
+	case "rpm":
+		check("name", nonEmpty(p.PackageName, p.Name))
+		check("version", p.Version)
+		check("release", nonEmpty(b.Release, "1"))
+		check("arch", rpmArchGuard(b.Arch))
+	case "deb", "apk", "arch":
+		check("name", p.Name)
+		check("version", p.Version)
+		if len(b.Release) != 0 {
+			check("release", b.Release)
+		}
+	}
+	if a.Format != "deb" {
+		return
+	}
+	if a.Metadata["deb-format"] != "2.0" {
+		r.problem("debian-binary: '%s', expected '2.0'", a.Metadata["deb-format"])
+	}
+	if a.MD5Sums == nil {
+		r.problem("md5sums: missing")
+		return
+	}
+	for _, e := range a.Entries {
+		if !e.Mode.IsRegular() {
+			continue
+		}
+		sum, ok := a.MD5Sums[e.Path]
+		if !ok {
+			r.problem("md5sums: %s not listed", e.Path)
+			continue
+		}
+		if sum != e.md5 {
+			r.problem("md5sums: %s is %s, expected %s", e.Path, e.md5, sum)
+		}
+	}
+	for name := range a.MD5Sums {
+		if e := a.Lookup(name); e == nil {
+			r.problem("md5sums: %s not in data.tar", name)
+		}
+	}
+}
+
+// VerifyArtifact checks an artifact produced by Run against the Package and Crates metadata
+func (b *BarrowCtx) VerifyArtifact(p *Package, crates []*Crate, a *Artifact) *VerifyReport {
+	r := &VerifyReport{Artifact: a}
+	var prefix string
+	switch a.Format {
+	case "zip", "tar":
+		prefix = b.archivePrefix(p)
+	case "sh", "exe":
+	default:
+		prefix = p.Prefix
+	}
+	b.verifyMetadata(r, p)
+	expected := make(map[string]bool)
+	for _, item := range p.Include {
+		f, err := b.stageItem(item, prefix)
+		if err != nil {
+			r.problem("%s: %v", item.Path, err)
+			continue
+		}
+		want := expectedStaged(f)
+		expected[want.path] = true
+		b.verifyEntry(r, want)
+	}
+	for _, crate := range crates {
+		items, err := b.generatedItems(crate)
+		if err != nil {
+			r.problem("%s: %v", crate.Name, err)
+		}
+		for _, item := range items {
+			// layout checks only when Out was cleaned
+			want := &expectedEntry{path: cleanEntryPath(item.stagedName(prefix)), mode: 0644}
+			if f, err := b.stageItem(item, prefix); err == nil {
+				want = expectedStaged(f)
+			}
+			expected[want.path] = true
+			b.verifyEntry(r, want)
+		}
+		files, err := b.crateFiles(crate, prefix)
+		if err != nil {
+			r.problem("%s: %v", crate.Name, err)
+			continue
+		}
+		for _, f := range files {
+			want := expectedStaged(f)
+			expected[want.path] = true
+			b.verifyEntry(r, want)
+		}
+	}
+	switch a.Format {
+	case "rpm", "deb", "arch":
+		for _, u := range b.serviceUnits(p, crates) {
+			want := &expectedEntry{path: cleanEntryPath(path.Join(systemdUnitDir(a.Format), u.Name)), mode: 0644}
+			expected[want.path] = true
+			b.verifyEntry(r, want)
+		}
+	}
+	for _, e := range a.Entries {
+		if e.Mode.IsDir() || expected[e.Path] {
+			continue
+		}
+		// contents of an included directory
+		if included(expected, e.Path) {
+			continue
+		}
+		r.problem("%s: unexpected entry", e.Path)
+	}
+	return r
+}
+
+func included(expected map[string]bool, name string) bool {
+	for dir := path.Dir(name); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if expected[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// Verify parses the artifact in pure Go and checks it against bali.toml and crate.toml
+func (b *BarrowCtx) Verify(ctx context.Context, artifact string) (*VerifyReport, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	p, err := b.LoadPackage(b.CWD)
+	if err != nil {
+		return nil, err
+	}
+	if b.extraEnv == nil {
+		b.extraEnv = make(map[string]string)
+	}
+	b.extraEnv["BUILD_VERSION"] = p.Version
+	crates := make([]*Crate, 0, len(p.Crates))
+	for _, location := range p.Crates {
+		crate, err := b.LoadCrate(location)
+		if err != nil {
+			return nil, err
+		}
+		crates = append(crates, crate)
+	}
+	a, err := OpenArtifact(artifact)
+	if err != nil {
+		return nil, fmt.Errorf("verify %s: %w", filepath.Base(artifact), err)
+	}
+	if a.Format == "msi" {
+		// files are stored in the cabinet stream
+		return nil, fmt.Errorf("verify %s: msi contents cannot be verified", filepath.Base(artifact))
+	}
+	r := b.VerifyArtifact(p, crates, a)
+	name := filepath.Base(artifact)
+	if !r.OK() {
+		b.stage("verify", "%s (%s): %d problems", name, a.Format, len(r.Problems))
+		for _, problem := range r.Problems {
+			b.errorf("  %s", problem)
+		}
+		return r, fmt.Errorf("verify %s: %s", name, strings.Join(r.Problems, "; "))
+	}
+	b.stage("verify", "%s (%s): %d entries ok", name, a.Format, r.Checked)
+	return r, nil
+}
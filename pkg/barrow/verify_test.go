@@ -0,0 +1,164 @@
+package barrow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestModule: a module with one include and one pre-built crate
+func newTestModule(t *testing.T) (*BarrowCtx, *Package, []*Crate) {
+	t.Helper()
+	cwd := t.TempDir()
+	files := map[string]string{
+		"bali.toml": `name = "jack"
+version = "1.2.3"
+summary = "Jack test package"
+description = "Jack test package"
+license = "MIT"
+prefix = "/usr/local"
+crates = ["cmd/jack"]
+
+[[include]]
+path = "LICENSE"
+destination = "share"
+rename = "JACK-LICENSE.txt"
+permissions = "0644"
+`,
+		"LICENSE": "MIT License\n",
+		"cmd/jack/crate.toml": `name = "jack"
+destination = "bin"
+alias = ["bin/jack-alias"]
+`,
+		"build/bin/jack": "#!/bin/sh\necho jack\n",
+	}
+	for name, content := range files {
+		p := filepath.Join(cwd, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := &BarrowCtx{
+		CWD:         cwd,
+		Out:         filepath.Join(cwd, "build"),
+		Target:      "linux",
+		Arch:        "amd64",
+		Release:     "1",
+		Destination: filepath.Join(cwd, "out"),
+		extraEnv:    map[string]string{},
+	}
+	p, err := b.LoadPackage(cwd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.extraEnv["BUILD_VERSION"] = p.Version
+	crate, err := b.LoadCrate("cmd/jack")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, p, []*Crate{crate}
+}
+
+func TestVerifyArtifacts(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	ctx := context.Background()
+	packers := map[string]func(context.Context, *Package, []*Crate) (string, error){
+		"zip":  b.zip,
+		"tar":  b.tar,
+		"sh":   b.sh,
+		"rpm":  b.rpm,
+		"deb":  b.deb,
+		"apk":  b.apk,
+		"arch": b.archLinux,
+	}
+	for format, pack := range packers {
+		artifact, err := pack(ctx, p, crates)
+		if err != nil {
+			t.Fatalf("pack %s error: %v", format, err)
+		}
+		r, err := b.Verify(ctx, artifact)
+		if err != nil {
+			t.Fatalf("verify %s error: %v", format, err)
+		}
+		if r.Artifact.Format != format {
+			t.Fatalf("detect %s: got %s", artifact, r.Artifact.Format)
+		}
+		if r.Checked == 0 {
+			t.Fatalf("verify %s: no entries checked", format)
+		}
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	artifact, err := b.tar(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := OpenArtifact(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Include[0].Permissions = "0600"
+	if r := b.VerifyArtifact(p, crates, a); r.OK() {
+		t.Fatalf("expected mode mismatch")
+	}
+}
+
+func TestInspectSignatures(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	ctx := context.Background()
+	packers := map[string]func(context.Context, *Package, []*Crate) (string, error){
+		"tar": b.tar,
+		"rpm": b.rpm,
+		"deb": b.deb,
+		"apk": b.apk,
+	}
+	for format, pack := range packers {
+		artifact, err := pack(ctx, p, crates)
+		if err != nil {
+			t.Fatalf("pack %s error: %v", format, err)
+		}
+		a, err := OpenArtifact(artifact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sb strings.Builder
+		if err := a.WriteTable(&sb); err != nil {
+			t.Fatal(err)
+		}
+		// tar cannot carry signatures, unsigned builds of the others say so
+		signed := slices.ContainsFunc(strings.Split(sb.String(), "\n"), func(line string) bool {
+			return strings.Join(strings.Fields(line), " ") == "signed: no"
+		})
+		if signed == (format == "tar") || len(a.Signatures) != 0 {
+			t.Fatalf("%s signatures %v:\n%s", format, a.Signatures, sb.String())
+		}
+	}
+}
+
+func TestOpenArtifactCompression(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	for _, method := range []string{"none", "gzip", "zstd", "xz", "bzip2", "brotli"} {
+		b.Compression = method
+		for _, pack := range []func(context.Context, *Package, []*Crate) (string, error){b.tar, b.sh} {
+			artifact, err := pack(context.Background(), p, crates)
+			if err != nil {
+				t.Fatalf("pack %s error: %v", method, err)
+			}
+			a, err := OpenArtifact(artifact)
+			if err != nil {
+				t.Fatalf("open %s error: %v", filepath.Base(artifact), err)
+			}
+			if len(a.Entries) != 3 {
+				t.Fatalf("%s: expected 3 entries, got %d", filepath.Base(artifact), len(a.Entries))
+			}
+		}
+	}
+}
@@ -1,16 +1,18 @@
 package barrow
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 
 	"github.com/balibuild/bali/v3/modules/goversioninfo"
 )
 
-func (b *BarrowCtx) makeResources(e *Crate, saveTo string) error {
+// versionInfo loads winres.toml of the crate, missing strings default to crate.toml
+func (b *BarrowCtx) versionInfo(e *Crate) (*goversioninfo.VersionInfo, error) {
 	var vi goversioninfo.VersionInfo
-	if err := LoadMetadata(filepath.Join(e.cwd, "winres.toml"), &vi); err != nil && !os.IsNotExist(err) {
-		return err
+	if err := LoadMetadata(filepath.Join(e.cwd, "winres.toml"), &vi); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
 	}
 	if len(vi.StringFileInfo.FileVersion) == 0 {
 		vi.StringFileInfo.FileVersion = e.Version
@@ -51,7 +53,27 @@ func (b *BarrowCtx) makeResources(e *Crate, saveTo string) error {
 	if vi.VarFileInfo.CharsetID == 0 {
 		vi.VarFileInfo.CharsetID = goversioninfo.CsUnicode
 	}
+	return &vi, nil
+}
+
+func (b *BarrowCtx) makeResources(e *Crate, saveTo string) error {
+	vi, err := b.versionInfo(e)
+	if err != nil {
+		return err
+	}
 	vi.Build()
 	vi.Walk()
 	return vi.WriteSyso(e.cwd, saveTo, b.Arch)
 }
+
+// stringFileInfo: version information strings of the first crate, used by package manager manifests
+func (b *BarrowCtx) stringFileInfo(crates []*Crate) (*goversioninfo.StringFileInfo, error) {
+	if len(crates) == 0 {
+		return &goversioninfo.StringFileInfo{}, nil
+	}
+	vi, err := b.versionInfo(crates[0])
+	if err != nil {
+		return nil, err
+	}
+	return &vi.StringFileInfo, nil
+}
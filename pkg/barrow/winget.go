@@ -0,0 +1,253 @@
+package barrow
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"go.yaml.in/yaml/v3"
+)
+
+type WingetConfig struct {
+	Identifier string   `toml:"identifier,omitempty"` // Publisher.Package, default: derived from vendor and product name
+	Locale     string   `toml:"locale,omitempty"`     // default: en-US
+	Tags       []string `toml:"tags,omitempty"`
+}
+
+const (
+	wingetManifestVersion = "1.6.0"
+	wingetSchemaURL       = "https://aka.ms/winget-manifest.%s.%s.schema.json"
+)
+
+var (
+	wingetArchs = map[string]string{
+		"amd64": "x64",
+		"386":   "x86",
+		"arm64": "arm64",
+	}
+	// installers preferred first
+	wingetInstallerSuffixes = []string{".msi", "-setup.exe", ".zip"}
+)
+
+type wingetVersion struct {
+	PackageIdentifier string `yaml:"PackageIdentifier"`
+	PackageVersion    string `yaml:"PackageVersion"`
+	DefaultLocale     string `yaml:"DefaultLocale"`
+	ManifestType      string `yaml:"ManifestType"`
+	ManifestVersion   string `yaml:"ManifestVersion"`
+}
+
+type wingetNestedFile struct {
+	RelativeFilePath     string `yaml:"RelativeFilePath"`
+	PortableCommandAlias string `yaml:"PortableCommandAlias,omitempty"`
+}
+
+type wingetSwitches struct {
+	Silent             string `yaml:"Silent,omitempty"`
+	SilentWithProgress string `yaml:"SilentWithProgress,omitempty"`
+	InstallLocation    string `yaml:"InstallLocation,omitempty"`
+}
+
+type wingetInstaller struct {
+	Architecture         string              `yaml:"Architecture"`
+	InstallerType        string              `yaml:"InstallerType"`
+	NestedInstallerType  string              `yaml:"NestedInstallerType,omitempty"`
+	NestedInstallerFiles []*wingetNestedFile `yaml:"NestedInstallerFiles,omitempty"`
+	Scope                string              `yaml:"Scope,omitempty"`
+	InstallerURL         string              `yaml:"InstallerUrl"`
+	InstallerSha256      string              `yaml:"InstallerSha256"`
+	InstallerSwitches    *wingetSwitches     `yaml:"InstallerSwitches,omitempty"`
+}
+
+type wingetInstallers struct {
+	PackageIdentifier string             `yaml:"PackageIdentifier"`
+	PackageVersion    string             `yaml:"PackageVersion"`
+	Installers        []*wingetInstaller `yaml:"Installers"`
+	ManifestType      string             `yaml:"ManifestType"`
+	ManifestVersion   string             `yaml:"ManifestVersion"`
+}
+
+type wingetLocale struct {
+	PackageIdentifier string   `yaml:"PackageIdentifier"`
+	PackageVersion    string   `yaml:"PackageVersion"`
+	PackageLocale     string   `yaml:"PackageLocale"`
+	Publisher         string   `yaml:"Publisher"`
+	PackageName       string   `yaml:"PackageName"`
+	PackageURL        string   `yaml:"PackageUrl,omitempty"`
+	License           string   `yaml:"License"`
+	Copyright         string   `yaml:"Copyright,omitempty"`
+	ShortDescription  string   `yaml:"ShortDescription"`
+	Description       string   `yaml:"Description,omitempty"`
+	Moniker           string   `yaml:"Moniker,omitempty"`
+	Tags              []string `yaml:"Tags,omitempty"`
+	ManifestType      string   `yaml:"ManifestType"`
+	ManifestVersion   string   `yaml:"ManifestVersion"`
+}
+
+// wingetIdentifierPart: keep letters and digits, "Bali Build" --> BaliBuild
+func wingetIdentifierPart(s string) string {
+	var sb strings.Builder
+	upper := true
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if upper {
+				r = unicode.ToUpper(r)
+			}
+			sb.WriteRune(r)
+			upper = false
+		case r == '-' || r == '_':
+			sb.WriteRune(r)
+		default:
+			upper = true
+		}
+	}
+	return sb.String()
+}
+
+func (b *BarrowCtx) wingetInstaller(p *Package, crates []*Crate, a *releaseArchive) *wingetInstaller {
+	i := &wingetInstaller{
+		Architecture:    wingetArchs[a.Arch],
+		InstallerURL:    a.URL,
+		InstallerSha256: strings.ToUpper(a.SHA256),
+	}
+	switch {
+	case strings.HasSuffix(a.Name, ".msi"):
+		i.InstallerType = "msi"
+		i.Scope = "machine"
+	case strings.HasSuffix(a.Name, "-setup.exe"):
+		i.InstallerType = "exe"
+		i.Scope = "user"
+		if p.Exe != nil && strings.EqualFold(p.Exe.Scope, "machine") {
+			i.Scope = "machine"
+		}
+		i.InstallerSwitches = &wingetSwitches{Silent: "--quiet", SilentWithProgress: "--quiet", InstallLocation: `--prefix="<INSTALLPATH>"`}
+	default:
+		// zip archives keep the package layout below name-version-target-arch
+		i.InstallerType = "zip"
+		i.NestedInstallerType = "portable"
+		prefix := strings.TrimSuffix(a.Name, ".zip")
+		for _, crate := range crates {
+			i.NestedInstallerFiles = append(i.NestedInstallerFiles, &wingetNestedFile{
+				RelativeFilePath:     strings.ReplaceAll(path.Join(prefix, ToNixPath(crate.Destination), crate.Name+".exe"), "/", `\`),
+				PortableCommandAlias: crate.Name,
+			})
+		}
+	}
+	return i
+}
+
+func marshalWinget(manifestType string, v any) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Created with bali\n# yaml-language-server: $schema="+wingetSchemaURL+"\n\n", manifestType, wingetManifestVersion)
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// winget writes the version, installer and default locale manifests for the windows installers in Destination,
+// laid out like the winget-pkgs repository: winget/manifests/<p>/<Publisher>/<Package>/<version>
+func (b *BarrowCtx) winget(ctx context.Context, p *Package, crates []*Crate) (string, error) {
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	default:
+	}
+	cfg := p.Winget
+	if cfg == nil {
+		cfg = &WingetConfig{}
+	}
+	sfi, err := b.stringFileInfo(crates)
+	if err != nil {
+		return "", err
+	}
+	publisher := nonEmpty(p.Vendor, sfi.CompanyName)
+	packageName := nonEmpty(sfi.ProductName, p.Name)
+	identifier := cfg.Identifier
+	if len(identifier) == 0 {
+		if len(publisher) == 0 {
+			return "", fmt.Errorf("winget: publisher is unknown, set vendor, CompanyName in winres.toml or [winget] identifier")
+		}
+		identifier = wingetIdentifierPart(publisher) + "." + wingetIdentifierPart(packageName)
+	}
+	locale := &wingetLocale{
+		PackageIdentifier: identifier,
+		PackageVersion:    p.Version,
+		PackageLocale:     nonEmpty(cfg.Locale, "en-US"),
+		Publisher:         publisher,
+		PackageName:       packageName,
+		PackageURL:        p.Homepage,
+		License:           p.License,
+		Copyright:         sfi.LegalCopyright,
+		ShortDescription:  nonEmpty(p.Summary, sfi.FileDescription),
+		Description:       p.Description,
+		Moniker:           p.Name,
+		Tags:              cfg.Tags,
+		ManifestType:      "defaultLocale",
+		ManifestVersion:   wingetManifestVersion,
+	}
+	for _, kv := range [][2]string{{"Publisher", locale.Publisher}, {"License", locale.License}, {"ShortDescription", locale.ShortDescription}} {
+		if len(kv[1]) == 0 {
+			return "", fmt.Errorf("winget: %s is required", kv[0])
+		}
+	}
+	archives, err := b.releaseArchives(p, []string{"windows"}, wingetInstallerSuffixes)
+	if err != nil {
+		return "", err
+	}
+	installers := &wingetInstallers{
+		PackageIdentifier: identifier,
+		PackageVersion:    p.Version,
+		ManifestType:      "installer",
+		ManifestVersion:   wingetManifestVersion,
+	}
+	for _, a := range archives {
+		if _, ok := wingetArchs[a.Arch]; !ok {
+			continue
+		}
+		b.stage("winget", "%s/%s --> %s", a.Target, a.Arch, a.URL)
+		installers.Installers = append(installers.Installers, b.wingetInstaller(p, crates, a))
+	}
+	version := &wingetVersion{
+		PackageIdentifier: identifier,
+		PackageVersion:    p.Version,
+		DefaultLocale:     locale.PackageLocale,
+		ManifestType:      "version",
+		ManifestVersion:   wingetManifestVersion,
+	}
+	dir, err := b.ArtifactName("winget", p, map[string]string{
+		"initial":    strings.ToLower(identifier[:1]),
+		"identifier": strings.ReplaceAll(identifier, ".", "/"),
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, m := range []struct {
+		suffix       string
+		manifestType string
+		v            any
+	}{
+		{".yaml", version.ManifestType, version},
+		{".installer.yaml", installers.ManifestType, installers},
+		{".locale." + locale.PackageLocale + ".yaml", locale.ManifestType, locale},
+	} {
+		data, err := marshalWinget(m.manifestType, m.v)
+		if err != nil {
+			return "", err
+		}
+		if _, err := b.writeManifest(ctx, filepath.Join(dir, identifier+m.suffix), data); err != nil {
+			return "", err
+		}
+	}
+	return b.destinationPath(dir), nil
+}
@@ -0,0 +1,172 @@
+package barrow
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.yaml.in/yaml/v3"
+)
+
+func TestWingetIdentifierPart(t *testing.T) {
+	for s, want := range map[string]string{
+		"Bali Build":    "BaliBuild",
+		"bali":          "Bali",
+		"go-tool":       "Go-tool",
+		"Acme, Inc.":    "AcmeInc",
+		"my_app 2 beta": "My_app2Beta",
+	} {
+		if got := wingetIdentifierPart(s); got != want {
+			t.Errorf("wingetIdentifierPart(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
+
+func TestWinget(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	b.Target = "windows"
+	p.Release = &ReleaseConfig{URL: "https://example.com/$BALI_ARTIFACT_NAME"}
+	if _, err := b.winget(context.Background(), p, crates); err == nil {
+		t.Fatal("winget without publisher succeeded")
+	}
+	p.Vendor = "Bali Build"
+	hashes := writeTestArchives(t, b,
+		"jack-1.2.3-windows-amd64.msi",
+		"jack-1.2.3-windows-amd64.zip", // msi preferred
+		"jack-1.2.3-windows-arm64-setup.exe",
+		"jack-1.2.3-windows-386.zip",
+	)
+	dir, err := b.winget(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(b.Destination, "winget", "manifests", "b", "BaliBuild", "Jack", "1.2.3"); dir != want {
+		t.Fatalf("manifests in %s, want %s", dir, want)
+	}
+	var installers wingetInstallers
+	data, err := os.ReadFile(filepath.Join(dir, "BaliBuild.Jack.installer.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "# Created with bali\n# yaml-language-server: $schema=https://aka.ms/winget-manifest.installer.1.6.0.schema.json\n") {
+		t.Errorf("installer manifest header:\n%s", data)
+	}
+	if err := yaml.Unmarshal(data, &installers); err != nil {
+		t.Fatal(err)
+	}
+	if len(installers.Installers) != 3 {
+		t.Fatalf("installers:\n%s", data)
+	}
+	types := make(map[string]*wingetInstaller)
+	for _, i := range installers.Installers {
+		types[i.Architecture] = i
+	}
+	if x64 := types["x64"]; x64 == nil || x64.InstallerType != "msi" || x64.InstallerSha256 != strings.ToUpper(hashes["jack-1.2.3-windows-amd64.msi"]) {
+		t.Errorf("x64: %+v", x64)
+	}
+	if arm64 := types["arm64"]; arm64 == nil || arm64.InstallerType != "exe" || arm64.Scope != "user" || arm64.InstallerSwitches == nil {
+		t.Errorf("arm64: %+v", arm64)
+	}
+	x86 := types["x86"]
+	if x86 == nil || x86.InstallerType != "zip" || x86.NestedInstallerType != "portable" || len(x86.NestedInstallerFiles) != 1 ||
+		x86.NestedInstallerFiles[0].RelativeFilePath != `jack-1.2.3-windows-386\bin\jack.exe` {
+		t.Errorf("x86: %+v", x86)
+	}
+	var locale wingetLocale
+	if data, err = os.ReadFile(filepath.Join(dir, "BaliBuild.Jack.locale.en-US.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(data, &locale); err != nil {
+		t.Fatal(err)
+	}
+	if locale.Publisher != "Bali Build" || locale.License != "MIT" || locale.ShortDescription != "Jack test package" || locale.ManifestType != "defaultLocale" {
+		t.Errorf("locale:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "BaliBuild.Jack.yaml")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChocolatey(t *testing.T) {
+	b, p, crates := newTestModule(t)
+	b.Target = "windows"
+	p.Vendor = "Bali Build"
+	p.Release = &ReleaseConfig{URL: "https://example.com/$BALI_ARTIFACT_NAME"}
+	hashes := writeTestArchives(t, b, "jack-1.2.3-windows-amd64.zip", "jack-1.2.3-windows-386.zip", "jack-1.2.3-windows-amd64.msi")
+	artifact, err := b.chocolatey(context.Background(), p, crates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Base(artifact) != "jack.1.2.3.nupkg" {
+		t.Fatalf("artifact %s", artifact)
+	}
+	z, err := zip.OpenReader(artifact)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close() // nolint
+	contents := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(r)
+		_ = r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[f.Name] = string(data)
+	}
+	for _, name := range []string{"jack.nuspec", chocolateyInstall, "[Content_Types].xml", "_rels/.rels"} {
+		if _, ok := contents[name]; !ok {
+			t.Errorf("nupkg missing %s: %v", name, contents)
+		}
+	}
+	var n nuspec
+	if err := xml.Unmarshal([]byte(contents["jack.nuspec"]), &n); err != nil {
+		t.Fatal(err)
+	}
+	if n.Metadata.ID != "jack" || n.Metadata.Version != "1.2.3" || n.Metadata.Authors != "Bali Build" ||
+		n.Metadata.LicenseURL != "https://spdx.org/licenses/MIT.html" || n.Metadata.Description != "Jack test package" {
+		t.Errorf("nuspec: %+v", n.Metadata)
+	}
+	script := contents[chocolateyInstall]
+	for _, want := range []string{
+		"url64bit      = 'https://example.com/jack-1.2.3-windows-amd64.zip'",
+		"checksum64    = '" + hashes["jack-1.2.3-windows-amd64.zip"] + "'",
+		"url           = 'https://example.com/jack-1.2.3-windows-386.zip'",
+		"checksum      = '" + hashes["jack-1.2.3-windows-386.zip"] + "'",
+		"Install-ChocolateyZipPackage @packageArgs",
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("install script missing %q:\n%s", want, script)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(b.Destination, "jack.nuspec")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPackFormats(t *testing.T) {
+	b, p, _ := newTestModule(t)
+	b.Pack = []string{"zip", "msi"}
+	if got := b.packFormats(p); !slices.Equal(got, b.Pack) {
+		t.Errorf("linux formats: %v", got)
+	}
+	b.Target = "windows"
+	p.Release = &ReleaseConfig{URL: "https://example.com/$BALI_ARTIFACT_NAME"}
+	if got := b.packFormats(p); !slices.Equal(got, []string{"zip", "msi", "winget", "chocolatey"}) {
+		t.Errorf("windows formats: %v", got)
+	}
+	b.Pack = []string{"msi", "winget"}
+	if got := b.packFormats(p); !slices.Equal(got, []string{"msi", "winget"}) {
+		t.Errorf("windows msi formats: %v", got)
+	}
+}